@@ -6,8 +6,18 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"regexp"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -20,37 +30,399 @@ const (
 	desc = "Wait until TCP server(s) are ready to accept connections"
 )
 
-var (
-	// These are meant to be overidden at built time using ldflags -X.
-	buildTime = "?"
-	version   = "dev"
-	gitCommit = "?"
+// Exit codes of the wait operation.
+const (
+	// exitOK is the exit code for when all servers are ready.
+	exitOK = 0
+	// exitFailure is the exit code for when the wait operation fails for reasons other than those
+	// below.
+	exitFailure = 1
+	// exitParseError is the exit code for invalid addresses or options.
+	exitParseError = 2
+	// exitTimeout is the exit code for when the timeout limit is exceeded. It is the same exit
+	// code used by GNU timeout.
+	exitTimeout = 124
+)
+
+// Values of the --mode flag, for how TCP servers are checked for readiness.
+const (
+	// tcpModeConnect is the mode in which servers are ready as soon as a connection can be made.
+	tcpModeConnect = "connect"
+	// tcpModeServiceAnswer is the mode in which servers are only ready once they send data, either
+	// a banner or a response to --send, within the poll frequency. This tells services that answer
+	// apart from sockets that are held open by others on their behalf, such as by systemd socket
+	// activation, which accept connections before the service itself runs.
+	tcpModeServiceAnswer = "service-answer"
 )
 
+// anyDataPattern is the banner pattern of tcpModeServiceAnswer, which matches any data.
+var anyDataPattern = regexp.MustCompile(`(?s).`)
+
+// mode is the kind of targets that a command waits for.
+type mode int
+
+const (
+	// modeTCP is the mode for waiting on TCP servers, and on files and commands given as `file://`
+	// and `exec://` addresses.
+	modeTCP mode = iota
+	// modeHTTP is the mode for waiting on HTTP servers.
+	modeHTTP
+	// modeAny is the mode for waiting on HTTP servers, files, commands, and TCP servers, depending
+	// on the scheme of each address.
+	modeAny
+)
+
+// config is the container for command line options of a wait operation.
+type config struct {
+	// mode is the kind of targets being waited.
+	mode mode
+	// waitTimeout is the maximum duration of the whole wait operation, or wait.NoTimeout if it has
+	// none.
+	waitTimeout time.Duration
+	// isTimeoutSet is whether waitTimeout was given explicitly, on the command line or in the
+	// defaults file, instead of being the default.
+	isTimeoutSet bool
+	// deadline is the time at which the whole wait operation gives up, either as an RFC3339
+	// timestamp or as a duration from now. If empty, only waitTimeout applies.
+	deadline string
+	// rounds is the maximum number of times the whole wait operation is run, with each round after
+	// the first starting only if the previous one failed. Values below 1 mean a single round.
+	rounds int
+	// roundInterval is how long to sleep between rounds.
+	roundInterval time.Duration
+	// defaultPollFreq is the poll frequency of addresses that do not specify their own.
+	defaultPollFreq time.Duration
+	// noImmediateCheck is whether the first attempt on each target is made only after the first
+	// poll interval.
+	noImmediateCheck bool
+	// jitter is the maximum fraction by which poll intervals randomly deviate from the poll
+	// frequency.
+	jitter float64
+	// jitterSeed is the seed of the random number generators for poll interval jitters. If 0, the
+	// generators are seeded with the current time.
+	jitterSeed int64
+	// retryOnError is whether all connection errors are retried.
+	retryOnError bool
+	// once is whether each target is checked only once, without waiting for it to be ready.
+	once bool
+	// expectUnreachable is whether the exit code is inverted, so that the wait operation fails as
+	// soon as any target is ready, and succeeds if none is, for asserting that targets are not
+	// reachable.
+	expectUnreachable bool
+	// attempts is the maximum number of attempts on each target. If positive and waitTimeout is not
+	// given explicitly, it also sets the timeout limit, to attempts times defaultPollFreq. Values
+	// below 1 mean no limit.
+	attempts int
+	// failOnNXDomain is whether targets whose host names do not exist fail immediately, even if
+	// retryOnError is set.
+	failOnNXDomain bool
+	// tcpKeepAlive is the interval between TCP keep-alive probes on connections. If zero, the
+	// default interval is used, and if negative, no probes are sent.
+	tcpKeepAlive time.Duration
+	// proxy is the raw URL of the proxy server through which connections are made. If empty, the
+	// proxy is read from the environment.
+	proxy string
+	// noProxy is whether HTTP requests are sent directly, ignoring the proxy settings of the
+	// environment.
+	noProxy bool
+	// httpKeepAlive is whether connections are reused across HTTP requests.
+	httpKeepAlive bool
+	// httpStatus is the HTTP response status codes and ranges of codes of servers that are ready,
+	// as accepted by wait.ParseStatusRanges. If empty, all 2xx codes are accepted.
+	httpStatus string
+	// expectBody is the regular expression that HTTP response bodies must match. If empty, bodies
+	// are not checked.
+	expectBody string
+	// httpMethod is the method of HTTP requests.
+	httpMethod string
+	// httpHeaders are the header entries sent with HTTP requests, each given as `<key>: <value>`.
+	httpHeaders []string
+	// tlsPins are the SHA-256 fingerprints, in hex, of the certificates that HTTPS servers may
+	// present. If empty, certificates are verified against the trusted certificate authorities.
+	tlsPins []string
+	// tlsPinStrict is whether HTTPS servers presenting certificates that are not pinned fail
+	// immediately instead of being polled again.
+	tlsPinStrict bool
+	// family is the network on which connections are made, as accepted by wait.ParseNetwork.
+	family string
+	// resolver is the address of the DNS server used for resolving host names. If empty, the
+	// resolvers configured by the operating system are used.
+	resolver string
+	// bind is the local IP address from which connections originate. If empty, the operating
+	// system picks one.
+	bind string
+	// netns is the path of the network namespace from which connections are made. If empty, they
+	// are made from the network namespace of the process.
+	netns string
+	// proxyProtocol is the version of the PROXY protocol header sent to servers upon connection,
+	// as accepted by wait.ParseProxyProtocol. If empty, no header is sent.
+	proxyProtocol string
+	// send is the payload sent to servers upon connection, with Go escape sequences. If empty,
+	// nothing is sent.
+	send string
+	// expectBanner is the regular expression that server banners, or responses to the sent
+	// payload, must match. If empty, nothing is checked.
+	expectBanner string
+	// readBytes is the maximum number of bytes of banners or responses read for matching
+	// expectBanner. If 0, the default of the wait package is used.
+	readBytes int
+	// readTimeout is how long to wait for banners or responses. If 0, the poll frequency is used.
+	readTimeout time.Duration
+	// tcpMode is how TCP servers are checked for readiness, as one of the tcpMode* values. If
+	// empty, tcpModeConnect is used.
+	tcpMode string
+	// strictTargets are the TCP targets that fail as soon as their connections are refused,
+	// instead of being waited until they accept connections.
+	strictTargets []string
+	// hold is how long connections are kept open to check that servers do not close them. If zero,
+	// connections are closed right away.
+	hold time.Duration
+	// firstReadyWins is whether targets with the same name are grouped, with any of them being
+	// ready enough for the group to be ready.
+	firstReadyWins bool
+	// dedup is whether targets with identical addresses are waited only once.
+	dedup bool
+	// maxCIDRHosts is the maximum number of hosts that a `cidr:` address may expand to. If zero,
+	// the default of the wait package applies.
+	maxCIDRHosts int
+	// fromEnv is the prefix of the environment variables from which `tcp://` addresses are read.
+	// If empty, the environment is not read.
+	fromEnv string
+	// expandEnv is whether `${VAR}` and `$VAR` references in addresses are replaced with the
+	// values of the environment variables.
+	expandEnv bool
+	// allowUnsetEnv is whether references to unset environment variables are replaced with empty
+	// strings instead of being errors.
+	allowUnsetEnv bool
+	// skipInvalid is whether addresses that can not be parsed are skipped with a warning instead of
+	// failing the wait operation.
+	skipInvalid bool
+	// execShell is whether the command lines of `exec://` addresses are run by the shell instead of
+	// directly.
+	execShell bool
+	// schemePorts are default port numbers of protocol schemes, each given as `<scheme>=<port>`.
+	schemePorts []string
+	// schemePollFreqs are default poll frequencies of protocol schemes, each given as
+	// `<scheme>=<freq>`. They take precedence over defaultPollFreq, but not over poll frequencies
+	// given in addresses.
+	schemePollFreqs []string
+	// showSummary is whether a table of the result of each target is shown at the end.
+	showSummary bool
+	// count is whether all targets are waited until they finish, showing only how many of them are
+	// ready at the end instead of any messages.
+	count bool
+	// reportPath is the path of the JSON file to which the final results are written. If empty, no
+	// file is written.
+	reportPath string
+	// format is the Go template with which each message is shown, executed against a
+	// messageView. If empty, messages are shown in the default format.
+	format string
+	// priorities are the targets presented ahead of the others, with their messages tagged.
+	priorities []string
+	// selfHealth is the address on which the status of the wait operation is served as JSON while
+	// waiting, e.g. `:8081`. If empty, it is not served.
+	selfHealth string
+	// eventsSocket is the path of the Unix socket through which the messages of the wait operation
+	// are streamed as JSON lines while waiting. If empty, they are not streamed.
+	eventsSocket string
+	// logFile is the path of the file to which all messages and connection attempts are written as
+	// JSON lines. If empty, no file is written.
+	logFile string
+	// logMaxSize is the size, as accepted by parseByteSize, beyond which the log file is rotated.
+	// If empty, it is never rotated.
+	logMaxSize string
+	// warnSlowerThan is how long targets may take to be ready before a warning is shown for them.
+	// If zero, no warnings are shown.
+	warnSlowerThan time.Duration
+	// onReadyExec is the command run for each target as soon as it is ready, with its arguments
+	// executed as Go templates against a messageView. If empty, no command is run.
+	onReadyExec string
+	// timeUnit is the unit in which elapsed times are shown, as accepted by parseTimeUnit. If
+	// empty, the unit is picked automatically.
+	timeUnit string
+	// noConfig is whether the defaults file is ignored.
+	noConfig bool
+	// isVerbose is whether every connection attempt is shown in addition to the waiting messages.
+	isVerbose bool
+	// isQuietReady is whether waiting messages are suppressed, except for failures and the final
+	// message.
+	isQuietReady bool
+	// isQuiet is whether all messages are suppressed.
+	isQuiet bool
+	// isSilent is whether nothing at all is written to stdout or stderr, not even errors, so that
+	// only the exit code tells the outcome.
+	isSilent bool
+}
+
+// minTimeout is the timeout limit of wait operations whose deadline has already passed. It can not
+// be zero, since that is wait.NoTimeout.
+const minTimeout = time.Nanosecond
+
+// resolveTimeout returns the maximum duration of the whole wait operation starting at the given
+// time. The timeout is the one given explicitly, or else the one implied by the maximum number of
+// attempts if set, or else the default. If a deadline is set, the result is the duration until the
+// deadline, or the explicit or implied timeout if it is sooner. A timeout of wait.NoTimeout means
+// no limit, so only the deadline applies then. Deadlines that have already passed result in
+// minTimeout.
+func (cfg *config) resolveTimeout(now time.Time) (time.Duration, error) {
+	waitTimeout, isTimeoutSet := cfg.waitTimeout, cfg.isTimeoutSet
+	if !isTimeoutSet && cfg.attempts > 0 {
+		waitTimeout, isTimeoutSet = time.Duration(cfg.attempts)*cfg.defaultPollFreq, true
+	}
+	if cfg.deadline == "" {
+		return waitTimeout, nil
+	}
+
+	deadline, err := parseDeadline(cfg.deadline, now)
+	if err != nil {
+		return 0, err
+	}
+
+	timeout := deadline.Sub(now)
+	if isTimeoutSet && waitTimeout != wait.NoTimeout && waitTimeout < timeout {
+		timeout = waitTimeout
+	}
+	if timeout < minTimeout {
+		timeout = minTimeout
+	}
+
+	return timeout, nil
+}
+
+// validate checks that the given command line options do not conflict with each other.
+func (cfg *config) validate() error {
+	var verbosities []string
+	if cfg.isVerbose {
+		verbosities = append(verbosities, "--verbose")
+	}
+	if cfg.isQuiet {
+		verbosities = append(verbosities, "--quiet")
+	}
+	if cfg.isQuietReady {
+		verbosities = append(verbosities, "--quiet-ready")
+	}
+	if cfg.isSilent {
+		verbosities = append(verbosities, "--silent")
+	}
+	if cfg.count {
+		verbosities = append(verbosities, "--count")
+	}
+	if len(verbosities) > 1 {
+		return fmt.Errorf("flags %s can not be used together", strings.Join(verbosities, " and "))
+	}
+	if cfg.once && cfg.retryOnError {
+		return fmt.Errorf("flags --once and --retry-on-error can not be used together")
+	}
+	if cfg.attempts < 0 {
+		return fmt.Errorf("--attempts must not be negative, got: %d", cfg.attempts)
+	}
+	if cfg.expectUnreachable && cfg.isTimeoutSet && cfg.waitTimeout == wait.NoTimeout &&
+		cfg.deadline == "" && !cfg.once && cfg.attempts == 0 {
+		return fmt.Errorf("flag --expect-unreachable requires a timeout")
+	}
+	if cfg.allowUnsetEnv && !cfg.expandEnv {
+		return fmt.Errorf("flag --allow-unset-env requires --expand-env")
+	}
+	if cfg.proxy != "" && cfg.noProxy {
+		return fmt.Errorf("flags --proxy and --no-proxy can not be used together")
+	}
+	if cfg.jitter < 0 || cfg.jitter >= 1 {
+		return fmt.Errorf("jitter must be in [0, 1), got: %g", cfg.jitter)
+	}
+	if cfg.logMaxSize != "" && cfg.logFile == "" {
+		return fmt.Errorf("flag --log-max-size requires --log-file")
+	}
+	if cfg.warnSlowerThan < 0 {
+		return fmt.Errorf("--warn-slower-than must not be negative, got: %s", cfg.warnSlowerThan)
+	}
+	if cfg.rounds < 0 {
+		return fmt.Errorf("--rounds must not be negative, got: %d", cfg.rounds)
+	}
+	if cfg.roundInterval < 0 {
+		return fmt.Errorf("--round-interval must not be negative, got: %s", cfg.roundInterval)
+	}
+	return nil
+}
+
 // Execute peforms the actual CLI argument parsing and launches the wait operation.
 func Execute() error {
-	var (
-		waitTimeout     time.Duration
-		defaultPollFreq time.Duration
-		isQuiet         bool
+	var cfg config
+
+	root := newCommand(&cfg, modeTCP, name+" [FLAGS] ADDRESS[,ADDRESS...]...", desc)
+	root.Version = wait.Version().String()
+	addSharedFlags(root, &cfg)
+	// So that the shared flags are listed before the TCP flags in the help of the root command.
+	root.Flags().AddFlagSet(root.PersistentFlags())
+	addTCPFlags(root, &cfg)
+
+	tcpCmd := newCommand(&cfg, modeTCP, "tcp [FLAGS] ADDRESS[,ADDRESS...]...", desc)
+	addTCPFlags(tcpCmd, &cfg)
 
-		ver = fmt.Sprintf("%s (build time: %s, commit: %s)", version, buildTime, gitCommit)
+	httpCmd := newCommand(
+		&cfg,
+		modeHTTP,
+		"http [FLAGS] URL[,URL...]...",
+		"Wait until HTTP server(s) respond with an accepted status code",
 	)
+	addHTTPFlags(httpCmd, &cfg)
 
+	anyCmd := newCommand(
+		&cfg,
+		modeAny,
+		"any [FLAGS] ADDRESS[,ADDRESS...]...",
+		"Wait until HTTP(S) URLs respond, files appear, and other servers accept connections",
+	)
+	addTCPFlags(anyCmd, &cfg)
+	addHTTPFlags(anyCmd, &cfg)
+
+	root.AddCommand(tcpCmd, httpCmd, anyCmd)
+
+	if err := root.Execute(); err != nil {
+		if cfg.isSilent {
+			// Even errors of command line usage are not shown.
+			os.Exit(exitParseError) // nolint: revive
+		}
+		return err
+	}
+	return nil
+}
+
+// newCommand creates a command that waits for targets of the given mode, parsing its command line
+// options into the given config.
+func newCommand(cfg *config, m mode, use, short string) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:                   name + " [FLAGS] ADDRESS...",
-		Short:                 desc,
-		Version:               ver,
+		Use:                   use,
+		Short:                 short,
 		DisableFlagsInUseLine: true,
 		SilenceErrors:         true,
 
 		Args: func(cmd *cobra.Command, args []string) error {
-			if len(args) < 1 {
-				return fmt.Errorf("at least one address must be specified")
+			cmd.SilenceUsage = cfg.isSilent
+			if len(args) > 0 {
+				return nil
+			}
+			if m == modeHTTP {
+				return fmt.Errorf("at least one URL must be specified")
+			}
+			if cfg.fromEnv == "" {
+				return fmt.Errorf("at least one address or --from-env must be specified")
 			}
 			return nil
 		},
 
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = cfg.isSilent
+			if !cfg.noConfig {
+				if err := loadRC(cmd, rcPaths()); err != nil {
+					return err
+				}
+			}
+			cfg.mode = m
+			// A timeout from the defaults file counts as given, just like one on the command line.
+			cfg.isTimeoutSet = cmd.Flags().Changed("timeout")
+			return cfg.validate()
+		},
+
 		Run: func(cmd *cobra.Command, args []string) {
 			var rawAddrs []string
 			if dashIdx := cmd.ArgsLenAtDash(); dashIdx == -1 {
@@ -58,78 +430,1308 @@ func Execute() error {
 			} else {
 				rawAddrs = args[:dashIdx]
 			}
-			exitCode := run(rawAddrs, waitTimeout, defaultPollFreq, isQuiet)
-			if exitCode != 0 {
-				os.Exit(exitCode) // nolint: revive
+			if code := run(rawAddrs, cfg).exitCode(); code != exitOK {
+				os.Exit(code) // nolint: revive
 			}
 		},
 	}
+	cmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		cmd.SilenceUsage = cfg.isSilent
+		return err
+	})
+	cmd.Flags().SortFlags = false
 
-	flagSet := cmd.Flags()
+	return cmd
+}
+
+// addSharedFlags adds the command line options of all modes as persistent flags of the given
+// command.
+func addSharedFlags(cmd *cobra.Command, cfg *config) {
+	flagSet := cmd.PersistentFlags()
 	flagSet.SortFlags = false
-	flagSet.DurationVarP(&waitTimeout, "timeout", "t", 5*time.Second, "set wait timeout")
 	flagSet.DurationVarP(
-		&defaultPollFreq,
+		&cfg.waitTimeout,
+		"timeout",
+		"t",
+		5*time.Second,
+		"set wait timeout, or 0 to wait without a timeout",
+	)
+	flagSet.StringVar(
+		&cfg.deadline,
+		"deadline",
+		"",
+		"give up at RFC3339 `TIME` or after duration, or at --timeout if sooner",
+	)
+	flagSet.IntVar(
+		&cfg.rounds,
+		"rounds",
+		1,
+		"run the whole wait up to `N` times, starting again with a new timeout after failures",
+	)
+	flagSet.DurationVar(&cfg.roundInterval, "round-interval", 30*time.Second, "sleep between rounds")
+	flagSet.DurationVarP(
+		&cfg.defaultPollFreq,
 		"poll-freq",
 		"f",
 		500*time.Millisecond,
 		"set connection poll frequency",
 	)
-	flagSet.BoolVarP(&isQuiet, "quiet", "q", false, "suppress waiting messages")
+	flagSet.Float64Var(
+		&cfg.jitter,
+		"jitter",
+		0,
+		"randomly vary poll intervals by up to this fraction of the poll frequency",
+	)
+	flagSet.Int64Var(
+		&cfg.jitterSeed,
+		"poll-jitter-seed",
+		0,
+		"seed poll interval jitters with this non-zero value, to make them reproducible",
+	)
+	flagSet.BoolVar(
+		&cfg.noImmediateCheck,
+		"no-immediate-check",
+		false,
+		"make the first attempt on each target after one poll interval instead of right away",
+	)
+	flagSet.BoolVar(
+		&cfg.retryOnError,
+		"retry-on-error",
+		false,
+		"retry all connection errors until timeout",
+	)
+	flagSet.BoolVar(
+		&cfg.once,
+		"once",
+		false,
+		"check each target only once and exit without waiting",
+	)
+	flagSet.BoolVar(
+		&cfg.expectUnreachable,
+		"expect-unreachable",
+		false,
+		"fail as soon as any target is ready, and succeed if none is before the timeout",
+	)
+	flagSet.IntVar(
+		&cfg.attempts,
+		"attempts",
+		0,
+		"give up on each target after `N` attempts, and time out after N times --poll-freq if "+
+			"--timeout is not set",
+	)
+	flagSet.BoolVar(
+		&cfg.failOnNXDomain,
+		"fail-on-nxdomain",
+		false,
+		"fail targets whose host names do not exist, even with --retry-on-error",
+	)
+	flagSet.DurationVar(
+		&cfg.tcpKeepAlive,
+		"keepalive",
+		0,
+		"send TCP keep-alive probes on open connections every duration, or never if negative",
+	)
+	flagSet.BoolVar(
+		&cfg.expandEnv,
+		"expand-env",
+		false,
+		"replace ${VAR} and $VAR in addresses with environment variable values",
+	)
+	flagSet.BoolVar(
+		&cfg.allowUnsetEnv,
+		"allow-unset-env",
+		false,
+		"expand unset environment variables to empty strings instead of failing",
+	)
+	flagSet.BoolVar(
+		&cfg.skipInvalid,
+		"skip-invalid",
+		false,
+		"skip addresses that can not be parsed with a warning instead of failing",
+	)
+	flagSet.BoolVar(
+		&cfg.execShell,
+		"exec-shell",
+		false,
+		"run exec:// commands with the shell instead of directly (trusted commands only)",
+	)
+	flagSet.BoolVar(
+		&cfg.showSummary,
+		"summary",
+		false,
+		"show table of results and total attempts at the end",
+	)
+	flagSet.BoolVar(
+		&cfg.count,
+		"count",
+		false,
+		"wait until all targets finish and only show how many are ready, e.g. \"12/15 ready\"",
+	)
+	flagSet.StringVar(
+		&cfg.reportPath,
+		"report",
+		"",
+		"write final results as JSON to `FILE`",
+	)
+	flagSet.StringVar(
+		&cfg.format,
+		"format",
+		"",
+		"show messages with Go `TEMPLATE` using .Status, .Target, .Elapsed, .Err, and .Attempts",
+	)
+	flagSet.StringArrayVar(
+		&cfg.priorities,
+		"priority",
+		nil,
+		"show `TARGET` ahead of other targets and tag its messages (repeatable)",
+	)
+	flagSet.StringVar(
+		&cfg.selfHealth,
+		"self-health",
+		"",
+		"serve the status of all targets as JSON on `ADDR` (e.g. :8081) while waiting",
+	)
+	flagSet.StringVar(
+		&cfg.eventsSocket,
+		"events-socket",
+		"",
+		"stream messages as JSON lines to clients of Unix socket `PATH` while waiting",
+	)
+	flagSet.StringVar(
+		&cfg.logFile,
+		"log-file",
+		"",
+		"write all messages and connection attempts as JSON lines to `PATH`",
+	)
+	flagSet.StringVar(
+		&cfg.logMaxSize,
+		"log-max-size",
+		"",
+		"rotate the log file to PATH.1 once it exceeds `SIZE` (e.g. 10MB)",
+	)
+	flagSet.DurationVar(
+		&cfg.warnSlowerThan,
+		"warn-slower-than",
+		0,
+		"warn about targets that take longer than `DURATION` to be ready, without failing",
+	)
+	flagSet.StringVar(
+		&cfg.onReadyExec,
+		"on-ready-exec",
+		"",
+		"run `COMMAND` for each target once ready, with templates as in --format in its arguments",
+	)
+	flagSet.StringVar(
+		&cfg.timeUnit,
+		"time-unit",
+		"auto",
+		"show elapsed times in ns, ms, or s instead of picking the unit automatically",
+	)
+	flagSet.BoolVar(&cfg.isVerbose, "verbose", false, "show every connection attempt")
+	flagSet.BoolVar(
+		&cfg.isQuietReady,
+		"quiet-ready",
+		false,
+		"suppress waiting messages except failures and the final line",
+	)
+	flagSet.BoolVarP(&cfg.isQuiet, "quiet", "q", false, "suppress all messages")
+	flagSet.BoolVar(&cfg.isSilent, "silent", false, "suppress all output, including errors")
+	flagSet.BoolVar(
+		&cfg.noConfig,
+		"no-config",
+		false,
+		"ignore defaults in ./"+rcFileName+" or the user configuration directory",
+	)
+}
 
-	return cmd.Execute()
+// addTCPFlags adds the command line options for waiting on TCP servers to the given command.
+func addTCPFlags(cmd *cobra.Command, cfg *config) {
+	flagSet := cmd.Flags()
+	flagSet.StringVar(
+		&cfg.proxy,
+		"proxy",
+		"",
+		"connect through proxy URL (default from ALL_PROXY or HTTP_PROXY, except NO_PROXY hosts)",
+	)
+	flagSet.StringVar(
+		&cfg.family,
+		"family",
+		"tcp",
+		"restrict connections to IPv4 (tcp4) or IPv6 (tcp6)",
+	)
+	flagSet.StringVar(
+		&cfg.resolver,
+		"resolver",
+		"",
+		"resolve host names with DNS server at `HOST[:PORT]`",
+	)
+	flagSet.StringVar(&cfg.bind, "bind", "", "connect from local IP address")
+	flagSet.StringVar(
+		&cfg.netns,
+		"netns",
+		"",
+		"connect from within network namespace at `PATH` (Linux only, requires CAP_SYS_ADMIN)",
+	)
+	flagSet.StringVar(
+		&cfg.proxyProtocol,
+		"proxy-protocol",
+		"",
+		"send PROXY protocol header of `VERSION` (v1 or v2) upon connection",
+	)
+	flagSet.StringVar(&cfg.send, "send", "", "send payload to server upon connection")
+	flagSet.StringVar(
+		&cfg.expectBanner,
+		"expect-banner",
+		"",
+		"require server banner or response to --send to match regular expression",
+	)
+	flagSet.IntVar(
+		&cfg.readBytes,
+		"read-bytes",
+		512,
+		"read at most `N` bytes of server banners or responses for matching",
+	)
+	flagSet.DurationVar(
+		&cfg.readTimeout,
+		"read-timeout",
+		0,
+		"wait for server banners or responses for `duration`, or the poll frequency if 0",
+	)
+	flagSet.StringArrayVar(
+		&cfg.strictTargets,
+		"strict",
+		nil,
+		"fail `TARGET` as soon as it refuses a connection instead of waiting for it (repeatable)",
+	)
+	flagSet.StringVar(
+		&cfg.tcpMode,
+		"mode",
+		tcpModeConnect,
+		"check servers by `MODE`: connect, or service-answer to require data within the poll frequency",
+	)
+	flagSet.DurationVar(
+		&cfg.hold,
+		"hold",
+		0,
+		"keep connections open for duration and require servers not to close them",
+	)
+	flagSet.BoolVar(
+		&cfg.firstReadyWins,
+		"first-ready-wins",
+		false,
+		"group targets by name and only wait until one target of each group is ready",
+	)
+	flagSet.BoolVar(
+		&cfg.dedup,
+		"dedup",
+		false,
+		"wait only once for identical addresses, using the smallest poll frequency",
+	)
+	flagSet.IntVar(
+		&cfg.maxCIDRHosts,
+		"max-cidr-hosts",
+		wait.DefaultMaxCIDRHosts,
+		"set maximum number of hosts a cidr:PREFIX:PORT address may expand to",
+	)
+	flagSet.StringVar(
+		&cfg.fromEnv,
+		"from-env",
+		"",
+		"also wait for tcp:// addresses in environment variables starting with `PREFIX`",
+	)
+	flagSet.StringArrayVar(
+		&cfg.schemePorts,
+		"scheme-port",
+		nil,
+		"set default port of scheme as NAME=PORT (repeatable)",
+	)
+	flagSet.StringArrayVar(
+		&cfg.schemePollFreqs,
+		"scheme-poll-freq",
+		nil,
+		"set default poll frequency of scheme as NAME=FREQ (repeatable)",
+	)
 }
 
-// run calls the actual function for waiting.
-func run(
-	rawAddrs []string,
-	waitTimeout, defaultPollFreq time.Duration,
-	isQuiet bool,
-) int {
+// addHTTPFlags adds the command line options for waiting on HTTP servers to the given command.
+func addHTTPFlags(cmd *cobra.Command, cfg *config) {
+	flagSet := cmd.Flags()
+	flagSet.BoolVar(
+		&cfg.noProxy,
+		"no-proxy",
+		false,
+		"send HTTP requests directly, ignoring HTTP_PROXY, HTTPS_PROXY, and NO_PROXY",
+	)
+	flagSet.BoolVar(
+		&cfg.httpKeepAlive,
+		"http-keepalive",
+		false,
+		"reuse connections across HTTP requests instead of making a new one per request",
+	)
+	flagSet.StringVar(
+		&cfg.httpStatus,
+		"http-status",
+		"200-399",
+		"accept HTTP response status `CODES`, given as codes and ranges, e.g. 200,204,301-399",
+	)
+	flagSet.StringVar(
+		&cfg.expectBody,
+		"expect-body",
+		"",
+		"require HTTP response body to match regular expression",
+	)
+	flagSet.StringVar(&cfg.httpMethod, "http-method", http.MethodGet, "set HTTP request method")
+	flagSet.StringArrayVar(
+		&cfg.httpHeaders,
+		"http-header",
+		nil,
+		"send HTTP header given as \"KEY: VALUE\" (repeatable)",
+	)
+	flagSet.StringArrayVar(
+		&cfg.tlsPins,
+		"tls-pin",
+		nil,
+		"trust HTTPS servers only with certificate of SHA-256 fingerprint (repeatable)",
+	)
+	flagSet.BoolVar(
+		&cfg.tlsPinStrict,
+		"tls-pin-strict",
+		false,
+		"fail HTTPS servers presenting certificates that are not pinned instead of polling again",
+	)
+}
 
-	specs, err := wait.ParseTCPSpecs(rawAddrs, defaultPollFreq)
+// run calls the actual function for waiting. It returns the result of the wait operation, from
+// which the exit code is derived.
+func run(rawAddrs []string, cfg *config) *result {
+	var (
+		quiet   = cfg.isQuiet || cfg.isSilent || cfg.count
+		showErr = func(format string, a ...interface{}) {
+			if !cfg.isSilent {
+				fmt.Printf("%7s: %s\n", "ERROR", fmt.Sprintf(format, a...))
+			}
+		}
+	)
+
+	waitTimeout, err := cfg.resolveTimeout(time.Now())
 	if err != nil {
-		fmt.Printf("%7s: %s\n", "ERROR", err)
-		return 1
+		showErr("%s", err)
+		return &result{err: err, isParseErr: true}
+	}
+
+	set, err := parseSpecs(rawAddrs, cfg)
+	if err != nil {
+		showErr("%s", err)
+		return &result{err: err, isParseErr: true}
+	}
+	if !quiet {
+		for _, warning := range set.skipped {
+			fmt.Printf("%7s: %s\n", "WARNING", warning)
+		}
+	}
+	if warning := tlsWarning(set.tcp); warning != "" && !quiet {
+		fmt.Printf("%7s: %s\n", "WARNING", warning)
+	}
+	if !quiet {
+		for _, warning := range endpointWarnings(set.tcp, set.http) {
+			fmt.Printf("%7s: %s\n", "WARNING", warning)
+		}
+	}
+
+	priorities := set.priorities()
+
+	var logMaxSize int64
+	if cfg.logMaxSize != "" {
+		if logMaxSize, err = parseByteSize(cfg.logMaxSize); err != nil {
+			showErr("%s", err)
+			return &result{err: err, isParseErr: true}
+		}
+	}
+
+	var tmpl *template.Template
+	if cfg.format != "" {
+		if tmpl, err = parseFormat(cfg.format); err != nil {
+			showErr("%s", err)
+			return &result{err: err, isParseErr: true}
+		}
+	}
+
+	if cfg.timeUnit != "" {
+		if _, err := parseTimeUnit(cfg.timeUnit); err != nil {
+			showErr("%s", err)
+			return &result{err: err, isParseErr: true}
+		}
+	}
+
+	var hook *readyHook
+	if cfg.onReadyExec != "" {
+		if hook, err = parseReadyHook(cfg.onReadyExec); err != nil {
+			showErr("%s", err)
+			return &result{err: err, isParseErr: true}
+		}
+		hook.unit = cfg.timeUnit
+		if cfg.isSilent {
+			hook.stdout, hook.stderr = io.Discard, io.Discard
+		}
+		if !quiet {
+			hook.logf = func(format string, a ...interface{}) {
+				fmt.Printf("%7s: %s\n", "WARNING", fmt.Sprintf(format, a...))
+			}
+		}
 	}
 
 	var (
-		msg       wait.Message
 		showMsg   = func(wait.Message) {}
-		showFinal = func(wait.Message) {}
+		showFinal = func(*summary) {}
 	)
-	if !isQuiet {
+	if !quiet {
 		showMsg = func(msg wait.Message) {
-			var disp string
+			if cfg.isQuietReady && msg.Status() != wait.Failed {
+				return
+			}
+
+			if tmpl != nil {
+				disp, err := fmtMessage(tmpl, msg, cfg.timeUnit)
+				if err != nil {
+					disp = fmt.Sprintf("%7s: %s", "ERROR", err)
+				}
+				fmt.Println(disp)
+				return
+			}
+
+			var (
+				disp   string
+				target = tagPriority(msg.Target(), priorities)
+			)
 
 			switch msg.Status() {
 			case wait.Start:
-				disp = fmt.Sprintf("%7s: %s for %s", "waiting", msg.Target(), waitTimeout)
+				if cfg.once {
+					return
+				}
+				if waitTimeout == wait.NoTimeout {
+					disp = fmt.Sprintf("%7s: %s without timeout", "waiting", target)
+				} else {
+					disp = fmt.Sprintf("%7s: %s for %s", "waiting", target, waitTimeout)
+				}
 			case wait.Ready:
 				disp = fmt.Sprintf(
-					"%7s: %s in %s",
+					"%7s: %s in %s%s%s",
 					wait.Ready,
-					msg.Target(),
-					fmtElapsedTime(msg.ElapsedTime()),
+					target,
+					fmtElapsedTime(msg.ElapsedTime(), cfg.timeUnit),
+					fmtConnectLatency(msg, cfg.timeUnit),
+					fmtDetails(msg.Details()),
 				)
 			case wait.Failed:
-				disp = fmt.Sprintf("%7s: %s", wait.Failed, msg.Err())
+				disp = fmt.Sprintf("%7s: %s: %s", wait.Failed, target, msg.Err())
+				if pending := msg.PendingTargets(); len(pending) > 0 {
+					pending = sortByPriority(pending, priorities)
+					disp += fmt.Sprintf("\n%7s: %s", "pending", strings.Join(pending, ", "))
+				}
 			}
 
 			fmt.Println(disp)
 		}
-		showFinal = func(msg wait.Message) {
-			fmt.Printf("%7s: all ready in %s\n", "OK", fmtElapsedTime(msg.ElapsedTime()))
+		showFinal = func(sum *summary) {
+			if tmpl != nil {
+				return
+			}
+			if cfg.expectUnreachable {
+				fmt.Printf(
+					"%7s: none reachable in %s\n",
+					"OK",
+					fmtElapsedTime(sum.elapsed, cfg.timeUnit),
+				)
+				return
+			}
+			if sum.allAlreadyReady() {
+				fmt.Printf("%7s: all targets already ready\n", "OK")
+				return
+			}
+			fmt.Printf("%7s: all ready in %s\n", "OK", fmtElapsedTime(sum.elapsed, cfg.timeUnit))
+		}
+	}
+
+	// Only messages of the targets themselves are checked for slowness and run the hook, not those
+	// of groups or of the whole wait operation.
+	isTarget := make(map[string]bool)
+	for _, target := range set.targets() {
+		isTarget[target] = true
+	}
+	if cfg.warnSlowerThan > 0 && !quiet {
+		show := showMsg
+		showMsg = func(msg wait.Message) {
+			show(msg)
+			if isTarget[msg.Target()] && isSlow(msg.Status(), msg.ElapsedTime(), cfg.warnSlowerThan) {
+				fmt.Printf(
+					"%7s: %s was ready in %s, slower than %s\n",
+					"WARNING",
+					msg.Target(),
+					fmtElapsedTime(msg.ElapsedTime(), cfg.timeUnit),
+					cfg.warnSlowerThan,
+				)
+			}
+		}
+	}
+	if hook != nil {
+		show := showMsg
+		showMsg = func(msg wait.Message) {
+			show(msg)
+			if msg.Status() == wait.Ready && isTarget[msg.Target()] {
+				hook.start(msg)
+			}
+		}
+	}
+
+	var health *selfHealth
+	if cfg.selfHealth != "" {
+		health = newSelfHealth(set.targets())
+		if err := health.listen(cfg.selfHealth); err != nil {
+			showErr("can not serve health endpoint: %s", err)
+			return &result{err: err}
+		}
+		defer health.shutdown()
+		show := showMsg
+		showMsg = func(msg wait.Message) {
+			show(msg)
+			health.add(msg)
+		}
+	}
+
+	if cfg.logFile != "" {
+		evLog, err := openEventLog(cfg.logFile, logMaxSize)
+		if err != nil {
+			showErr("can not open log file: %s", err)
+			return &result{err: err}
+		}
+		defer evLog.close()
+		set.addObserver(evLog)
+		show := showMsg
+		showMsg = func(msg wait.Message) {
+			show(msg)
+			evLog.message(msg)
+		}
+	}
+
+	if cfg.eventsSocket != "" {
+		events, err := listenEvents(cfg.eventsSocket)
+		if err != nil {
+			showErr("can not serve events: %s", err)
+			return &result{err: err}
+		}
+		defer events.close()
+		show := showMsg
+		showMsg = func(msg wait.Message) {
+			show(msg)
+			events.send(msg)
+		}
+	}
+
+	res := &result{}
+	// Rounds after the first are only run if the previous one failed, each with a fresh timeout
+	// limit that still respects the deadline.
+	for round := 1; ; round++ {
+		res.summary = newSummary(sortByPriority(set.targets(), priorities))
+		res.summary.unit = cfg.timeUnit
+		res.summary.slowAfter = cfg.warnSlowerThan
+		if health != nil {
+			health.reset(res.summary)
+		}
+		res.err = runRound(set, cfg, waitTimeout, showMsg, showFinal, res.summary)
+		if res.err == nil || round >= cfg.rounds {
+			break
+		}
+		if !quiet {
+			fmt.Printf("%7s: %d of %d in %s\n", "round", round+1, cfg.rounds, cfg.roundInterval)
+		}
+		time.Sleep(cfg.roundInterval)
+		if waitTimeout, err = cfg.resolveTimeout(time.Now()); err != nil || waitTimeout == minTimeout {
+			break
+		}
+	}
+	// All errors of the rounds are about ready targets in this case, and they are shown explicitly
+	// since the messages of those targets do not look like failures.
+	if cfg.expectUnreachable && res.err != nil && !quiet {
+		fmt.Printf("%7s: %s\n", wait.Failed, res.err)
+	}
+	if hook != nil {
+		hook.wait()
+	}
+	if health != nil {
+		health.finish(res.err, res.timedOut())
+	}
+	if cfg.showSummary && !cfg.isSilent {
+		res.summary.write(os.Stdout, res.timedOut())
+	}
+	if cfg.count {
+		ready, total := res.summary.readyCount()
+		fmt.Printf("%d/%d ready\n", ready, total)
+	}
+	if cfg.reportPath != "" {
+		err := writeReportFile(cfg.reportPath, res.summary, res.err, res.timedOut())
+		if err != nil {
+			showErr("can not write report: %s", err)
+			if res.err == nil {
+				res.err = fmt.Errorf("can not write report: %w", err)
+			}
 		}
 	}
 
-	for msg = range wait.AllTCP(specs, waitTimeout) {
+	return res
+}
+
+// runRound runs a single round of the wait operation on the given specifications, showing and
+// summarizing its messages. It returns the error that ended the round, if any.
+func runRound(
+	set *specSet,
+	cfg *config,
+	waitTimeout time.Duration,
+	showMsg func(wait.Message),
+	showFinal func(*summary),
+	sum *summary,
+) error {
+	var waitErr error
+
+	// Forwarding stops only once the round ends, so that no final message is lost when the HTTP
+	// and file wait operations time out.
+	fwdCtx, fwdCancel := context.WithCancel(context.Background())
+	defer fwdCancel()
+	var (
+		singleCtx    context.Context
+		singleCancel context.CancelFunc
+	)
+	if waitTimeout == wait.NoTimeout {
+		singleCtx, singleCancel = context.WithCancel(fwdCtx)
+	} else {
+		singleCtx, singleCancel = context.WithTimeout(fwdCtx, waitTimeout)
+	}
+	defer singleCancel()
+
+	// TCP wait operations time out on their own, so they are only stopped once the round ends,
+	// e.g. at its first failure, and not by the timeout of the other wait operations. Cancelling
+	// fwdCtx then leaves none running during the next round.
+	var tcpMsgs <-chan *wait.TCPMessage
+	if cfg.firstReadyWins {
+		tcpMsgs = wait.GroupTCPContext(fwdCtx, groupSpecs(set.tcp), waitTimeout)
+	} else {
+		tcpMsgs = wait.AllTCPContext(fwdCtx, set.tcp, waitTimeout)
+	}
+	chs := []<-chan wait.Message{asMessages(fwdCtx, tcpMsgs)}
+	for _, spec := range set.http {
+		chs = append(chs, asMessages(fwdCtx, wait.SingleHTTP(singleCtx, spec)))
+	}
+	for _, spec := range set.file {
+		chs = append(chs, asMessages(fwdCtx, wait.SingleFile(singleCtx, spec)))
+	}
+	for _, spec := range set.exec {
+		chs = append(chs, asMessages(fwdCtx, wait.SingleExec(singleCtx, spec)))
+	}
+
+	for msg := range mergeMessages(fwdCtx, chs...) {
 		showMsg(msg)
-		if err := msg.Err(); err != nil {
-			return 1
+		sum.add(msg)
+		// Failures are the expected outcome of targets that must not be reachable, so only ready
+		// targets end the round.
+		if cfg.expectUnreachable {
+			if msg.Status() == wait.Ready {
+				waitErr = fmt.Errorf("%s is reachable", msg.Target())
+				break
+			}
+			continue
+		}
+		if err := msg.Err(); err != nil && waitErr == nil {
+			waitErr = err
+			// Counting needs the final status of every target, not only of the first failed one.
+			if !cfg.count {
+				break
+			}
+		}
+	}
+	if waitErr == nil {
+		showFinal(sum)
+	}
+
+	return waitErr
+}
+
+// specSet is the container for the wait specifications of all targets, by kind.
+type specSet struct {
+	tcp  []*wait.TCPSpec
+	http []*wait.HTTPSpec
+	file []*wait.FileSpec
+	exec []*wait.ExecSpec
+	// skipped are the warnings for the addresses that were skipped because they can not be parsed.
+	skipped []string
+}
+
+// setPollTiming sets when the HTTP, file, and command specifications are checked according to the
+// given command line options, as configureTCPSpecs does for the TCP specifications.
+func (set *specSet) setPollTiming(cfg *config) {
+	// Jitter seeds are numbered across all targets, continuing after the TCP specifications.
+	i := len(set.tcp)
+	for _, spec := range set.http {
+		spec.Jitter = cfg.jitter
+		spec.JitterRand = newJitterRand(cfg, i)
+		spec.SkipImmediateCheck = cfg.noImmediateCheck
+		i++
+	}
+	for _, spec := range set.file {
+		spec.Jitter = cfg.jitter
+		spec.JitterRand = newJitterRand(cfg, i)
+		spec.SkipImmediateCheck = cfg.noImmediateCheck
+		i++
+	}
+	for _, spec := range set.exec {
+		spec.Jitter = cfg.jitter
+		spec.JitterRand = newJitterRand(cfg, i)
+		spec.SkipImmediateCheck = cfg.noImmediateCheck
+		i++
+	}
+}
+
+// newJitterRand returns the jitter random number generator of the i-th target, seeded from the
+// given command line options. Each target has its own sequence, so its intervals do not depend on
+// the others. It returns nil if no seed is given.
+func newJitterRand(cfg *config, i int) *rand.Rand {
+	if cfg.jitterSeed == 0 {
+		return nil
+	}
+	return rand.New(rand.NewSource(cfg.jitterSeed + int64(i))) // nolint: gosec
+}
+
+// priorities returns the priorities of the targets of all specifications, keyed by target. Targets
+// without priority are left out.
+func (set *specSet) priorities() map[string]int {
+	priorities := make(map[string]int)
+	for _, spec := range set.tcp {
+		if spec.Priority != 0 {
+			priorities[spec.Target()] = spec.Priority
 		}
 	}
-	showFinal(msg)
+	for _, spec := range set.http {
+		if spec.Priority != 0 {
+			priorities[spec.Target()] = spec.Priority
+		}
+	}
+	for _, spec := range set.file {
+		if spec.Priority != 0 {
+			priorities[spec.Target()] = spec.Priority
+		}
+	}
+	for _, spec := range set.exec {
+		if spec.Priority != 0 {
+			priorities[spec.Target()] = spec.Priority
+		}
+	}
+	return priorities
+}
 
-	return 0
+// prioritize gives priority to the specifications of the given targets. All of the given targets
+// must be targets of the specifications.
+func (set *specSet) prioritize(targets []string) error {
+	isPriority := make(map[string]bool, len(targets))
+	for _, target := range targets {
+		isPriority[target] = true
+	}
+	for _, spec := range set.tcp {
+		if isPriority[spec.Target()] {
+			spec.Priority = 1
+		}
+	}
+	for _, spec := range set.http {
+		if isPriority[spec.Target()] {
+			spec.Priority = 1
+		}
+	}
+	for _, spec := range set.file {
+		if isPriority[spec.Target()] {
+			spec.Priority = 1
+		}
+	}
+	for _, spec := range set.exec {
+		if isPriority[spec.Target()] {
+			spec.Priority = 1
+		}
+	}
+
+	known := set.priorities()
+	for _, target := range targets {
+		if known[target] == 0 {
+			return fmt.Errorf("priority target is not waited: %q", target)
+		}
+	}
+	return nil
+}
+
+// setStrict makes the TCP specifications of the given targets fail as soon as their connections
+// are refused. All of the given targets must be TCP targets of the specifications.
+func (set *specSet) setStrict(targets []string) error {
+	isStrict := make(map[string]bool, len(targets))
+	for _, target := range targets {
+		isStrict[target] = true
+	}
+	known := make(map[string]bool, len(set.tcp))
+	for _, spec := range set.tcp {
+		known[spec.Target()] = true
+		if isStrict[spec.Target()] {
+			spec.Strict = true
+		}
+	}
+	for _, target := range targets {
+		if !known[target] {
+			return fmt.Errorf("strict target is not a waited TCP target: %q", target)
+		}
+	}
+	return nil
+}
+
+// targets returns the targets of all specifications, TCP first, then HTTP, then files, then
+// commands.
+func (set *specSet) targets() []string {
+	targets := make([]string, 0, len(set.tcp)+len(set.http)+len(set.file)+len(set.exec))
+	for _, spec := range set.tcp {
+		targets = append(targets, spec.Target())
+	}
+	for _, spec := range set.http {
+		targets = append(targets, spec.Target())
+	}
+	for _, spec := range set.file {
+		targets = append(targets, spec.Target())
+	}
+	for _, spec := range set.exec {
+		targets = append(targets, spec.Target())
+	}
+	return targets
+}
+
+// addObserver makes the given observer receive the connection attempts of all TCP and HTTP
+// specifications, and the runs of all command specifications, in addition to any observer they
+// already have.
+func (set *specSet) addObserver(observer wait.AttemptObserver) {
+	join := func(existing wait.AttemptObserver) wait.AttemptObserver {
+		if existing == nil {
+			return observer
+		}
+		return wait.AttemptObserverFunc(func(attempt wait.Attempt) {
+			existing.ObserveAttempt(attempt)
+			observer.ObserveAttempt(attempt)
+		})
+	}
+	for _, spec := range set.tcp {
+		spec.Observer = join(spec.Observer)
+	}
+	for _, spec := range set.http {
+		spec.Observer = join(spec.Observer)
+	}
+	for _, spec := range set.exec {
+		spec.Observer = join(spec.Observer)
+	}
+}
+
+// parseSpecs parses the given addresses into wait specifications configured according to the
+// given command line options. Which kind of specification each address is parsed into depends on
+// the mode: HTTP mode only accepts HTTP URLs, TCP mode treats all addresses except `file://` and
+// `exec://` ones as TCP addresses, and any mode also treats HTTP URLs as such.
+func parseSpecs(rawAddrs []string, cfg *config) (*specSet, error) {
+	if cfg.defaultPollFreq <= 0 {
+		return nil, fmt.Errorf("--poll-freq must be positive, got: %s", cfg.defaultPollFreq)
+	}
+
+	if err := registerSchemePorts(cfg.schemePorts); err != nil {
+		return nil, err
+	}
+	if err := registerSchemePollFreqs(cfg.schemePollFreqs); err != nil {
+		return nil, err
+	}
+
+	if cfg.maxCIDRHosts != 0 {
+		if err := wait.SetMaxCIDRHosts(cfg.maxCIDRHosts); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.expandEnv {
+		expanded, err := expandAddrs(rawAddrs, os.LookupEnv, cfg.allowUnsetEnv)
+		if err != nil {
+			return nil, err
+		}
+		rawAddrs = expanded
+	}
+
+	addrs := splitAddrs(rawAddrs)
+	if cfg.fromEnv != "" {
+		found, err := envAddrs(cfg.fromEnv, os.Environ())
+		if err != nil {
+			return nil, err
+		}
+		if len(found) == 0 && len(addrs) == 0 {
+			return nil, fmt.Errorf("no addresses found in environment with prefix %q", cfg.fromEnv)
+		}
+		addrs = append(addrs, found...)
+	}
+
+	var (
+		set      specSet
+		tcpAddrs []string
+	)
+	// invalid returns the error of the given address that can not be parsed, or records a warning
+	// and returns nil if such addresses are skipped.
+	invalid := func(i int, addr string, err error) error {
+		if !cfg.skipInvalid {
+			return fmt.Errorf("address %d: %s", i, err)
+		}
+		set.skipped = append(set.skipped, fmt.Sprintf("skipped invalid address %q: %s", addr, err))
+		return nil
+	}
+	for i, addr := range addrs {
+		switch {
+		case cfg.mode == modeHTTP || (cfg.mode == modeAny && wait.IsHTTPAddr(addr)):
+			spec, err := wait.ParseHTTPSpec(addr, cfg.defaultPollFreq)
+			if err != nil {
+				if err := invalid(i, addr, err); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			set.http = append(set.http, spec)
+
+		case wait.IsFileAddr(addr):
+			spec, err := wait.ParseFileSpec(addr, cfg.defaultPollFreq)
+			if err != nil {
+				if err := invalid(i, addr, err); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			spec.Once = cfg.once
+			spec.MaxAttempts = cfg.attempts
+			set.file = append(set.file, spec)
+
+		case wait.IsExecAddr(addr):
+			spec, err := wait.ParseExecSpec(addr, cfg.defaultPollFreq)
+			if err != nil {
+				if err := invalid(i, addr, err); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			spec.Shell = cfg.execShell
+			spec.Once = cfg.once
+			spec.MaxAttempts = cfg.attempts
+			set.exec = append(set.exec, spec)
+
+		default:
+			// TCP addresses are parsed together below, so they are only checked here if invalid
+			// ones are to be skipped.
+			if cfg.skipInvalid {
+				if _, err := wait.ParseTCPSpecs([]string{addr}, cfg.defaultPollFreq); err != nil {
+					_ = invalid(i, addr, errors.Unwrap(err))
+					continue
+				}
+			}
+			tcpAddrs = append(tcpAddrs, addr)
+		}
+	}
+	if len(set.skipped) == len(addrs) && len(addrs) > 0 {
+		return nil, fmt.Errorf("no valid addresses: %s", strings.Join(set.skipped, ", "))
+	}
+
+	specs, err := wait.ParseTCPSpecs(tcpAddrs, cfg.defaultPollFreq)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.dedup {
+		specs = wait.DedupTCPSpecs(specs)
+	}
+	set.tcp = specs
+
+	observer := newAttemptObserver(cfg)
+	if len(set.tcp) > 0 {
+		if err := configureTCPSpecs(set.tcp, cfg, observer); err != nil {
+			return nil, err
+		}
+	}
+	set.setPollTiming(cfg)
+	if len(set.http) > 0 {
+		if err := configureHTTPSpecs(set.http, cfg, observer); err != nil {
+			return nil, err
+		}
+	}
+	if err := set.prioritize(cfg.priorities); err != nil {
+		return nil, err
+	}
+	if err := set.setStrict(cfg.strictTargets); err != nil {
+		return nil, err
+	}
+
+	return &set, nil
+}
+
+// newAttemptObserver creates the observer that shows every connection attempt if the verbose
+// option is set. Otherwise, it returns nil.
+func newAttemptObserver(cfg *config) wait.AttemptObserver {
+	if !cfg.isVerbose {
+		return nil
+	}
+	return wait.AttemptObserverFunc(func(attempt wait.Attempt) {
+		fmt.Println(fmtAttempt(attempt))
+	})
+}
+
+// configureHTTPSpecs sets the request options of the given HTTP specifications according to the
+// given command line options.
+func configureHTTPSpecs(specs []*wait.HTTPSpec, cfg *config, observer wait.AttemptObserver) error {
+	var (
+		method = http.MethodGet
+		expect *regexp.Regexp
+		err    error
+	)
+	if cfg.httpMethod != "" {
+		if method, err = parseMethod(cfg.httpMethod); err != nil {
+			return err
+		}
+	}
+
+	header, err := parseHeader(cfg.httpHeaders)
+	if err != nil {
+		return err
+	}
+
+	if cfg.expectBody != "" {
+		if expect, err = regexp.Compile(cfg.expectBody); err != nil {
+			return fmt.Errorf("invalid body pattern: %s", err)
+		}
+	}
+
+	var proxy *url.URL
+	if cfg.proxy != "" {
+		if proxy, err = wait.ParseProxyURL(cfg.proxy); err != nil {
+			return err
+		}
+	}
+
+	var statuses wait.StatusRanges
+	if cfg.httpStatus != "" {
+		if statuses, err = wait.ParseStatusRanges(cfg.httpStatus); err != nil {
+			return err
+		}
+	}
+
+	var pins []wait.TLSPin
+	for _, rawPin := range cfg.tlsPins {
+		pin, err := wait.ParseTLSPin(rawPin)
+		if err != nil {
+			return err
+		}
+		pins = append(pins, pin)
+	}
+
+	for _, spec := range specs {
+		spec.Proxy = proxy
+		spec.NoProxy = cfg.noProxy
+		spec.KeepAlive = cfg.httpKeepAlive
+		spec.TCPKeepAlive = cfg.tcpKeepAlive
+		spec.RetryOnError = cfg.retryOnError
+		spec.Once = cfg.once
+		spec.MaxAttempts = cfg.attempts
+		spec.FailOnNXDomain = cfg.failOnNXDomain
+		spec.Method = method
+		spec.Header = header
+		spec.ReadyStatuses = statuses
+		spec.ExpectBody = expect
+		spec.TLSPins = pins
+		spec.TLSPinStrict = cfg.tlsPinStrict
+		spec.Observer = observer
+	}
+
+	return nil
+}
+
+// configureTCPSpecs sets the connection options of the given TCP specifications according to the
+// given command line options.
+func configureTCPSpecs(specs []*wait.TCPSpec, cfg *config, observer wait.AttemptObserver) error {
+	var err error
+	var network string
+	if cfg.family != "" {
+		if network, err = wait.ParseNetwork(cfg.family); err != nil {
+			return err
+		}
+	}
+
+	var resolver *net.Resolver
+	if cfg.resolver != "" {
+		if resolver, err = wait.NewResolver(cfg.resolver); err != nil {
+			return err
+		}
+	}
+
+	var localAddr *net.TCPAddr
+	if cfg.bind != "" {
+		if localAddr, err = wait.ParseBindAddr(cfg.bind); err != nil {
+			return err
+		}
+	}
+
+	if cfg.netns != "" {
+		if err := wait.CheckNetNS(cfg.netns); err != nil {
+			return err
+		}
+	}
+
+	if cfg.hold < 0 {
+		return fmt.Errorf("--hold must not be negative, got: %s", cfg.hold)
+	}
+	if cfg.readBytes < 0 {
+		return fmt.Errorf("--read-bytes must not be negative, got: %d", cfg.readBytes)
+	}
+	if cfg.readTimeout < 0 {
+		return fmt.Errorf("--read-timeout must not be negative, got: %s", cfg.readTimeout)
+	}
+
+	var proxyProtocol int
+	if cfg.proxyProtocol != "" {
+		if proxyProtocol, err = wait.ParseProxyProtocol(cfg.proxyProtocol); err != nil {
+			return err
+		}
+	}
+
+	payload, err := unescape(cfg.send)
+	if err != nil {
+		return fmt.Errorf("invalid payload: %s", err)
+	}
+
+	var expect *regexp.Regexp
+	if cfg.expectBanner != "" {
+		if expect, err = regexp.Compile(cfg.expectBanner); err != nil {
+			return fmt.Errorf("invalid banner pattern: %s", err)
+		}
+	}
+	switch cfg.tcpMode {
+	case "", tcpModeConnect:
+	case tcpModeServiceAnswer:
+		// Any banner pattern is stricter than requiring some data.
+		if expect == nil {
+			expect = anyDataPattern
+		}
+	default:
+		return fmt.Errorf(
+			"invalid mode, want %s or %s, got: %q",
+			tcpModeConnect,
+			tcpModeServiceAnswer,
+			cfg.tcpMode,
+		)
+	}
+
+	for i, spec := range specs {
+		spec.Observer = observer
+		// Networks selected by the address scheme are more specific than the flag.
+		if spec.Network == "" {
+			spec.Network = network
+		}
+		if spec.Proxy, err = parseProxy(cfg.proxy, spec.Addr()); err != nil {
+			return err
+		}
+		spec.LocalAddr = localAddr
+		spec.NetNS = cfg.netns
+		spec.Resolver = resolver
+		spec.SkipImmediateCheck = cfg.noImmediateCheck
+		spec.Jitter = cfg.jitter
+		spec.JitterRand = newJitterRand(cfg, i)
+		spec.RetryOnError = cfg.retryOnError
+		spec.Once = cfg.once
+		spec.MaxAttempts = cfg.attempts
+		spec.FailOnNXDomain = cfg.failOnNXDomain
+		spec.TCPKeepAlive = cfg.tcpKeepAlive
+		spec.ProxyProtocol = proxyProtocol
+		spec.Payload = payload
+		spec.Expect = expect
+		spec.ReadBytes = cfg.readBytes
+		spec.ReadTimeout = cfg.readTimeout
+		spec.Hold = cfg.hold
+	}
+
+	return nil
+}
+
+// parseProxy parses the given raw proxy URL. If it is empty, the proxy URL for connections to the
+// given address is read from the environment instead.
+func parseProxy(rawURL, addr string) (*url.URL, error) {
+	if rawURL == "" {
+		return wait.ProxyFromEnvironment(addr)
+	}
+	return wait.ParseProxyURL(rawURL)
+}
+
+// registerSchemePorts registers the default port numbers of the given schemes, each given as
+// `<scheme>=<port>`, so that they are used when parsing addresses.
+func registerSchemePorts(rawSchemePorts []string) error {
+	for _, rawSchemePort := range rawSchemePorts {
+		scheme, port, found := strings.Cut(rawSchemePort, "=")
+		if !found {
+			return fmt.Errorf("invalid scheme port, want NAME=PORT: %q", rawSchemePort)
+		}
+		if err := wait.RegisterProtoPort(scheme, port); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registerSchemePollFreqs registers the default poll frequencies of the given schemes, each given
+// as `<scheme>=<freq>`, so that they are used when parsing addresses without their own poll
+// frequency. Poll frequencies are given as the string value of time.Duration.
+func registerSchemePollFreqs(rawSchemePollFreqs []string) error {
+	for _, rawSchemePollFreq := range rawSchemePollFreqs {
+		scheme, rawFreq, found := strings.Cut(rawSchemePollFreq, "=")
+		if !found {
+			return fmt.Errorf("invalid scheme poll frequency, want NAME=FREQ: %q", rawSchemePollFreq)
+		}
+		freq, err := time.ParseDuration(rawFreq)
+		if err != nil {
+			return fmt.Errorf("invalid poll frequency of scheme %q: %q", scheme, rawFreq)
+		}
+		if err := wait.RegisterProtoPollFreq(scheme, freq); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// result is the outcome of a whole wait operation, as returned by run.
+type result struct {
+	// summary holds the final result of each target and the total elapsed time of the last round.
+	// It is nil if waiting did not start.
+	summary *summary
+	// err is the error that ended the wait operation, or nil if all targets are ready.
+	err error
+	// isParseErr is whether err happened before waiting started, for example while parsing
+	// addresses.
+	isParseErr bool
+}
+
+// timedOut returns whether the wait operation ended because it exceeded its timeout limit.
+func (res *result) timedOut() bool {
+	return !res.isParseErr && res.err != nil && exitCode(res.err) == exitTimeout
+}
+
+// exitCode returns the exit code of the wait operation.
+func (res *result) exitCode() int {
+	switch {
+	case res.err == nil:
+		return exitOK
+	case res.isParseErr:
+		return exitParseError
+	default:
+		return exitCode(res.err)
+	}
+}
+
+// exitCode returns the exit code for the given wait operation error.
+func exitCode(err error) int {
+	var timeoutErr *wait.TimeoutError
+	if errors.As(err, &timeoutErr) || errors.Is(err, context.DeadlineExceeded) {
+		return exitTimeout
+	}
+	return exitFailure
 }
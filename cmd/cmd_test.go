@@ -4,16 +4,1470 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/bow/wf/wait"
 )
 
 func TestRun(t *testing.T) {
 	t.Parallel()
 
-	retCode := run([]string{"golang.org:443"}, 5*time.Second, 500*time.Millisecond, false)
+	retCode := run(
+		[]string{"golang.org:443"},
+		&config{waitTimeout: 5 * time.Second, defaultPollFreq: 500 * time.Millisecond},
+	).exitCode()
+
+	if retCode != exitOK {
+		t.Errorf("test failed - want exit code: %d, got: %d", exitOK, retCode)
+	}
+}
+
+func TestRunNoProxy(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("test failed - can not listen: %s", err)
+	}
+	defer listener.Close()
+
+	t.Setenv("ALL_PROXY", "")
+	t.Setenv("all_proxy", "")
+	// Nothing listens on the proxy address, so connections through it would fail.
+	t.Setenv("HTTP_PROXY", "http://"+getFreeAddr(t))
+	t.Setenv("NO_PROXY", "127.0.0.1")
+
+	retCode := run(
+		[]string{listener.Addr().String()},
+		&config{waitTimeout: time.Second, defaultPollFreq: 50 * time.Millisecond, isQuiet: true},
+	).exitCode()
+
+	if retCode != exitOK {
+		t.Errorf("test failed - want exit code: %d, got: %d", exitOK, retCode)
+	}
+}
+
+// getFreeAddr returns a local TCP address on which no server is listening.
+func getFreeAddr(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed getting free address: %s", err)
+	}
+	defer listener.Close()
+
+	return listener.Addr().String()
+}
+
+func TestRunExitCodes(t *testing.T) {
+	t.Parallel()
+
+	readyFile := filepath.Join(t.TempDir(), "ready")
+	if err := os.WriteFile(readyFile, nil, 0o600); err != nil {
+		t.Fatalf("failed writing ready file: %s", err)
+	}
+
+	var tests = []struct {
+		name     string
+		rawAddrs []string
+		want     int
+	}{
+		{"parse error", []string{"localhost"}, exitParseError},
+		{"connection error", []string{"wf-test.invalid:80"}, exitFailure},
+		{"timeout", []string{getFreeAddr(t)}, exitTimeout},
+		{"file ready", []string{"file://" + readyFile}, exitOK},
+		{"file timeout", []string{"file://" + readyFile + ".missing"}, exitTimeout},
+		{"file parse error", []string{"file://server/ready"}, exitParseError},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			want := test.want
+			got := run(
+				test.rawAddrs,
+				&config{waitTimeout: 1 * time.Second, defaultPollFreq: 200 * time.Millisecond},
+			).exitCode()
+
+			if want != got {
+				t.Errorf("test[%d] %q failed - want exit code: %d, got: %d", i, name, want, got)
+			}
+		})
+	}
+}
+
+func TestRunResult(t *testing.T) {
+	t.Parallel()
+
+	var (
+		dir         = t.TempDir()
+		readyFile   = filepath.Join(dir, "ready")
+		missingFile = filepath.Join(dir, "missing")
+	)
+	if err := os.WriteFile(readyFile, nil, 0o600); err != nil {
+		t.Fatalf("test failed - can not create file: %s", err)
+	}
+
+	res := run(
+		[]string{"file://" + readyFile, "file://" + missingFile},
+		&config{
+			waitTimeout:     200 * time.Millisecond,
+			defaultPollFreq: 20 * time.Millisecond,
+			isQuiet:         true,
+		},
+	)
+
+	if !errors.Is(res.err, context.DeadlineExceeded) {
+		t.Errorf("test failed - want err: %q, got: %v", context.DeadlineExceeded, res.err)
+	}
+	if !res.timedOut() || res.exitCode() != exitTimeout {
+		t.Errorf("test failed - want exit code: %d, got: %d", exitTimeout, res.exitCode())
+	}
+	if got := res.summary.results["file://"+readyFile]; got == nil || got.status != wait.Ready {
+		t.Errorf("test failed - want ready result for %q, got: %+v", readyFile, got)
+	}
+	if got := res.summary.results["file://"+missingFile]; got == nil || got.status != wait.Failed {
+		t.Errorf("test failed - want failed result for %q, got: %+v", missingFile, got)
+	}
+	if res.summary.elapsed < 200*time.Millisecond {
+		t.Errorf("test failed - want elapsed of at least 200ms, got: %s", res.summary.elapsed)
+	}
+}
+
+func TestRunResultParseError(t *testing.T) {
+	t.Parallel()
+
+	res := run(
+		[]string{"http://"},
+		&config{waitTimeout: time.Second, defaultPollFreq: time.Second, isQuiet: true},
+	)
+
+	if res.err == nil || !res.isParseErr || res.summary != nil {
+		t.Errorf("test failed - want parse error without summary, got: %+v", res)
+	}
+	if res.timedOut() || res.exitCode() != exitParseError {
+		t.Errorf("test failed - want exit code: %d, got: %d", exitParseError, res.exitCode())
+	}
+}
+
+// TestRunSilent is not parallel, since it replaces os.Stdout.
+func TestRunSilent(t *testing.T) {
+	var tests = []struct {
+		name     string
+		rawAddrs []string
+		cfg      config
+		want     int
+	}{
+		{
+			"parse error",
+			[]string{"http://"},
+			config{waitTimeout: time.Second, defaultPollFreq: time.Second},
+			exitParseError,
+		},
+		{
+			"timeout with summary",
+			[]string{getFreeAddr(t)},
+			config{
+				waitTimeout:     100 * time.Millisecond,
+				defaultPollFreq: 20 * time.Millisecond,
+				showSummary:     true,
+			},
+			exitTimeout,
+		},
+	}
+
+	for i, test := range tests {
+		name := test.name
+		cfg := test.cfg
+		cfg.isSilent = true
+
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("test[%d] %q failed - can not create pipe: %s", i, name, err)
+		}
+		stdout := os.Stdout
+		os.Stdout = w
+		got := run(test.rawAddrs, &cfg).exitCode()
+		os.Stdout = stdout
+		w.Close()
+
+		out, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("test[%d] %q failed - can not read output: %s", i, name, err)
+		}
+		if got != test.want {
+			t.Errorf("test[%d] %q failed - want exit code: %d, got: %d", i, name, test.want, got)
+		}
+		if len(out) > 0 {
+			t.Errorf("test[%d] %q failed - want no output, got: %q", i, name, out)
+		}
+	}
+}
+
+func TestParseSpecsModes(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name     string
+		mode     mode
+		rawAddrs []string
+		want     [4]int
+		wantErr  string
+	}{
+		{
+			"tcp",
+			modeTCP,
+			[]string{"db:5432", "http://api", "file:///run/ready", "exec://pg_isready -h db"},
+			[4]int{2, 0, 1, 1},
+			"",
+		},
+		{"http", modeHTTP, []string{"http://api/health", "HTTPS://api"}, [4]int{0, 2, 0, 0}, ""},
+		{
+			"http with tcp address",
+			modeHTTP,
+			[]string{"http://api", "db:5432"},
+			[4]int{},
+			"address 1: not an HTTP address: \"db:5432\"",
+		},
+		{
+			"any",
+			modeAny,
+			[]string{"db:5432", "http://api", "file:///run/ready", "exec://pg_isready -h db"},
+			[4]int{1, 1, 1, 1},
+			"",
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			wantErr := test.wantErr
+			set, gotErr := parseSpecs(
+				test.rawAddrs,
+				&config{mode: test.mode, defaultPollFreq: time.Second},
+			)
+
+			if (wantErr == "" && gotErr != nil) || (wantErr != "" && fmt.Sprint(gotErr) != wantErr) {
+				t.Fatalf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+			}
+			if gotErr != nil {
+				return
+			}
+			if got := [4]int{len(set.tcp), len(set.http), len(set.file), len(set.exec)}; got != test.want {
+				t.Errorf("test[%d] %q failed - want counts: %v, got: %v", i, name, test.want, got)
+			}
+		})
+	}
+}
+
+func TestParseSpecsAnyOptions(t *testing.T) {
+	t.Parallel()
+
+	set, err := parseSpecs(
+		[]string{"db:5432", "http://api", "file:///run/ready"},
+		&config{
+			mode:             modeAny,
+			defaultPollFreq:  time.Second,
+			proxy:            "http://proxy:3128",
+			jitter:           0.5,
+			noImmediateCheck: true,
+		},
+	)
+	if err != nil {
+		t.Fatalf("test failed - unexpected error: %s", err)
+	}
+
+	var (
+		tcpSpec  = set.tcp[0]
+		httpSpec = set.http[0]
+		fileSpec = set.file[0]
+	)
+	for _, got := range []string{fmt.Sprint(tcpSpec.Proxy), fmt.Sprint(httpSpec.Proxy)} {
+		if want := "http://proxy:3128"; got != want {
+			t.Errorf("test failed - want proxy: %s, got: %s", want, got)
+		}
+	}
+	if tcpSpec.Jitter != 0.5 || httpSpec.Jitter != 0.5 || fileSpec.Jitter != 0.5 {
+		t.Errorf(
+			"test failed - want jitter: %g, got: %g, %g, %g",
+			0.5,
+			tcpSpec.Jitter,
+			httpSpec.Jitter,
+			fileSpec.Jitter,
+		)
+	}
+	if !tcpSpec.SkipImmediateCheck || !httpSpec.SkipImmediateCheck || !fileSpec.SkipImmediateCheck {
+		t.Errorf("test failed - want immediate checks skipped for all targets")
+	}
+}
+
+func TestParseSpecsPriorities(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name       string
+		priorities []string
+		want       map[string]int
+		wantErr    string
+	}{
+		{"none", nil, map[string]int{}, ""},
+		{
+			"all kinds",
+			[]string{"tcp://db:5432", "http://api", "file:///run/ready"},
+			map[string]int{"tcp://db:5432": 1, "http://api": 1, "file:///run/ready": 1},
+			"",
+		},
+		{"named", []string{"cache"}, map[string]int{"cache": 1}, ""},
+		{"unknown", []string{"db:5432"}, nil, "priority target is not waited: \"db:5432\""},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			wantErr := test.wantErr
+			set, gotErr := parseSpecs(
+				[]string{"db:5432", "cache=redis:6379", "http://api", "file:///run/ready"},
+				&config{mode: modeAny, defaultPollFreq: time.Second, priorities: test.priorities},
+			)
+
+			if (wantErr == "" && gotErr != nil) || (wantErr != "" && fmt.Sprint(gotErr) != wantErr) {
+				t.Fatalf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+			}
+			if gotErr != nil {
+				return
+			}
+			if got := set.priorities(); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("test[%d] %q failed - want: %v, got: %v", i, name, test.want, got)
+			}
+		})
+	}
+}
+
+func TestParseSpecsPollTiming(t *testing.T) {
+	t.Parallel()
+
+	set, err := parseSpecs(
+		[]string{"db:5432", "http://api", "file:///run/ready", "exec://true"},
+		&config{mode: modeAny, defaultPollFreq: time.Second, jitter: 0.5, jitterSeed: 7},
+	)
+	if err != nil {
+		t.Fatalf("test failed - unexpected error: %s", err)
+	}
+
+	// Seeds are numbered across all targets, TCP first, then HTTP, then files, then commands.
+	rngs := []*rand.Rand{
+		set.tcp[0].JitterRand,
+		set.http[0].JitterRand,
+		set.file[0].JitterRand,
+		set.exec[0].JitterRand,
+	}
+	for i, rng := range rngs {
+		if rng == nil {
+			t.Fatalf("test rngs[%d] failed - want a seeded generator, got nil", i)
+		}
+		want := rand.New(rand.NewSource(7 + int64(i))).Int63() // nolint: gosec
+		if got := rng.Int63(); got != want {
+			t.Errorf("test rngs[%d] failed - want: %d, got: %d", i, want, got)
+		}
+	}
+}
+
+func TestParseSpecsStrict(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name    string
+		strict  []string
+		want    []bool
+		wantErr string
+	}{
+		{"none", nil, []bool{false, false}, ""},
+		{"address", []string{"tcp://db:5432"}, []bool{true, false}, ""},
+		{"named", []string{"cache"}, []bool{false, true}, ""},
+		{"unknown", []string{"db:5432"}, nil, "strict target is not a waited TCP target: \"db:5432\""},
+		{
+			"not TCP",
+			[]string{"http://api"},
+			nil,
+			"strict target is not a waited TCP target: \"http://api\"",
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			wantErr := test.wantErr
+			set, gotErr := parseSpecs(
+				[]string{"db:5432", "cache=redis:6379", "http://api"},
+				&config{mode: modeAny, defaultPollFreq: time.Second, strictTargets: test.strict},
+			)
+
+			if (wantErr == "" && gotErr != nil) || (wantErr != "" && fmt.Sprint(gotErr) != wantErr) {
+				t.Fatalf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+			}
+			if gotErr != nil {
+				return
+			}
+			got := make([]bool, len(set.tcp))
+			for j, spec := range set.tcp {
+				got[j] = spec.Strict
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("test[%d] %q failed - want: %v, got: %v", i, name, test.want, got)
+			}
+		})
+	}
+}
+
+func TestParseSpecsSkipInvalid(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name        string
+		skip        bool
+		rawAddrs    []string
+		wantTargets []string
+		wantSkipped []string
+		wantErr     string
+	}{
+		{
+			"strict",
+			false,
+			[]string{"db:5432", "cache:99999"},
+			nil,
+			nil,
+			"address 1: invalid port \"99999\"",
+		},
+		{
+			"skip",
+			true,
+			[]string{"db:5432", "cache:99999", "http://api", "file://run/ready", "exec://", "cidr:x"},
+			[]string{"tcp://db:5432", "http://api"},
+			[]string{
+				"skipped invalid address \"cache:99999\": invalid port \"99999\"",
+				"skipped invalid address \"file://run/ready\": " +
+					"file host must be empty or localhost: \"run\"",
+				"skipped invalid address \"exec://\": command not given: \"exec://\"",
+				"skipped invalid address \"cidr:x\": address x: missing port in address",
+			},
+			"",
+		},
+		{
+			"skip all",
+			true,
+			[]string{"cache:99999"},
+			nil,
+			nil,
+			"no valid addresses: skipped invalid address \"cache:99999\": invalid port \"99999\"",
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			wantErr := test.wantErr
+			set, gotErr := parseSpecs(
+				test.rawAddrs,
+				&config{mode: modeAny, defaultPollFreq: time.Second, skipInvalid: test.skip},
+			)
+
+			if (wantErr == "" && gotErr != nil) || (wantErr != "" && fmt.Sprint(gotErr) != wantErr) {
+				t.Fatalf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+			}
+			if gotErr != nil {
+				return
+			}
+			if got := set.targets(); !reflect.DeepEqual(got, test.wantTargets) {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, name, test.wantTargets, got)
+			}
+			if !reflect.DeepEqual(set.skipped, test.wantSkipped) {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, name, test.wantSkipped, set.skipped)
+			}
+		})
+	}
+}
+
+func TestParseSpecsTLSPins(t *testing.T) {
+	t.Parallel()
+
+	const hexPin = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+	var tests = []struct {
+		name    string
+		pins    []string
+		want    []string
+		wantErr string
+	}{
+		{"none", nil, nil, ""},
+		{"pinned", []string{strings.ToUpper(hexPin)}, []string{hexPin}, ""},
+		{
+			"invalid",
+			[]string{hexPin, "abc"},
+			nil,
+			"invalid TLS pin, want SHA-256 fingerprint in hex, got: \"abc\"",
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			wantErr := test.wantErr
+			set, gotErr := parseSpecs(
+				[]string{"https://api"},
+				&config{mode: modeHTTP, defaultPollFreq: time.Second, tlsPins: test.pins},
+			)
+
+			if (wantErr == "" && gotErr != nil) || (wantErr != "" && fmt.Sprint(gotErr) != wantErr) {
+				t.Fatalf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+			}
+			if gotErr != nil {
+				return
+			}
+			var got []string
+			for _, pin := range set.http[0].TLSPins {
+				got = append(got, pin.String())
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("test[%d] %q failed - want: %v, got: %v", i, name, test.want, got)
+			}
+		})
+	}
+}
+
+func TestParseSpecsHTTPStatus(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name    string
+		status  string
+		want    string
+		wantErr string
+	}{
+		{"default", "", "", ""},
+		{"codes and ranges", "200, 204,301-399", "200,204,301-399", ""},
+		{
+			"invalid",
+			"200,399-301",
+			"",
+			"invalid HTTP status, want code or range of codes from 100 to 599, got: \"399-301\"",
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			wantErr := test.wantErr
+			set, gotErr := parseSpecs(
+				[]string{"https://api"},
+				&config{mode: modeHTTP, defaultPollFreq: time.Second, httpStatus: test.status},
+			)
+
+			if (wantErr == "" && gotErr != nil) || (wantErr != "" && fmt.Sprint(gotErr) != wantErr) {
+				t.Fatalf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+			}
+			if gotErr != nil {
+				return
+			}
+			if got := set.http[0].ReadyStatuses.String(); got != test.want {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, name, test.want, got)
+			}
+		})
+	}
+}
+
+func TestRunHTTP(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"status":"UP"}`)
+	}))
+	t.Cleanup(server.Close)
+
+	var (
+		healthURL = server.URL + "/health"
+		tests     = []struct {
+			name       string
+			mode       mode
+			rawAddrs   []string
+			expectBody string
+			want       int
+		}{
+			{"http ready", modeHTTP, []string{healthURL}, "", exitOK},
+			{"http not found", modeHTTP, []string{server.URL + "/missing"}, "", exitTimeout},
+			{"http body matches", modeHTTP, []string{healthURL}, `"status":\s*"UP"`, exitOK},
+			{"http body differs", modeHTTP, []string{healthURL}, "DOWN", exitTimeout},
+			{"http invalid body pattern", modeHTTP, []string{healthURL}, "(", exitParseError},
+			{
+				"any ready",
+				modeAny,
+				[]string{healthURL, server.Listener.Addr().String()},
+				"",
+				exitOK,
+			},
+			{"tcp ready", modeTCP, []string{server.URL}, "", exitOK},
+		}
+	)
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			want := test.want
+			got := run(
+				test.rawAddrs,
+				&config{
+					mode:            test.mode,
+					waitTimeout:     500 * time.Millisecond,
+					defaultPollFreq: 100 * time.Millisecond,
+					noProxy:         true,
+					expectBody:      test.expectBody,
+				},
+			).exitCode()
+
+			if want != got {
+				t.Errorf("test[%d] %q failed - want exit code: %d, got: %d", i, name, want, got)
+			}
+		})
+	}
+}
+
+func TestRunInvalidPollFreq(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name     string
+		pollFreq time.Duration
+	}{
+		{"zero", 0},
+		{"negative", -1 * time.Second},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			want := exitParseError
+			got := run(
+				[]string{"localhost:5000"},
+				&config{waitTimeout: 1 * time.Second, defaultPollFreq: test.pollFreq},
+			).exitCode()
+
+			if want != got {
+				t.Errorf("test[%d] %q failed - want exit code: %d, got: %d", i, name, want, got)
+			}
+		})
+	}
+}
+
+func TestRunRounds(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name        string
+		rounds      int
+		createAfter time.Duration
+		want        int
+	}{
+		{"ready in later round", 10, 150 * time.Millisecond, exitOK},
+		{"never ready", 3, 0, exitFailure},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			readyFile := filepath.Join(t.TempDir(), "ready")
+			if test.createAfter > 0 {
+				timer := time.AfterFunc(test.createAfter, func() {
+					_ = os.WriteFile(readyFile, nil, 0o600)
+				})
+				t.Cleanup(func() { timer.Stop() })
+			}
+
+			var (
+				name  = test.name
+				want  = test.want
+				start = time.Now()
+				got   = run(
+					[]string{"file://" + readyFile},
+					&config{
+						waitTimeout:     time.Second,
+						defaultPollFreq: 10 * time.Millisecond,
+						once:            true,
+						rounds:          test.rounds,
+						roundInterval:   50 * time.Millisecond,
+					},
+				).exitCode()
+			)
+
+			if want != got {
+				t.Errorf("test[%d] %q failed - want exit code: %d, got: %d", i, name, want, got)
+			}
+			if test.createAfter == 0 {
+				minElapsed := time.Duration(test.rounds-1) * 50 * time.Millisecond
+				if elapsed := time.Since(start); elapsed < minElapsed {
+					t.Errorf("test[%d] %q failed - want all rounds, ended after: %s", i, name, elapsed)
+				}
+			}
+		})
+	}
+}
+
+func TestRunRoundsStopTCP(t *testing.T) {
+	t.Parallel()
+
+	// Checking a file below another file fails right away, while the TCP target is still being
+	// waited on.
+	notDir := filepath.Join(t.TempDir(), "ready")
+	if err := os.WriteFile(notDir, nil, 0o600); err != nil {
+		t.Fatalf("failed writing file: %s", err)
+	}
+	var (
+		pendingAddr = getFreeAddr(t)
+		waitTimeout = 5 * time.Second
+		start       = time.Now()
+	)
+
+	got := run(
+		[]string{"file://" + filepath.Join(notDir, "ready"), pendingAddr},
+		&config{
+			waitTimeout:     waitTimeout,
+			defaultPollFreq: 10 * time.Millisecond,
+			rounds:          2,
+			roundInterval:   50 * time.Millisecond,
+		},
+	).exitCode()
+	if got != exitFailure {
+		t.Fatalf("test failed - want exit code: %d, got: %d", exitFailure, got)
+	}
+	// Rounds end at their first failure, without waiting for the TCP wait operations to time out.
+	if elapsed := time.Since(start); elapsed >= waitTimeout {
+		t.Errorf("test failed - want rounds to end before %s, ended after: %s", waitTimeout, elapsed)
+	}
+
+	listener, err := net.Listen("tcp", pendingAddr)
+	if err != nil {
+		t.Fatalf("test failed - can not listen on %s: %s", pendingAddr, err)
+	}
+	defer listener.Close()
+
+	accepted := make(chan struct{})
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			conn.Close()
+			close(accepted)
+		}
+	}()
+
+	select {
+	case <-accepted:
+		t.Errorf("test failed - want no connection attempts after the last round")
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestRunNoTimeout(t *testing.T) {
+	t.Parallel()
+
+	readyFile := filepath.Join(t.TempDir(), "ready")
+	timer := time.AfterFunc(300*time.Millisecond, func() {
+		_ = os.WriteFile(readyFile, nil, 0o600)
+	})
+	t.Cleanup(func() { timer.Stop() })
+
+	got := run(
+		[]string{"file://" + readyFile},
+		&config{
+			waitTimeout:     wait.NoTimeout,
+			isTimeoutSet:    true,
+			defaultPollFreq: 10 * time.Millisecond,
+		},
+	).exitCode()
+	if got != exitOK {
+		t.Errorf("test failed - want exit code: %d, got: %d", exitOK, got)
+	}
+}
+
+func TestRunOnReadyExec(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("test hook command requires touch")
+	}
+
+	var (
+		dir       = t.TempDir()
+		readyFile = filepath.Join(dir, "ready")
+		hookFile  = filepath.Join(dir, "hook")
+	)
+	if err := os.WriteFile(readyFile, nil, 0o600); err != nil {
+		t.Fatalf("test failed - can not create file: %s", err)
+	}
+
+	got := run(
+		[]string{"file://" + readyFile},
+		&config{
+			waitTimeout:     time.Second,
+			defaultPollFreq: 10 * time.Millisecond,
+			onReadyExec:     "touch " + hookFile,
+			isQuiet:         true,
+		},
+	).exitCode()
+	if got != exitOK {
+		t.Errorf("test failed - want exit code: %d, got: %d", exitOK, got)
+	}
+	// The hook has finished by the time run returns.
+	if _, err := os.Stat(hookFile); err != nil {
+		t.Errorf("test failed - want hook run, got: %s", err)
+	}
+}
+
+func TestRunOnce(t *testing.T) {
+	t.Parallel()
+
+	readyFile := filepath.Join(t.TempDir(), "ready")
+	if err := os.WriteFile(readyFile, nil, 0o600); err != nil {
+		t.Fatalf("failed writing ready file: %s", err)
+	}
+
+	var tests = []struct {
+		name     string
+		rawAddrs []string
+		want     int
+	}{
+		{"file ready", []string{"file://" + readyFile}, exitOK},
+		{"file missing", []string{"file://" + readyFile + ".missing"}, exitFailure},
+		{"refused", []string{getFreeAddr(t)}, exitFailure},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			want := test.want
+			got := run(
+				test.rawAddrs,
+				&config{
+					waitTimeout:     5 * time.Second,
+					defaultPollFreq: 200 * time.Millisecond,
+					once:            true,
+					isQuiet:         true,
+				},
+			).exitCode()
+
+			if want != got {
+				t.Errorf("test[%d] %q failed - want exit code: %d, got: %d", i, name, want, got)
+			}
+		})
+	}
+}
+
+func TestRunCount(t *testing.T) {
+	t.Parallel()
+
+	readyFile := filepath.Join(t.TempDir(), "ready")
+	if err := os.WriteFile(readyFile, nil, 0o600); err != nil {
+		t.Fatalf("failed writing ready file: %s", err)
+	}
+
+	// The missing file fails first, but the other targets are still waited for counting.
+	res := run(
+		[]string{"file://" + readyFile + ".missing", getFreeAddr(t), "file://" + readyFile},
+		&config{
+			waitTimeout:     5 * time.Second,
+			defaultPollFreq: 200 * time.Millisecond,
+			once:            true,
+			count:           true,
+		},
+	)
+
+	if got := res.exitCode(); got != exitFailure {
+		t.Errorf("test failed - want exit code: %d, got: %d", exitFailure, got)
+	}
+	if ready, total := res.summary.readyCount(); ready != 1 || total != 3 {
+		t.Errorf("test failed - want: 1/3 ready, got: %d/%d", ready, total)
+	}
+}
+
+func TestRunExpectUnreachable(t *testing.T) {
+	t.Parallel()
+
+	readyFile := filepath.Join(t.TempDir(), "ready")
+	if err := os.WriteFile(readyFile, nil, 0o600); err != nil {
+		t.Fatalf("failed writing ready file: %s", err)
+	}
+
+	var tests = []struct {
+		name     string
+		rawAddrs []string
+		once     bool
+		want     int
+	}{
+		{"refused until timeout", []string{getFreeAddr(t)}, false, exitOK},
+		{"refused once", []string{getFreeAddr(t)}, true, exitOK},
+		{"file missing", []string{"file://" + readyFile + ".missing"}, true, exitOK},
+		{"one ready", []string{getFreeAddr(t), "file://" + readyFile}, false, exitFailure},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			want := test.want
+			got := run(
+				test.rawAddrs,
+				&config{
+					waitTimeout:       300 * time.Millisecond,
+					defaultPollFreq:   100 * time.Millisecond,
+					once:              test.once,
+					expectUnreachable: true,
+					isQuiet:           true,
+				},
+			).exitCode()
+
+			if want != got {
+				t.Errorf("test[%d] %q failed - want exit code: %d, got: %d", i, name, want, got)
+			}
+		})
+	}
+}
+
+func TestRegisterSchemePorts(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name    string
+		in      []string
+		wantErr string
+	}{
+		{"none", nil, ""},
+		{"valid", []string{"cmdtesta=1234", "cmdtestb=80"}, ""},
+		{"no separator", []string{"cmdtestc"}, "invalid scheme port, want NAME=PORT: \"cmdtestc\""},
+		{"invalid port", []string{"cmdtestd=x"}, "invalid port for protocol \"cmdtestd\": \"x\""},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			wantErr := test.wantErr
+			gotErr := registerSchemePorts(test.in)
+
+			if (wantErr == "" && gotErr != nil) || (wantErr != "" && fmt.Sprint(gotErr) != wantErr) {
+				t.Errorf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+			}
+		})
+	}
+}
+
+func TestRegisterSchemePollFreqs(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name    string
+		in      []string
+		wantErr string
+	}{
+		{"none", nil, ""},
+		{"valid", []string{"cmdtestpa=250ms", "cmdtestpb=2s"}, ""},
+		{
+			"no separator",
+			[]string{"cmdtestpc"},
+			"invalid scheme poll frequency, want NAME=FREQ: \"cmdtestpc\"",
+		},
+		{
+			"invalid frequency",
+			[]string{"cmdtestpd=soon"},
+			"invalid poll frequency of scheme \"cmdtestpd\": \"soon\"",
+		},
+		{
+			"negative frequency",
+			[]string{"cmdtestpe=-1s"},
+			"invalid poll frequency for protocol \"cmdtestpe\": " +
+				"poll frequency must be positive, got: -1s",
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			wantErr := test.wantErr
+			gotErr := registerSchemePollFreqs(test.in)
+
+			if (wantErr == "" && gotErr != nil) || (wantErr != "" && fmt.Sprint(gotErr) != wantErr) {
+				t.Errorf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+			}
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name    string
+		in      config
+		wantErr string
+	}{
+		{"default", config{}, ""},
+		{"quiet ready", config{isQuietReady: true}, ""},
+		{"quiet", config{isQuiet: true}, ""},
+		{
+			"both quiet",
+			config{isQuiet: true, isQuietReady: true},
+			"flags --quiet and --quiet-ready can not be used together",
+		},
+		{"verbose", config{isVerbose: true}, ""},
+		{"silent", config{isSilent: true}, ""},
+		{
+			"quiet and silent",
+			config{isQuiet: true, isSilent: true},
+			"flags --quiet and --silent can not be used together",
+		},
+		{"count", config{count: true}, ""},
+		{
+			"verbose and count",
+			config{isVerbose: true, count: true},
+			"flags --verbose and --count can not be used together",
+		},
+		{
+			"allow unset env without expand env",
+			config{allowUnsetEnv: true},
+			"flag --allow-unset-env requires --expand-env",
+		},
+		{"log max size", config{logFile: "wf.log", logMaxSize: "10MB"}, ""},
+		{
+			"log max size without log file",
+			config{logMaxSize: "10MB"},
+			"flag --log-max-size requires --log-file",
+		},
+		{
+			"once and retry on error",
+			config{once: true, retryOnError: true},
+			"flags --once and --retry-on-error can not be used together",
+		},
+		{
+			"negative slowness threshold",
+			config{warnSlowerThan: -time.Second},
+			"--warn-slower-than must not be negative, got: -1s",
+		},
+		{"rounds", config{rounds: 3, roundInterval: time.Second}, ""},
+		{"negative rounds", config{rounds: -1}, "--rounds must not be negative, got: -1"},
+		{"negative attempts", config{attempts: -1}, "--attempts must not be negative, got: -1"},
+		{
+			"expect unreachable without timeout",
+			config{expectUnreachable: true, waitTimeout: wait.NoTimeout, isTimeoutSet: true},
+			"flag --expect-unreachable requires a timeout",
+		},
+		{
+			"expect unreachable once without timeout",
+			config{
+				expectUnreachable: true,
+				once:              true,
+				waitTimeout:       wait.NoTimeout,
+				isTimeoutSet:      true,
+			},
+			"",
+		},
+		{
+			"negative round interval",
+			config{roundInterval: -time.Second},
+			"--round-interval must not be negative, got: -1s",
+		},
+		{
+			"verbose and quiet",
+			config{isVerbose: true, isQuiet: true},
+			"flags --verbose and --quiet can not be used together",
+		},
+		{
+			"proxy and no proxy",
+			config{proxy: "http://proxy:3128", noProxy: true},
+			"flags --proxy and --no-proxy can not be used together",
+		},
+		{"jitter", config{jitter: 0.5}, ""},
+		{"jitter out of range", config{jitter: 1}, "jitter must be in [0, 1), got: 1"},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			wantErr := test.wantErr
+			gotErr := test.in.validate()
+
+			if (wantErr == "" && gotErr != nil) || (wantErr != "" && fmt.Sprint(gotErr) != wantErr) {
+				t.Errorf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+			}
+		})
+	}
+}
+
+func TestConfigResolveTimeout(t *testing.T) {
+	t.Parallel()
+
+	var (
+		now   = time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+		tests = []struct {
+			name    string
+			in      config
+			want    time.Duration
+			wantErr string
+		}{
+			{"no deadline", config{waitTimeout: 5 * time.Second}, 5 * time.Second, ""},
+			{
+				"deadline, default timeout",
+				config{waitTimeout: 5 * time.Second, deadline: "2022-01-01T12:00:30Z"},
+				30 * time.Second,
+				"",
+			},
+			{
+				"deadline sooner than timeout",
+				config{waitTimeout: time.Minute, isTimeoutSet: true, deadline: "10s"},
+				10 * time.Second,
+				"",
+			},
+			{
+				"timeout sooner than deadline",
+				config{waitTimeout: 5 * time.Second, isTimeoutSet: true, deadline: "1m"},
+				5 * time.Second,
+				"",
+			},
+			{
+				"passed deadline",
+				config{waitTimeout: 5 * time.Second, deadline: "2022-01-01T11:00:00Z"},
+				minTimeout,
+				"",
+			},
+			{"no timeout", config{waitTimeout: wait.NoTimeout, isTimeoutSet: true}, 0, ""},
+			{
+				"deadline, no timeout",
+				config{waitTimeout: wait.NoTimeout, isTimeoutSet: true, deadline: "1m"},
+				time.Minute,
+				"",
+			},
+			{
+				"attempts, default timeout",
+				config{waitTimeout: 5 * time.Second, attempts: 20, defaultPollFreq: time.Second},
+				20 * time.Second,
+				"",
+			},
+			{
+				"attempts, explicit timeout",
+				config{
+					waitTimeout:     5 * time.Second,
+					isTimeoutSet:    true,
+					attempts:        20,
+					defaultPollFreq: time.Second,
+				},
+				5 * time.Second,
+				"",
+			},
+			{
+				"deadline sooner than attempts",
+				config{attempts: 20, defaultPollFreq: time.Second, deadline: "10s"},
+				10 * time.Second,
+				"",
+			},
+			{
+				"invalid deadline",
+				config{waitTimeout: 5 * time.Second, deadline: "noon"},
+				0,
+				"invalid deadline, want RFC3339 time or duration: \"noon\"",
+			},
+		}
+	)
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			wantErr := test.wantErr
+			got, gotErr := test.in.resolveTimeout(now)
+
+			if (wantErr == "" && gotErr != nil) || (wantErr != "" && fmt.Sprint(gotErr) != wantErr) {
+				t.Errorf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+			}
+			if got != test.want {
+				t.Errorf("test[%d] %q failed - want: %s, got: %s", i, name, test.want, got)
+			}
+		})
+	}
+}
+
+func TestConfigureTCPSpecsNetwork(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name   string
+		addr   string
+		family string
+		want   string
+	}{
+		{"flag only", "localhost:5000", "tcp4", "tcp4"},
+		{"scheme only", "tcp6://localhost:5000", "tcp", "tcp6"},
+		{"scheme over flag", "tcp6://localhost:5000", "tcp4", "tcp6"},
+		{"other scheme", "http://localhost", "tcp6", "tcp6"},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			spec, err := wait.ParseTCPSpec(test.addr, time.Second)
+			if err != nil {
+				t.Fatalf("test[%d] %q failed - unexpected error: %s", i, name, err)
+			}
+			cfg := config{family: test.family}
+			if err := configureTCPSpecs([]*wait.TCPSpec{spec}, &cfg, nil); err != nil {
+				t.Fatalf("test[%d] %q failed - unexpected error: %s", i, name, err)
+			}
+			if spec.Network != test.want {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, name, test.want, spec.Network)
+			}
+		})
+	}
+}
+
+func TestConfigureTCPSpecsJitterSeed(t *testing.T) {
+	t.Parallel()
+
+	newSpecs := func(seed int64) []*wait.TCPSpec {
+		specs := []*wait.TCPSpec{
+			{Host: "localhost", Port: "5000", PollFreq: time.Second},
+			{Host: "localhost", Port: "5001", PollFreq: time.Second},
+		}
+		cfg := config{jitter: 0.5, jitterSeed: seed}
+		if err := configureTCPSpecs(specs, &cfg, nil); err != nil {
+			t.Fatalf("test failed - unexpected error: %s", err)
+		}
+		return specs
+	}
+
+	if specs := newSpecs(0); specs[0].JitterRand != nil {
+		t.Errorf("test no seed failed - want no generator, got: %v", specs[0].JitterRand)
+	}
+
+	first, second := newSpecs(7), newSpecs(7)
+	for i := range first {
+		want, got := first[i].JitterRand.Int63(), second[i].JitterRand.Int63()
+		if want != got {
+			t.Errorf("test specs[%d] failed - want: %d, got: %d", i, want, got)
+		}
+	}
+	if first[0].JitterRand.Int63() == first[1].JitterRand.Int63() {
+		t.Errorf("test failed - want different sequences per target, got the same")
+	}
+}
+
+func TestConfigureTCPSpecsMode(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name       string
+		cfg        config
+		wantExpect string
+		wantErr    string
+	}{
+		{"default", config{}, "", ""},
+		{"connect", config{tcpMode: "connect"}, "", ""},
+		{"service answer", config{tcpMode: "service-answer"}, "(?s).", ""},
+		{
+			"service answer with banner",
+			config{tcpMode: "service-answer", expectBanner: "^SSH-"},
+			"^SSH-",
+			"",
+		},
+		{
+			"unknown",
+			config{tcpMode: "answer"},
+			"",
+			"invalid mode, want connect or service-answer, got: \"answer\"",
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			wantErr := test.wantErr
+			spec := &wait.TCPSpec{Host: "localhost", Port: "5000", PollFreq: time.Second}
+			gotErr := configureTCPSpecs([]*wait.TCPSpec{spec}, &test.cfg, nil)
+
+			if (wantErr == "" && gotErr != nil) || (wantErr != "" && fmt.Sprint(gotErr) != wantErr) {
+				t.Fatalf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+			}
+			if wantErr != "" {
+				return
+			}
+			got := ""
+			if spec.Expect != nil {
+				got = spec.Expect.String()
+			}
+			if got != test.wantExpect {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, name, test.wantExpect, got)
+			}
+		})
+	}
+}
+
+func TestConfigureTCPSpecsRead(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name        string
+		cfg         config
+		wantBytes   int
+		wantTimeout time.Duration
+		wantErr     string
+	}{
+		{"default", config{}, 0, 0, ""},
+		{
+			"set",
+			config{readBytes: 4096, readTimeout: 3 * time.Second},
+			4096,
+			3 * time.Second,
+			"",
+		},
+		{
+			"negative bytes",
+			config{readBytes: -1},
+			0,
+			0,
+			"--read-bytes must not be negative, got: -1",
+		},
+		{
+			"negative timeout",
+			config{readTimeout: -time.Second},
+			0,
+			0,
+			"--read-timeout must not be negative, got: -1s",
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			wantErr := test.wantErr
+			spec := &wait.TCPSpec{Host: "localhost", Port: "5000", PollFreq: time.Second}
+			gotErr := configureTCPSpecs([]*wait.TCPSpec{spec}, &test.cfg, nil)
 
-	if retCode != 0 {
-		t.Errorf("test failed - want exit code: %d, got: %d", 0, retCode)
+			if (wantErr == "" && gotErr != nil) || (wantErr != "" && fmt.Sprint(gotErr) != wantErr) {
+				t.Fatalf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+			}
+			if spec.ReadBytes != test.wantBytes {
+				t.Errorf("test[%d] %q failed - want: %d, got: %d", i, name, test.wantBytes, spec.ReadBytes)
+			}
+			if spec.ReadTimeout != test.wantTimeout {
+				t.Errorf(
+					"test[%d] %q failed - want: %s, got: %s",
+					i,
+					name,
+					test.wantTimeout,
+					spec.ReadTimeout,
+				)
+			}
+		})
 	}
 }
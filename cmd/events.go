@@ -0,0 +1,156 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bow/wf/wait"
+)
+
+// eventWriteTimeout is how long writing an event to a client may take before the client is dropped,
+// so that slow clients do not hold up the wait operation.
+const eventWriteTimeout = time.Second
+
+// event is a single message of the wait operation, as streamed to event socket clients.
+type event struct {
+	Target         string      `json:"target"`
+	Status         wait.Status `json:"status"`
+	ElapsedSeconds float64     `json:"elapsed_seconds"`
+	Attempts       int         `json:"attempts"`
+	Error          string      `json:"error,omitempty"`
+}
+
+// newEvent creates the event of the given message.
+func newEvent(msg wait.Message) event {
+	ev := event{
+		Target:         msg.Target(),
+		Status:         msg.Status(),
+		ElapsedSeconds: msg.ElapsedTime().Seconds(),
+		Attempts:       msg.Attempts(),
+	}
+	if err := msg.Err(); err != nil {
+		ev.Error = err.Error()
+	}
+	return ev
+}
+
+// eventSocket streams the messages of the wait operation as JSON lines to all clients connected to
+// a Unix socket, so that other local processes can follow the wait operation without parsing its
+// output. Clients that connect late first receive all events sent before they connected.
+type eventSocket struct {
+	mu      sync.Mutex
+	ln      net.Listener
+	clients map[net.Conn]bool
+	history [][]byte
+	closed  bool
+
+	wg sync.WaitGroup
+}
+
+// listenEvents creates the socket at the given path and starts accepting clients. A socket left
+// behind at the path by a process that is no longer listening is replaced.
+func listenEvents(path string) (*eventSocket, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := eventSocket{ln: ln, clients: make(map[net.Conn]bool)}
+	s.wg.Add(1)
+	go s.accept()
+
+	return &s, nil
+}
+
+// removeStaleSocket removes the socket at the given path if no process listens on it anymore.
+// Anything else at the path is left as is.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return nil
+	}
+	conn, err := net.DialTimeout("unix", path, eventWriteTimeout)
+	if err == nil {
+		conn.Close()
+		return errors.New("socket is in use: " + path)
+	}
+	return os.Remove(path)
+}
+
+// accept adds connecting clients until the socket is closed.
+func (s *eventSocket) accept() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.clients[conn] = true
+		for _, line := range s.history {
+			if !s.write(conn, line) {
+				break
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// send streams the given message to all connected clients.
+func (s *eventSocket) send(msg wait.Message) {
+	line, err := json.Marshal(newEvent(msg))
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history = append(s.history, line)
+	for conn := range s.clients {
+		s.write(conn, line)
+	}
+}
+
+// write writes the given line to the given client, dropping the client if that fails. It returns
+// whether the client is still connected. It must be called with the lock held.
+func (s *eventSocket) write(conn net.Conn, line []byte) bool {
+	err := conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+	if err == nil {
+		_, err = conn.Write(line)
+	}
+	if err != nil {
+		conn.Close()
+		delete(s.clients, conn)
+		return false
+	}
+	return true
+}
+
+// close stops accepting clients, disconnects all connected clients, and removes the socket.
+func (s *eventSocket) close() {
+	s.mu.Lock()
+	s.closed = true
+	_ = s.ln.Close()
+	for conn := range s.clients {
+		conn.Close()
+		delete(s.clients, conn)
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
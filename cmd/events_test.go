@@ -0,0 +1,140 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/bow/wf/wait"
+)
+
+// readEvents reads the given number of events from the given client connection.
+func readEvents(t *testing.T, conn net.Conn, n int) []event {
+	t.Helper()
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var (
+		scanner = bufio.NewScanner(conn)
+		events  = make([]event, 0, n)
+	)
+	for len(events) < n && scanner.Scan() {
+		var ev event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatalf("test failed - invalid event %q: %s", scanner.Text(), err)
+		}
+		events = append(events, ev)
+	}
+	if len(events) != n {
+		t.Fatalf("test failed - want %d events, got %d: %v", n, len(events), scanner.Err())
+	}
+	return events
+}
+
+func TestEventSocket(t *testing.T) {
+	t.Parallel()
+
+	var (
+		path = filepath.Join(t.TempDir(), "wf.sock")
+		msgs = []wait.Message{
+			&stubMessage{status: wait.Start, target: "tcp://db:5432"},
+			&stubMessage{
+				status:   wait.Failed,
+				target:   "tcp://cache:6379",
+				err:      errors.New("stub"),
+				elapsed:  500 * time.Millisecond,
+				attempts: 2,
+			},
+			&stubMessage{
+				status:   wait.Ready,
+				target:   "tcp://db:5432",
+				elapsed:  1500 * time.Millisecond,
+				attempts: 3,
+			},
+		}
+		want = []event{
+			{Target: "tcp://db:5432", Status: wait.Start},
+			{
+				Target:         "tcp://cache:6379",
+				Status:         wait.Failed,
+				ElapsedSeconds: 0.5,
+				Attempts:       2,
+				Error:          "stub",
+			},
+			{Target: "tcp://db:5432", Status: wait.Ready, ElapsedSeconds: 1.5, Attempts: 3},
+		}
+	)
+
+	events, err := listenEvents(path)
+	if err != nil {
+		t.Fatalf("test failed - want no err, got: %s", err)
+	}
+	early, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("test failed - can not connect: %s", err)
+	}
+	defer early.Close()
+
+	events.send(msgs[0])
+	events.send(msgs[1])
+	// Clients that connect late receive the earlier events first.
+	late, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("test failed - can not connect: %s", err)
+	}
+	defer late.Close()
+	events.send(msgs[2])
+
+	for name, conn := range map[string]net.Conn{"early": early, "late": late} {
+		for i, got := range readEvents(t, conn, len(want)) {
+			if got != want[i] {
+				t.Errorf("test %s[%d] failed - want: %+v, got: %+v", name, i, want[i], got)
+			}
+		}
+	}
+
+	events.close()
+	if _, err := early.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("test failed - want client disconnected, got: %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("test failed - want socket removed, got: %v", err)
+	}
+}
+
+func TestListenEventsExistingSocket(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("test requires Unix socket files")
+	}
+
+	path := filepath.Join(t.TempDir(), "wf.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("test failed - can not listen: %s", err)
+	}
+
+	if _, err := listenEvents(path); err == nil {
+		t.Errorf("test in use failed - want err, got none")
+	}
+
+	// The socket is left behind, as by a process that was killed.
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	events, err := listenEvents(path)
+	if err != nil {
+		t.Fatalf("test stale failed - want no err, got: %s", err)
+	}
+	events.close()
+}
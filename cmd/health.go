@@ -0,0 +1,110 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bow/wf/wait"
+)
+
+// Values of the state of the wait operation, as served by the health endpoint.
+const (
+	healthWaiting = "waiting"
+	healthReady   = "ready"
+	healthFailed  = "failed"
+)
+
+// healthShutdownTimeout is how long in-flight requests to the health endpoint may take to finish
+// once the wait operation is done.
+const healthShutdownTimeout = time.Second
+
+// healthStatus is the snapshot of the wait operation served by the health endpoint.
+type healthStatus struct {
+	// State is the state of the whole wait operation, which ends in healthReady or healthFailed.
+	State string `json:"state"`
+	report
+}
+
+// selfHealth serves the status of the wait operation over HTTP, so that the liveness of `wf` itself
+// can be checked while it waits.
+type selfHealth struct {
+	mu       sync.Mutex
+	sum      *summary
+	state    string
+	err      error
+	timedOut bool
+
+	srv *http.Server
+}
+
+// newSelfHealth creates the health endpoint for the wait operation on the given targets.
+func newSelfHealth(targets []string) *selfHealth {
+	h := selfHealth{sum: newSummary(targets), state: healthWaiting}
+	h.srv = &http.Server{Handler: &h, ReadHeaderTimeout: 5 * time.Second}
+	return &h
+}
+
+// reset discards the results of previous rounds of the wait operation.
+func (h *selfHealth) reset(sum *summary) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sum = newSummary(sum.targets)
+	h.sum.unit = sum.unit
+	h.sum.slowAfter = sum.slowAfter
+}
+
+// add records the given message.
+func (h *selfHealth) add(msg wait.Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sum.add(msg)
+}
+
+// finish marks the wait operation as done, with the error that ended it, if any.
+func (h *selfHealth) finish(err error, timedOut bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.state = healthReady
+	if err != nil {
+		h.state = healthFailed
+	}
+	h.err = err
+	h.timedOut = timedOut
+}
+
+// ServeHTTP responds to every request with the current status of the wait operation as JSON.
+func (h *selfHealth) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	h.mu.Lock()
+	status := healthStatus{State: h.state, report: h.sum.report(h.err, h.timedOut)}
+	h.mu.Unlock()
+	// Without an error, the report counts as OK even while targets are still being waited.
+	status.OK = status.State == healthReady
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+// listen starts serving on the given address, e.g. `:8081`. It returns once the address is bound.
+func (h *selfHealth) listen(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() { _ = h.srv.Serve(ln) }()
+	return nil
+}
+
+// shutdown stops serving, waiting shortly for in-flight requests to finish.
+func (h *selfHealth) shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), healthShutdownTimeout)
+	defer cancel()
+	_ = h.srv.Shutdown(ctx)
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bow/wf/wait"
+)
+
+func TestSelfHealthServeHTTP(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name         string
+		finish       func(h *selfHealth)
+		wantState    string
+		wantStatuses []string
+	}{
+		{"waiting", func(*selfHealth) {}, healthWaiting, []string{"ready", "pending"}},
+		{
+			"ready",
+			func(h *selfHealth) {
+				h.add(&stubMessage{status: wait.Ready, target: "tcp://cache:6379", attempts: 1})
+				h.finish(nil, false)
+			},
+			healthReady,
+			[]string{"ready", "ready"},
+		},
+		{
+			"failed",
+			func(h *selfHealth) { h.finish(errors.New("stub"), true) },
+			healthFailed,
+			[]string{"ready", "timeout"},
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			h := newSelfHealth([]string{"tcp://db:5432", "tcp://cache:6379"})
+			h.add(&stubMessage{status: wait.Start, target: "tcp://db:5432"})
+			h.add(&stubMessage{status: wait.Ready, target: "tcp://db:5432", attempts: 2})
+			test.finish(h)
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rec.Code != http.StatusOK {
+				t.Errorf("test[%d] %q failed - want code: %d, got: %d", i, name, http.StatusOK, rec.Code)
+			}
+			var got healthStatus
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("test[%d] %q failed - invalid JSON: %s", i, name, err)
+			}
+			if got.State != test.wantState {
+				t.Errorf("test[%d] %q failed - want state: %q, got: %q", i, name, test.wantState, got.State)
+			}
+			if wantOK := test.wantState == healthReady; got.OK != wantOK {
+				t.Errorf("test[%d] %q failed - want ok: %t, got: %t", i, name, wantOK, got.OK)
+			}
+			if len(got.Targets) != len(test.wantStatuses) {
+				t.Fatalf(
+					"test[%d] %q failed - want %d targets, got: %d",
+					i, name, len(test.wantStatuses), len(got.Targets),
+				)
+			}
+			for j, want := range test.wantStatuses {
+				if got.Targets[j].Status != want {
+					t.Errorf(
+						"test[%d] %q failed - want targets[%d] status: %q, got: %q",
+						i, name, j, want, got.Targets[j].Status,
+					)
+				}
+			}
+		})
+	}
+}
+
+func TestSelfHealthListen(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("test failed - can not listen: %s", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	h := newSelfHealth([]string{"tcp://db:5432"})
+	if err := h.listen(addr); err != nil {
+		t.Fatalf("test failed - want no err, got: %s", err)
+	}
+	defer h.shutdown()
+
+	client := http.Client{Timeout: time.Second}
+	resp, err := client.Get("http://" + addr)
+	if err != nil {
+		t.Fatalf("test failed - want response, got: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("test failed - want code: %d, got: %d", http.StatusOK, resp.StatusCode)
+	}
+
+	// The address is already in use.
+	if err := newSelfHealth(nil).listen(addr); err == nil {
+		t.Errorf("test failed - want err, got none")
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/bow/wf/wait"
+)
+
+// maxHookProcs is the maximum number of hook commands that run at the same time, so that many
+// targets becoming ready at once do not spawn as many processes.
+const maxHookProcs = 4
+
+// readyHook runs a command for each target as soon as it is ready. Failures of the command are
+// logged, but do not affect the wait operation.
+type readyHook struct {
+	// args are the templates of the command name and its arguments, executed against a
+	// messageView.
+	args []*template.Template
+	// unit is the unit in which elapsed times are interpolated, as accepted by parseTimeUnit.
+	unit string
+	// stdout and stderr are where the output of the commands is written.
+	stdout, stderr io.Writer
+	// logf logs failures of the commands.
+	logf func(format string, a ...interface{})
+
+	sem chan struct{}
+	wg  sync.WaitGroup
+}
+
+// parseReadyHook parses the given hook command. The command is split into its name and arguments
+// on whitespace before each of them is parsed as an output template, so that interpolated values
+// are always passed as single arguments. The command is run directly, not through a shell.
+func parseReadyHook(rawCmd string) (*readyHook, error) {
+	fields := strings.Fields(rawCmd)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("invalid on-ready command: %q", rawCmd)
+	}
+
+	hook := readyHook{
+		args:   make([]*template.Template, len(fields)),
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+		logf:   func(string, ...interface{}) {},
+		sem:    make(chan struct{}, maxHookProcs),
+	}
+	for i, field := range fields {
+		tmpl, err := template.New("on-ready-exec").Parse(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid on-ready command: %s", err)
+		}
+		if err := tmpl.Execute(io.Discard, messageView{}); err != nil {
+			return nil, fmt.Errorf("invalid on-ready command: %s", err)
+		}
+		hook.args[i] = tmpl
+	}
+
+	return &hook, nil
+}
+
+// command returns the command name and arguments for the given message.
+func (h *readyHook) command(msg wait.Message) ([]string, error) {
+	args := make([]string, len(h.args))
+	for i, tmpl := range h.args {
+		arg, err := fmtMessage(tmpl, msg, h.unit)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = arg
+	}
+	return args, nil
+}
+
+// start runs the command for the given message in the background. It returns right away, even
+// if the maximum number of commands are already running.
+func (h *readyHook) start(msg wait.Message) {
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+
+		h.sem <- struct{}{}
+		defer func() { <-h.sem }()
+
+		args, err := h.command(msg)
+		if err != nil {
+			h.logf("on-ready command for %s failed: %s", msg.Target(), err)
+			return
+		}
+		proc := exec.Command(args[0], args[1:]...)
+		proc.Stdout = h.stdout
+		proc.Stderr = h.stderr
+		if err := proc.Run(); err != nil {
+			h.logf("on-ready command for %s failed: %s", msg.Target(), err)
+		}
+	}()
+}
+
+// wait blocks until all started commands have finished.
+func (h *readyHook) wait() {
+	h.wg.Wait()
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bow/wf/wait"
+)
+
+func TestParseReadyHook(t *testing.T) {
+	t.Parallel()
+
+	var (
+		msg = &stubMessage{
+			status:   wait.Ready,
+			target:   "tcp://db:5432",
+			elapsed:  1500 * time.Millisecond,
+			attempts: 3,
+		}
+		tests = []struct {
+			name    string
+			rawCmd  string
+			want    []string
+			wantErr string
+		}{
+			{"no template", "register.sh", []string{"register.sh"}, ""},
+			{
+				"templates",
+				"  register.sh --target {{.Target}}   {{.Elapsed}}/{{.Attempts}} ",
+				[]string{"register.sh", "--target", "tcp://db:5432", "1.5s/3"},
+				"",
+			},
+			{"empty", " ", nil, "invalid on-ready command: \" \""},
+			{
+				"unknown field",
+				"register.sh {{.Host}}",
+				nil,
+				"invalid on-ready command: template: on-ready-exec:1:2: executing \"on-ready-exec\" " +
+					"at <.Host>: can't evaluate field Host in type cmd.messageView",
+			},
+		}
+	)
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			wantErr := test.wantErr
+			hook, gotErr := parseReadyHook(test.rawCmd)
+
+			if (wantErr == "" && gotErr != nil) || (wantErr != "" && fmt.Sprint(gotErr) != wantErr) {
+				t.Fatalf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+			}
+			if wantErr != "" {
+				return
+			}
+			got, err := hook.command(msg)
+			if err != nil {
+				t.Fatalf("test[%d] %q failed - want no err, got: %s", i, name, err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, name, test.want, got)
+			}
+		})
+	}
+}
+
+func TestReadyHookStart(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("test hook command requires touch")
+	}
+
+	dir := t.TempDir()
+	hook, err := parseReadyHook("touch " + filepath.Join(dir, "{{.Target}}"))
+	if err != nil {
+		t.Fatalf("test failed - want no err, got: %s", err)
+	}
+	var (
+		mu     sync.Mutex
+		logged []string
+	)
+	hook.logf = func(format string, a ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		logged = append(logged, fmt.Sprintf(format, a...))
+	}
+
+	targets := make([]string, 3*maxHookProcs)
+	for i := range targets {
+		targets[i] = fmt.Sprintf("target-%d", i)
+		hook.start(&stubMessage{status: wait.Ready, target: targets[i]})
+	}
+	// The directory does not exist, so touch fails.
+	hook.start(&stubMessage{status: wait.Ready, target: "missing/target"})
+	hook.wait()
+
+	for _, target := range targets {
+		if _, err := os.Stat(filepath.Join(dir, target)); err != nil {
+			t.Errorf("test failed - want command run for %q, got: %s", target, err)
+		}
+	}
+	wantLog := "on-ready command for missing/target failed"
+	if len(logged) != 1 || !strings.HasPrefix(logged[0], wantLog) {
+		t.Errorf("test failed - want only %q logged, got: %q", wantLog, logged)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bow/wf/wait"
+)
+
+// byteSizeUnits are the units accepted by parseByteSize, with the number of bytes they stand for.
+// Longer units come first, so that `B` is only matched when no other unit is.
+var byteSizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// parseByteSize parses the given size, given as a whole number optionally followed by one of the
+// units B, KB, MB, or GB in any case, e.g. `10MB`. Units are powers of 1024 and sizes without a
+// unit are in bytes.
+func parseByteSize(rawSize string) (int64, error) {
+	var (
+		number = strings.ToUpper(strings.TrimSpace(rawSize))
+		unit   = int64(1)
+	)
+	for _, u := range byteSizeUnits {
+		if strings.HasSuffix(number, u.suffix) {
+			number, unit = strings.TrimSpace(strings.TrimSuffix(number, u.suffix)), u.size
+			break
+		}
+	}
+	size, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || size <= 0 || size > (1<<62)/unit {
+		return 0, fmt.Errorf("invalid size: %q", rawSize)
+	}
+	return size * unit, nil
+}
+
+// rotatingFile is a file that is renamed, with `.1` appended to its name, once writing to it would
+// exceed its maximum size. Writing then continues in a new, empty file. Only the last renamed file
+// is kept.
+type rotatingFile struct {
+	path string
+	// maxSize is the size in bytes beyond which the file is rotated. If zero, it is never rotated.
+	maxSize int64
+
+	f    *os.File
+	size int64
+}
+
+// openRotatingFile opens the file at the given path for appending, creating it if needed.
+func openRotatingFile(path string, maxSize int64) (*rotatingFile, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &rotatingFile{path: path, maxSize: maxSize, f: f, size: info.Size()}, nil
+}
+
+// Write writes the given bytes to the file, rotating it first if they do not fit. Writes are never
+// split across files, so files only exceed the maximum size if a single write does.
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate renames the current file and opens a new one in its place.
+func (rf *rotatingFile) rotate() error {
+	if err := rf.f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(rf.path, rf.path+".1"); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(rf.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	rf.f, rf.size = f, 0
+	return nil
+}
+
+// Close closes the current file.
+func (rf *rotatingFile) Close() error {
+	return rf.f.Close()
+}
+
+// messageEntry is the line of the log file for a message.
+type messageEntry struct {
+	Time time.Time `json:"time"`
+	// Kind is always `message`.
+	Kind string `json:"kind"`
+	event
+}
+
+// attemptEntry is the line of the log file for a connection attempt.
+type attemptEntry struct {
+	Time time.Time `json:"time"`
+	// Kind is always `attempt`.
+	Kind    string `json:"kind"`
+	Target  string `json:"target"`
+	Attempt int    `json:"attempt"`
+	Error   string `json:"error,omitempty"`
+}
+
+// eventLog writes all messages and connection attempts of the wait operation as JSON lines to a
+// rotating file. Failed writes are dropped, as the log must not hold up the wait operation.
+type eventLog struct {
+	mu sync.Mutex
+	rf *rotatingFile
+}
+
+// openEventLog opens the log at the given path, which is rotated beyond the given size in bytes.
+func openEventLog(path string, maxSize int64) (*eventLog, error) {
+	rf, err := openRotatingFile(path, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	return &eventLog{rf: rf}, nil
+}
+
+// message logs the given message.
+func (l *eventLog) message(msg wait.Message) {
+	l.write(messageEntry{Time: time.Now(), Kind: "message", event: newEvent(msg)})
+}
+
+// ObserveAttempt logs the given connection attempt.
+func (l *eventLog) ObserveAttempt(attempt wait.Attempt) {
+	entry := attemptEntry{
+		Time:    attempt.Time,
+		Kind:    "attempt",
+		Target:  attempt.Target,
+		Attempt: attempt.Number,
+	}
+	if attempt.Err != nil {
+		entry.Error = attempt.Err.Error()
+	}
+	l.write(entry)
+}
+
+// write writes the given entry as a single JSON line.
+func (l *eventLog) write(entry interface{}) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.rf.Write(append(line, '\n'))
+}
+
+// close closes the log file.
+func (l *eventLog) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_ = l.rf.Close()
+}
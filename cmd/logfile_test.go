@@ -0,0 +1,150 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bow/wf/wait"
+)
+
+func TestParseByteSize(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		in      string
+		want    int64
+		wantErr string
+	}{
+		{"512", 512, ""},
+		{"512B", 512, ""},
+		{"4kb", 4 << 10, ""},
+		{"10MB", 10 << 20, ""},
+		{" 2 GB ", 2 << 30, ""},
+		{"", 0, "invalid size: \"\""},
+		{"MB", 0, "invalid size: \"MB\""},
+		{"0MB", 0, "invalid size: \"0MB\""},
+		{"-1KB", 0, "invalid size: \"-1KB\""},
+		{"1.5MB", 0, "invalid size: \"1.5MB\""},
+		{"10MiB", 0, "invalid size: \"10MiB\""},
+		{"99999999999GB", 0, "invalid size: \"99999999999GB\""},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.in, func(t *testing.T) {
+			t.Parallel()
+
+			wantErr := test.wantErr
+			got, gotErr := parseByteSize(test.in)
+
+			if (wantErr == "" && gotErr != nil) || (wantErr != "" && fmt.Sprint(gotErr) != wantErr) {
+				t.Errorf("test[%d] %q failed - want err: %q, got: %v", i, test.in, wantErr, gotErr)
+			}
+			if got != test.want {
+				t.Errorf("test[%d] %q failed - want: %d, got: %d", i, test.in, test.want, got)
+			}
+		})
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "wf.log")
+	if err := os.WriteFile(path, []byte("old\n"), 0o600); err != nil {
+		t.Fatalf("test failed - can not write file: %s", err)
+	}
+
+	rf, err := openRotatingFile(path, 10)
+	if err != nil {
+		t.Fatalf("test failed - want no err, got: %s", err)
+	}
+	// The first write still fits after the existing content, the second does not, and the third
+	// exceeds the maximum size on its own.
+	for _, line := range []string{"one\n", "two\n", "three four\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatalf("test failed - want no err, got: %s", err)
+		}
+	}
+	if err := rf.Close(); err != nil {
+		t.Fatalf("test failed - want no err, got: %s", err)
+	}
+
+	for name, want := range map[string]string{path: "three four\n", path + ".1": "two\n"} {
+		got, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("test failed - can not read %s: %s", name, err)
+		}
+		if string(got) != want {
+			t.Errorf("test %s failed - want: %q, got: %q", filepath.Base(name), want, got)
+		}
+	}
+}
+
+func TestEventLog(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "wf.log")
+	evLog, err := openEventLog(path, 0)
+	if err != nil {
+		t.Fatalf("test failed - want no err, got: %s", err)
+	}
+	evLog.ObserveAttempt(wait.Attempt{
+		Target: "tcp://db:5432",
+		Number: 1,
+		Time:   time.Now(),
+		Err:    errors.New("stub"),
+	})
+	evLog.ObserveAttempt(wait.Attempt{Target: "tcp://db:5432", Number: 2, Time: time.Now()})
+	evLog.message(&stubMessage{
+		status:   wait.Ready,
+		target:   "tcp://db:5432",
+		elapsed:  1500 * time.Millisecond,
+		attempts: 2,
+	})
+	evLog.close()
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("test failed - can not read log: %s", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(raw), "\n"), "\n")
+	want := []map[string]interface{}{
+		{"kind": "attempt", "target": "tcp://db:5432", "attempt": 1.0, "error": "stub"},
+		{"kind": "attempt", "target": "tcp://db:5432", "attempt": 2.0},
+		{
+			"kind":            "message",
+			"target":          "tcp://db:5432",
+			"status":          "ready",
+			"elapsed_seconds": 1.5,
+			"attempts":        2.0,
+		},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("test failed - want %d lines, got: %q", len(want), lines)
+	}
+	for i, line := range lines {
+		var got map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("test lines[%d] failed - invalid JSON %q: %s", i, line, err)
+		}
+		if _, hasTime := got["time"]; !hasTime {
+			t.Errorf("test lines[%d] failed - want time, got: %q", i, line)
+		}
+		delete(got, "time")
+		if fmt.Sprint(got) != fmt.Sprint(want[i]) {
+			t.Errorf("test lines[%d] failed - want: %v, got: %v", i, want[i], got)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// rcFileName is the name of the defaults file looked up in the current directory.
+const rcFileName = ".wfrc"
+
+// rcExclusiveFlags are the groups of flags that can not be used together. Options of a defaults
+// file for a flag of such a group are skipped if another flag of the group is given on the command
+// line, so that the command line choice wins instead of conflicting with the file.
+var rcExclusiveFlags = [][]string{
+	{"verbose", "quiet", "quiet-ready", "silent", "count"},
+	{"once", "retry-on-error"},
+	{"proxy", "no-proxy"},
+}
+
+// rcOption is a single option of a defaults file.
+type rcOption struct {
+	// name is the long name of the flag whose default is set.
+	name string
+	// value is the default value of the flag, as given on the command line.
+	value string
+	// line is the 1-based line number of the option in the file.
+	line int
+}
+
+// rcPaths returns the paths at which a defaults file is looked up, in order of preference: `.wfrc`
+// in the current directory, and then `wf/config` in the user configuration directory, e.g.
+// `~/.config/wf/config` on Linux.
+func rcPaths() []string {
+	paths := []string{rcFileName}
+	if dir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, name, "config"))
+	}
+	return paths
+}
+
+// findRCFile returns the first of the given paths at which a file exists. If there is none, an
+// empty string is returned.
+func findRCFile(paths []string) (string, error) {
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if !info.IsDir() {
+			return path, nil
+		}
+	}
+	return "", nil
+}
+
+// parseRC parses the contents of a defaults file, which has one `<flag>=<value>` option per line,
+// where `<flag>` is the long name of a flag without the leading dashes. Whitespace around names
+// and values is trimmed, and empty lines and lines starting with `#` are skipped.
+func parseRC(r io.Reader) ([]rcOption, error) {
+	var (
+		opts    []rcOption
+		scanner = bufio.NewScanner(r)
+	)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		name, value, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("line %d: want FLAG=VALUE, got: %q", line, entry)
+		}
+		opts = append(opts, rcOption{
+			name:  strings.TrimSpace(name),
+			value: strings.TrimSpace(value),
+			line:  line,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// applyRC sets the flags of the given command to the values of the given options, except for
+// flags already given on the command line and flags that can not be used together with those, as
+// listed in rcExclusiveFlags. Options for flags of other commands, such as TCP options when waiting
+// on HTTP servers, are skipped. Flags set from the options count as changed afterwards, as if they
+// were given on the command line.
+func applyRC(cmd *cobra.Command, opts []rcOption) error {
+	var (
+		flagSet = cmd.Flags()
+		given   = make(map[string]bool)
+	)
+	// Flags set from earlier options must not exclude later ones, so only those given on the
+	// command line are recorded.
+	for _, group := range rcExclusiveFlags {
+		for _, name := range group {
+			given[name] = flagSet.Changed(name)
+		}
+	}
+
+	for _, opt := range opts {
+		if opt.name == "no-config" || opt.name == "help" || opt.name == "version" {
+			return fmt.Errorf("line %d: unknown option %q", opt.line, opt.name)
+		}
+		flag := flagSet.Lookup(opt.name)
+		if flag == nil {
+			if !hasFlag(cmd.Root(), opt.name) {
+				return fmt.Errorf("line %d: unknown option %q", opt.line, opt.name)
+			}
+			continue
+		}
+		if flag.Changed || excludedByGiven(opt.name, given) {
+			continue
+		}
+		if err := flagSet.Set(opt.name, opt.value); err != nil {
+			return fmt.Errorf("line %d: %s", opt.line, err)
+		}
+	}
+	return nil
+}
+
+// excludedByGiven checks whether a flag of the same group in rcExclusiveFlags as the flag with the
+// given long name is among the given flags.
+func excludedByGiven(name string, given map[string]bool) bool {
+	for _, group := range rcExclusiveFlags {
+		var inGroup, otherGiven bool
+		for _, other := range group {
+			if other == name {
+				inGroup = true
+			} else if given[other] {
+				otherGiven = true
+			}
+		}
+		if inGroup && otherGiven {
+			return true
+		}
+	}
+	return false
+}
+
+// hasFlag checks whether the given command or any of its subcommands has a flag with the given long
+// name.
+func hasFlag(cmd *cobra.Command, name string) bool {
+	if cmd.Flags().Lookup(name) != nil || cmd.PersistentFlags().Lookup(name) != nil {
+		return true
+	}
+	for _, sub := range cmd.Commands() {
+		if hasFlag(sub, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadRC applies the options of the first defaults file found at the given paths to the flags of
+// the given command. Nothing is done if there is no such file.
+func loadRC(cmd *cobra.Command, paths []string) error {
+	path, err := findRCFile(paths)
+	if err != nil || path == "" {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	opts, err := parseRC(f)
+	if err == nil {
+		err = applyRC(cmd, opts)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid defaults file %s: %s", path, err)
+	}
+	return nil
+}
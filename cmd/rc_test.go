@@ -0,0 +1,291 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func TestParseRC(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name    string
+		in      string
+		want    []rcOption
+		wantErr string
+	}{
+		{"empty", "", nil, ""},
+		{
+			"options, comments, and blank lines",
+			"# team defaults\ntimeout = 30s\n\npoll-freq=1s\n",
+			[]rcOption{{"timeout", "30s", 2}, {"poll-freq", "1s", 4}},
+			"",
+		},
+		{"no separator", "timeout 30s\n", nil, "line 1: want FLAG=VALUE, got: \"timeout 30s\""},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			wantErr := test.wantErr
+			got, gotErr := parseRC(strings.NewReader(test.in))
+
+			if (wantErr == "" && gotErr != nil) || (wantErr != "" && fmt.Sprint(gotErr) != wantErr) {
+				t.Fatalf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("test[%d] %q failed - want: %v, got: %v", i, name, test.want, got)
+			}
+		})
+	}
+}
+
+// newTestCommands creates a root command with an HTTP subcommand, as in Execute, and parses the
+// given arguments with the subcommand if isHTTP is true, or with the root command otherwise.
+func newTestCommands(t *testing.T, cfg *config, isHTTP bool, args []string) *cobra.Command {
+	t.Helper()
+
+	root := newCommand(cfg, modeTCP, name, desc)
+	addSharedFlags(root, cfg)
+	addTCPFlags(root, cfg)
+	httpCmd := newCommand(cfg, modeHTTP, "http", desc)
+	addHTTPFlags(httpCmd, cfg)
+	root.AddCommand(httpCmd)
+
+	cmd := root
+	if isHTTP {
+		cmd = httpCmd
+	}
+	if err := cmd.ParseFlags(args); err != nil {
+		t.Fatalf("failed parsing flags: %s", err)
+	}
+	return cmd
+}
+
+func TestApplyRC(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name         string
+		isHTTP       bool
+		args         []string
+		opts         []rcOption
+		wantTimeout  time.Duration
+		wantPollFreq time.Duration
+		wantErr      string
+	}{
+		{
+			"defaults from file",
+			false,
+			nil,
+			[]rcOption{{"timeout", "30s", 1}, {"poll-freq", "1s", 2}},
+			30 * time.Second,
+			1 * time.Second,
+			"",
+		},
+		{
+			"flag overrides file",
+			false,
+			[]string{"-t", "3s"},
+			[]rcOption{{"timeout", "30s", 1}, {"poll-freq", "1s", 2}},
+			3 * time.Second,
+			1 * time.Second,
+			"",
+		},
+		{
+			"option of other command",
+			true,
+			nil,
+			[]rcOption{{"family", "tcp4", 1}, {"timeout", "30s", 2}},
+			30 * time.Second,
+			500 * time.Millisecond,
+			"",
+		},
+		{
+			"unknown option",
+			false,
+			nil,
+			[]rcOption{{"colour", "always", 3}},
+			0,
+			0,
+			"line 3: unknown option \"colour\"",
+		},
+		{
+			"invalid value",
+			false,
+			nil,
+			[]rcOption{{"timeout", "soon", 1}},
+			0,
+			0,
+			"line 1: invalid argument \"soon\" for \"-t, --timeout\" flag: " +
+				"time: invalid duration \"soon\"",
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				cfg     config
+				name    = test.name
+				wantErr = test.wantErr
+				cmd     = newTestCommands(t, &cfg, test.isHTTP, test.args)
+				gotErr  = applyRC(cmd, test.opts)
+			)
+
+			if (wantErr == "" && gotErr != nil) || (wantErr != "" && fmt.Sprint(gotErr) != wantErr) {
+				t.Fatalf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+			}
+			if gotErr != nil {
+				return
+			}
+			if cfg.waitTimeout != test.wantTimeout {
+				t.Errorf("test[%d] %q failed - want: %s, got: %s", i, name, test.wantTimeout, cfg.waitTimeout)
+			}
+			if cfg.defaultPollFreq != test.wantPollFreq {
+				t.Errorf(
+					"test[%d] %q failed - want: %s, got: %s",
+					i,
+					name,
+					test.wantPollFreq,
+					cfg.defaultPollFreq,
+				)
+			}
+		})
+	}
+}
+
+func TestApplyRCExclusiveFlags(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name        string
+		args        []string
+		opts        []rcOption
+		wantVerbose bool
+		wantQuiet   bool
+		wantOnce    bool
+		wantErr     string
+	}{
+		{"file only", nil, []rcOption{{"quiet", "true", 1}}, false, true, false, ""},
+		{
+			"flag overrides file",
+			[]string{"--verbose"},
+			[]rcOption{{"quiet", "true", 1}, {"once", "true", 2}},
+			true,
+			false,
+			true,
+			"",
+		},
+		{
+			"flag overrides file in other group",
+			[]string{"--retry-on-error"},
+			[]rcOption{{"quiet", "true", 1}, {"once", "true", 2}},
+			false,
+			true,
+			false,
+			"",
+		},
+		{
+			"silent flag overrides file",
+			[]string{"--silent"},
+			[]rcOption{{"verbose", "true", 1}},
+			false,
+			false,
+			false,
+			"",
+		},
+		{
+			"count flag overrides file",
+			[]string{"--count"},
+			[]rcOption{{"quiet", "true", 1}, {"once", "true", 2}},
+			false,
+			false,
+			true,
+			"",
+		},
+		{
+			"conflicting options in file",
+			nil,
+			[]rcOption{{"quiet", "true", 1}, {"verbose", "true", 2}},
+			true,
+			true,
+			false,
+			"flags --verbose and --quiet can not be used together",
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				cfg     config
+				name    = test.name
+				wantErr = test.wantErr
+				cmd     = newTestCommands(t, &cfg, false, test.args)
+			)
+			if err := applyRC(cmd, test.opts); err != nil {
+				t.Fatalf("test[%d] %q failed - unexpected error: %s", i, name, err)
+			}
+			gotErr := cfg.validate()
+
+			if (wantErr == "" && gotErr != nil) || (wantErr != "" && fmt.Sprint(gotErr) != wantErr) {
+				t.Errorf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+			}
+			got := [3]bool{cfg.isVerbose, cfg.isQuiet, cfg.once}
+			if want := [3]bool{test.wantVerbose, test.wantQuiet, test.wantOnce}; got != want {
+				t.Errorf(
+					"test[%d] %q failed - want verbose, quiet, once: %v, got: %v",
+					i,
+					name,
+					want,
+					got,
+				)
+			}
+		})
+	}
+}
+
+func TestLoadRC(t *testing.T) {
+	t.Parallel()
+
+	var (
+		cfg     config
+		dir     = t.TempDir()
+		missing = filepath.Join(dir, rcFileName)
+		found   = filepath.Join(dir, "config")
+	)
+	if err := os.WriteFile(found, []byte("timeout=1m\n"), 0o600); err != nil {
+		t.Fatalf("failed writing defaults file: %s", err)
+	}
+
+	cmd := newTestCommands(t, &cfg, false, nil)
+	if err := loadRC(cmd, []string{missing, found}); err != nil {
+		t.Fatalf("test failed - unexpected error: %s", err)
+	}
+	if cfg.waitTimeout != time.Minute {
+		t.Errorf("test failed - want: %s, got: %s", time.Minute, cfg.waitTimeout)
+	}
+}
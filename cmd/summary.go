@@ -0,0 +1,246 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bow/wf/wait"
+)
+
+// targetResult is the final result of the wait operation on a single target.
+type targetResult struct {
+	status   wait.Status
+	elapsed  time.Duration
+	attempts int
+	err      error
+}
+
+// summary accumulates the final results of the wait operations on each target, for display after
+// all wait operations have finished.
+type summary struct {
+	// targets are the targets being waited, in the order they were given.
+	targets []string
+	// results are the final results of the targets, keyed by target.
+	results map[string]*targetResult
+	// elapsed is the elapsed time of the latest message.
+	elapsed time.Duration
+	// unit is the unit in which elapsed times are shown, as accepted by parseTimeUnit.
+	unit string
+	// slowAfter is how long targets may take to be ready before they are reported as slow. If
+	// zero, no targets are reported as slow.
+	slowAfter time.Duration
+}
+
+// newSummary creates an empty summary for the given targets. Duplicate targets, such as those of
+// specifications with the same name, are summarized once.
+func newSummary(targets []string) *summary {
+	var (
+		unique = make([]string, 0, len(targets))
+		seen   = make(map[string]bool, len(targets))
+	)
+	for _, target := range targets {
+		if !seen[target] {
+			seen[target] = true
+			unique = append(unique, target)
+		}
+	}
+	return &summary{targets: unique, results: make(map[string]*targetResult)}
+}
+
+// add records the given message if it is the final message of a target.
+func (s *summary) add(msg wait.Message) {
+	s.elapsed = msg.ElapsedTime()
+	if msg.Status() == wait.Start {
+		return
+	}
+	s.results[msg.Target()] = &targetResult{
+		status:   msg.Status(),
+		elapsed:  msg.ElapsedTime(),
+		attempts: msg.Attempts(),
+		err:      msg.Err(),
+	}
+}
+
+// isSlow returns whether a target with the given status and elapsed time was ready only after the
+// given threshold. If the threshold is zero, no target is slow.
+func isSlow(status wait.Status, elapsed, slowAfter time.Duration) bool {
+	return status == wait.Ready && slowAfter > 0 && elapsed > slowAfter
+}
+
+// totalAttempts returns the number of connection attempts made for all targets with results.
+// Attempts for targets without results are not known, so they are not counted.
+func (s *summary) totalAttempts() int {
+	total := 0
+	for _, res := range s.results {
+		total += res.attempts
+	}
+	return total
+}
+
+// readyCount returns the number of targets that are ready and the number of all targets.
+func (s *summary) readyCount() (int, int) {
+	ready := 0
+	for _, target := range s.targets {
+		if res, hasResult := s.results[target]; hasResult && res.status == wait.Ready {
+			ready++
+		}
+	}
+	return ready, len(s.targets)
+}
+
+// alreadyReadyWithin is how soon all targets must be ready for them to count as already ready when
+// the wait operation started.
+const alreadyReadyWithin = 100 * time.Millisecond
+
+// allAlreadyReady returns whether all targets were ready at their first attempt, all within
+// alreadyReadyWithin, meaning that nothing actually had to be waited.
+func (s *summary) allAlreadyReady() bool {
+	if s.elapsed >= alreadyReadyWithin {
+		return false
+	}
+	for _, target := range s.targets {
+		res, hasResult := s.results[target]
+		if !hasResult || res.status != wait.Ready || res.attempts > 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// plural returns the given count and noun, adding `s` to the noun unless the count is 1.
+func plural(count int, noun string) string {
+	if count == 1 {
+		return "1 " + noun
+	}
+	return strconv.Itoa(count) + " " + noun + "s"
+}
+
+// write writes the summary as an aligned table to the given writer, followed by a line with the
+// total number of attempts. Targets without results are marked as `TIMEOUT` if the wait operation
+// timed out, or as `PENDING` otherwise.
+func (s *summary) write(w io.Writer, timedOut bool) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TARGET\tSTATUS\tTIME\tATTEMPTS")
+
+	for _, target := range s.targets {
+		res, hasResult := s.results[target]
+		if !hasResult {
+			status := "PENDING"
+			if timedOut {
+				status = "TIMEOUT"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", target, status, fmtElapsedTime(s.elapsed, s.unit), "-")
+			continue
+		}
+		fmt.Fprintf(
+			tw,
+			"%s\t%s\t%s\t%s\n",
+			target,
+			res.status,
+			fmtElapsedTime(res.elapsed, s.unit),
+			strconv.Itoa(res.attempts),
+		)
+	}
+
+	tw.Flush()
+
+	fmt.Fprintf(
+		w,
+		"completed: %s across %s in %s\n",
+		plural(s.totalAttempts(), "attempt"),
+		plural(len(s.targets), "target"),
+		fmtElapsedTime(s.elapsed, s.unit),
+	)
+}
+
+// reportTarget is the final result of a single target in a report.
+type reportTarget struct {
+	Target         string  `json:"target"`
+	Status         string  `json:"status"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	Attempts       int     `json:"attempts"`
+	Slow           bool    `json:"slow,omitempty"`
+	Error          string  `json:"error,omitempty"`
+}
+
+// report is the machine-readable form of a summary.
+type report struct {
+	OK             bool           `json:"ok"`
+	ElapsedSeconds float64        `json:"elapsed_seconds"`
+	TotalAttempts  int            `json:"total_attempts"`
+	Error          string         `json:"error,omitempty"`
+	Targets        []reportTarget `json:"targets"`
+}
+
+// writeReport writes the summary as JSON to the given writer, along with whether the whole wait
+// operation succeeded and the error that ended it, if any. Targets without results are marked as
+// `timeout` if the wait operation timed out, or as `pending` otherwise.
+func (s *summary) writeReport(w io.Writer, err error, timedOut bool) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(s.report(err, timedOut))
+}
+
+// report creates the report of the summary, as written by writeReport.
+func (s *summary) report(err error, timedOut bool) report {
+	rep := report{
+		OK:             err == nil,
+		ElapsedSeconds: s.elapsed.Seconds(),
+		TotalAttempts:  s.totalAttempts(),
+		Targets:        make([]reportTarget, len(s.targets)),
+	}
+	if err != nil {
+		rep.Error = err.Error()
+	}
+
+	for i, target := range s.targets {
+		res, hasResult := s.results[target]
+		if !hasResult {
+			status := "pending"
+			if timedOut {
+				status = "timeout"
+			}
+			rep.Targets[i] = reportTarget{
+				Target:         target,
+				Status:         status,
+				ElapsedSeconds: s.elapsed.Seconds(),
+			}
+			continue
+		}
+		rep.Targets[i] = reportTarget{
+			Target:         target,
+			Status:         res.status.String(),
+			ElapsedSeconds: res.elapsed.Seconds(),
+			Attempts:       res.attempts,
+			Slow:           isSlow(res.status, res.elapsed, s.slowAfter),
+		}
+		if res.err != nil {
+			rep.Targets[i].Error = res.err.Error()
+		}
+	}
+
+	return rep
+}
+
+// writeReportFile writes the given summary as JSON to the file at the given path, overwriting it if
+// it exists.
+func writeReportFile(path string, s *summary, err error, timedOut bool) error {
+	f, ferr := os.Create(path)
+	if ferr != nil {
+		return ferr
+	}
+	if werr := s.writeReport(f, err, timedOut); werr != nil {
+		f.Close()
+		return werr
+	}
+	return f.Close()
+}
@@ -0,0 +1,270 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bow/wf/wait"
+)
+
+// stubMessage is a wait.Message with fixed values, for testing.
+type stubMessage struct {
+	status   wait.Status
+	target   string
+	err      error
+	elapsed  time.Duration
+	attempts int
+}
+
+func (msg *stubMessage) Status() wait.Status        { return msg.status }
+func (msg *stubMessage) Target() string             { return msg.target }
+func (msg *stubMessage) Err() error                 { return msg.err }
+func (msg *stubMessage) ElapsedTime() time.Duration { return msg.elapsed }
+func (msg *stubMessage) PendingTargets() []string   { return nil }
+func (msg *stubMessage) Attempts() int              { return msg.attempts }
+func (msg *stubMessage) Details() map[string]string { return map[string]string{} }
+
+func TestSummaryWrite(t *testing.T) {
+	t.Parallel()
+
+	var (
+		targets = []string{"tcp://db:5432", "tcp://cache:6379", "tcp://db:5432"}
+		msgs    = []wait.Message{
+			&stubMessage{status: wait.Start, target: "tcp://db:5432"},
+			&stubMessage{status: wait.Start, target: "tcp://cache:6379"},
+			&stubMessage{
+				status:   wait.Ready,
+				target:   "tcp://db:5432",
+				elapsed:  1500 * time.Millisecond,
+				attempts: 4,
+			},
+			&stubMessage{
+				status:  wait.Failed,
+				target:  "<none>",
+				err:     &wait.TimeoutError{Limit: 5 * time.Second},
+				elapsed: 5 * time.Second,
+			},
+		}
+		want = "TARGET            STATUS   TIME  ATTEMPTS\n" +
+			"tcp://db:5432     ready    1.5s  4\n" +
+			"tcp://cache:6379  TIMEOUT  5s    -\n" +
+			"completed: 4 attempts across 2 targets in 5s\n"
+	)
+
+	sum := newSummary(targets)
+	for _, msg := range msgs {
+		sum.add(msg)
+	}
+
+	var buf bytes.Buffer
+	sum.write(&buf, true)
+
+	if got := buf.String(); got != want {
+		t.Errorf("test failed - want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestSummaryReadyCount(t *testing.T) {
+	t.Parallel()
+
+	sum := newSummary([]string{"tcp://db:5432", "tcp://cache:6379", "file:///run/ready"})
+	for _, msg := range []wait.Message{
+		&stubMessage{status: wait.Ready, target: "tcp://db:5432"},
+		&stubMessage{status: wait.Failed, target: "tcp://cache:6379", err: errors.New("stub")},
+		&stubMessage{status: wait.Failed, target: "<all>", err: errors.New("stub")},
+	} {
+		sum.add(msg)
+	}
+
+	if ready, total := sum.readyCount(); ready != 1 || total != 3 {
+		t.Errorf("test failed - want: 1/3, got: %d/%d", ready, total)
+	}
+}
+
+func TestSummaryAllAlreadyReady(t *testing.T) {
+	t.Parallel()
+
+	var (
+		targets = []string{"tcp://db:5432", "tcp://cache:6379"}
+		ready   = func(target string, elapsed time.Duration, attempts int) wait.Message {
+			return &stubMessage{
+				status:   wait.Ready,
+				target:   target,
+				elapsed:  elapsed,
+				attempts: attempts,
+			}
+		}
+		tests = []struct {
+			name string
+			msgs []wait.Message
+			want bool
+		}{
+			{
+				"ready at first attempt",
+				[]wait.Message{
+					ready("tcp://db:5432", time.Millisecond, 1),
+					ready("tcp://cache:6379", 2*time.Millisecond, 1),
+				},
+				true,
+			},
+			{
+				"ready after retry",
+				[]wait.Message{
+					ready("tcp://db:5432", time.Millisecond, 1),
+					ready("tcp://cache:6379", 2*time.Millisecond, 2),
+				},
+				false,
+			},
+			{
+				"ready after threshold",
+				[]wait.Message{
+					ready("tcp://db:5432", time.Millisecond, 1),
+					ready("tcp://cache:6379", alreadyReadyWithin, 1),
+				},
+				false,
+			},
+			{"not all ready", []wait.Message{ready("tcp://db:5432", time.Millisecond, 1)}, false},
+		}
+	)
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			sum := newSummary(targets)
+			for _, msg := range test.msgs {
+				sum.add(msg)
+			}
+			if got := sum.allAlreadyReady(); got != test.want {
+				t.Errorf("test[%d] %q failed - want: %t, got: %t", i, test.name, test.want, got)
+			}
+		})
+	}
+}
+
+func TestSummaryWriteReport(t *testing.T) {
+	t.Parallel()
+
+	var (
+		targets    = []string{"tcp://db:5432", "tcp://cache:6379", "tcp://db:5432"}
+		timeoutErr = &wait.TimeoutError{Limit: 5 * time.Second}
+		msgs       = []wait.Message{
+			&stubMessage{status: wait.Start, target: "tcp://db:5432"},
+			&stubMessage{status: wait.Start, target: "tcp://cache:6379"},
+			&stubMessage{
+				status:   wait.Ready,
+				target:   "tcp://db:5432",
+				elapsed:  1500 * time.Millisecond,
+				attempts: 4,
+			},
+			&stubMessage{
+				status:  wait.Failed,
+				target:  "<none>",
+				err:     timeoutErr,
+				elapsed: 5 * time.Second,
+			},
+		}
+		want = `{
+  "ok": false,
+  "elapsed_seconds": 5,
+  "total_attempts": 4,
+  "error": "exceeded timeout limit of 5s",
+  "targets": [
+    {
+      "target": "tcp://db:5432",
+      "status": "ready",
+      "elapsed_seconds": 1.5,
+      "attempts": 4,
+      "slow": true
+    },
+    {
+      "target": "tcp://cache:6379",
+      "status": "timeout",
+      "elapsed_seconds": 5,
+      "attempts": 0
+    }
+  ]
+}
+`
+	)
+
+	sum := newSummary(targets)
+	sum.slowAfter = time.Second
+	for _, msg := range msgs {
+		sum.add(msg)
+	}
+
+	var buf bytes.Buffer
+	if err := sum.writeReport(&buf, timeoutErr, true); err != nil {
+		t.Fatalf("test failed - want no error, got: %s", err)
+	}
+
+	if got := buf.String(); got != want {
+		t.Errorf("test failed - want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestIsSlow(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name      string
+		status    wait.Status
+		elapsed   time.Duration
+		slowAfter time.Duration
+		want      bool
+	}{
+		{"slow", wait.Ready, 2 * time.Second, time.Second, true},
+		{"at threshold", wait.Ready, time.Second, time.Second, false},
+		{"fast", wait.Ready, 500 * time.Millisecond, time.Second, false},
+		{"no threshold", wait.Ready, time.Hour, 0, false},
+		{"failed", wait.Failed, 2 * time.Second, time.Second, false},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := isSlow(test.status, test.elapsed, test.slowAfter); got != test.want {
+				t.Errorf("test[%d] %q failed - want: %t, got: %t", i, test.name, test.want, got)
+			}
+		})
+	}
+}
+
+func TestPlural(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		count int
+		want  string
+	}{
+		{0, "0 targets"},
+		{1, "1 target"},
+		{42, "42 targets"},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.want, func(t *testing.T) {
+			t.Parallel()
+
+			if got := plural(test.count, "target"); got != test.want {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, test.want, test.want, got)
+			}
+		})
+	}
+}
@@ -3,11 +3,51 @@
 
 package cmd
 
-import "time"
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/bow/wf/wait"
+)
+
+// timeUnits are the units in which elapsed times can be shown. With `auto`, the unit is picked
+// according to the magnitude of each elapsed time.
+var timeUnits = map[string]bool{"auto": true, "ns": true, "ms": true, "s": true}
+
+// parseTimeUnit checks that the given unit is one of `auto`, `ns`, `ms`, or `s` and then returns
+// it.
+func parseTimeUnit(rawUnit string) (string, error) {
+	if !timeUnits[rawUnit] {
+		return "", fmt.Errorf("invalid time unit, want auto, ns, ms, or s: %q", rawUnit)
+	}
+	return rawUnit, nil
+}
+
+// fmtElapsedTime creates a string representation of the given message elapsed time in the given
+// unit. Nanoseconds and milliseconds are shown as whole numbers, e.g. `1523ms`, and seconds with at
+// most 2 digits after decimal, e.g. `1.52s`. For `auto` or an empty unit, the unit is picked
+// according to the magnitude of the time, so that it is more human-readable (max 2 digits after
+// decimal).
+func fmtElapsedTime(et time.Duration, unit string) string {
+	switch unit {
+	case "ns":
+		return strconv.FormatInt(et.Nanoseconds(), 10) + unit
+	case "ms":
+		return strconv.FormatInt(et.Round(time.Millisecond).Milliseconds(), 10) + unit
+	case "s":
+		return strconv.FormatFloat(et.Round(10*time.Millisecond).Seconds(), 'f', -1, 64) + unit
+	}
 
-// fmtElapsedTime creates a string representation of the given message elapsed time that is more
-// human-readable (max 2 digits after decimal).
-func fmtElapsedTime(et time.Duration) string {
 	// Sub-microsecond time needs no special formatting.
 	if et < time.Microsecond {
 		return et.String()
@@ -35,3 +75,411 @@ func fmtElapsedTime(et time.Duration) string {
 
 	return et.String()
 }
+
+// unescape interprets the Go escape sequences, such as `\r` and `\n`, in the given string.
+func unescape(s string) (string, error) {
+	return strconv.Unquote(`"` + strings.ReplaceAll(s, `"`, `\"`) + `"`)
+}
+
+// splitAddrs splits each of the given arguments on commas, so that a single argument may contain
+// multiple addresses. Whitespace around each address is trimmed and empty addresses are skipped.
+// Arguments with an `exec://` address are not split, as command lines may contain commas.
+func splitAddrs(args []string) []string {
+	addrs := make([]string, 0, len(args))
+	for _, arg := range args {
+		if trimmed := strings.TrimSpace(arg); wait.IsExecAddr(trimmed) {
+			addrs = append(addrs, trimmed)
+			continue
+		}
+		for _, addr := range strings.Split(arg, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+	return addrs
+}
+
+// expandAddrs replaces the `${VAR}` and `$VAR` references in each of the given arguments with the
+// values returned by the given lookup function. References to unset variables are replaced with
+// empty strings if allowUnset is true, and are errors otherwise.
+func expandAddrs(
+	args []string,
+	lookup func(string) (string, bool),
+	allowUnset bool,
+) ([]string, error) {
+	expanded := make([]string, 0, len(args))
+	for _, arg := range args {
+		var unset []string
+		value := os.Expand(arg, func(name string) string {
+			value, found := lookup(name)
+			if !found {
+				unset = append(unset, name)
+			}
+			return value
+		})
+		if len(unset) > 0 && !allowUnset {
+			return nil, fmt.Errorf("unset variable %q in address %q", unset[0], arg)
+		}
+		expanded = append(expanded, value)
+	}
+	return expanded, nil
+}
+
+// isToken checks whether the given string is an HTTP token, the syntax of both request methods and
+// header names: one or more visible ASCII characters other than delimiters.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r <= ' ' || r >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseMethod checks that the given HTTP request method is a valid token, such as `GET` or `HEAD`,
+// and then returns it.
+func parseMethod(rawMethod string) (string, error) {
+	if !isToken(rawMethod) {
+		return "", fmt.Errorf("invalid HTTP method: %q", rawMethod)
+	}
+	return rawMethod, nil
+}
+
+// parseHeader parses the given HTTP header entries, each given as `<key>: <value>`, into a header.
+// Whitespace around keys and values is trimmed, and repeated keys add values.
+func parseHeader(rawEntries []string) (http.Header, error) {
+	header := make(http.Header, len(rawEntries))
+	for _, entry := range rawEntries {
+		key, value, found := strings.Cut(entry, ":")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !found || !isToken(key) || strings.ContainsAny(value, "\r\n\x00") {
+			return nil, fmt.Errorf("invalid HTTP header, want KEY: VALUE, got: %q", entry)
+		}
+		header.Add(key, value)
+	}
+	return header, nil
+}
+
+// secureSchemes are the protocols whose servers are expected to speak TLS.
+var secureSchemes = map[string]bool{
+	"amqps":  true,
+	"https":  true,
+	"imaps":  true,
+	"ldaps":  true,
+	"pop3s":  true,
+	"rediss": true,
+	"smtps":  true,
+}
+
+// tlsWarning returns a warning that TLS is not verified for those of the given specifications whose
+// address has a secure protocol, e.g. `https://`, as only TCP connections are made. It returns an
+// empty string if there are no such specifications.
+func tlsWarning(specs []*wait.TCPSpec) string {
+	var (
+		schemes []string
+		seen    = make(map[string]bool)
+	)
+	for _, spec := range specs {
+		if secureSchemes[spec.Scheme] && !seen[spec.Scheme] {
+			seen[spec.Scheme] = true
+			schemes = append(schemes, spec.Scheme+"://")
+		}
+	}
+	if len(schemes) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(
+		"TLS is not verified for %s targets, only that their ports accept connections",
+		strings.Join(schemes, ", "),
+	)
+}
+
+// defaultHTTPPorts are the ports of HTTP URLs that do not give one, by scheme.
+var defaultHTTPPorts = map[string]string{"http": "80", "https": "443"}
+
+// endpointWarnings returns warnings for the hosts and ports that the given specifications target
+// with different protocols, e.g. `http://api:8080` and `https://api:8080`, which are likely copy
+// and paste mistakes. Addresses without a protocol are taken as `tcp://` ones. Warnings are in the
+// order in which their hosts and ports first appear, TCP specifications first.
+func endpointWarnings(tcpSpecs []*wait.TCPSpec, httpSpecs []*wait.HTTPSpec) []string {
+	var (
+		endpoints []string
+		schemes   = make(map[string][]string)
+	)
+	add := func(host, port, scheme string) {
+		endpoint := net.JoinHostPort(strings.ToLower(host), port)
+		seen, exists := schemes[endpoint]
+		if !exists {
+			endpoints = append(endpoints, endpoint)
+		}
+		for _, s := range seen {
+			if s == scheme {
+				return
+			}
+		}
+		schemes[endpoint] = append(seen, scheme)
+	}
+
+	for _, spec := range tcpSpecs {
+		scheme := strings.ToLower(spec.Scheme)
+		if scheme == "" {
+			scheme = "tcp"
+		}
+		add(spec.Host, spec.Port, scheme)
+	}
+	for _, spec := range httpSpecs {
+		scheme := strings.ToLower(spec.URL.Scheme)
+		port := spec.URL.Port()
+		if port == "" {
+			port = defaultHTTPPorts[scheme]
+		}
+		add(spec.URL.Hostname(), port, scheme)
+	}
+
+	var warnings []string
+	for _, endpoint := range endpoints {
+		if len(schemes[endpoint]) < 2 {
+			continue
+		}
+		warnings = append(
+			warnings,
+			fmt.Sprintf(
+				"%s is targeted with different protocols: %s://",
+				endpoint,
+				strings.Join(schemes[endpoint], "://, "),
+			),
+		)
+	}
+	return warnings
+}
+
+// fmtDetails creates a parenthesized, comma-separated list of the given message details, sorted by
+// their keys and prefixed with a space. If there are no details, an empty string is returned.
+func fmtDetails(details map[string]string) string {
+	if len(details) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(details))
+	for key := range details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	items := make([]string, len(keys))
+	for i, key := range keys {
+		items[i] = key + "=" + details[key]
+	}
+
+	return " (" + strings.Join(items, ", ") + ")"
+}
+
+// fmtConnectLatency formats the connection latency of the given message in the given unit, as
+// accepted by parseTimeUnit. It returns an empty string if the message has no connection latency.
+func fmtConnectLatency(msg wait.Message, unit string) string {
+	lm, hasLatency := msg.(interface{ ConnectLatency() time.Duration })
+	if !hasLatency || lm.ConnectLatency() <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (connect %s)", fmtElapsedTime(lm.ConnectLatency(), unit))
+}
+
+// tagPriority returns the given target, tagged with `[priority]` if it has priority according to
+// the given priorities, keyed by target.
+func tagPriority(target string, priorities map[string]int) string {
+	if priorities[target] > 0 {
+		return target + " [priority]"
+	}
+	return target
+}
+
+// sortByPriority returns a copy of the given targets sorted by their priorities, keyed by target,
+// from highest to lowest. Targets with the same priority keep their order.
+func sortByPriority(targets []string, priorities map[string]int) []string {
+	sorted := make([]string, len(targets))
+	copy(sorted, targets)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return priorities[sorted[i]] > priorities[sorted[j]]
+	})
+	return sorted
+}
+
+// envAddrs returns the `tcp://` addresses in the values of the given environment, given as
+// `<name>=<value>` entries, whose variable names start with the given prefix. This follows the
+// convention of linked containers, e.g. `DB_PORT=tcp://10.0.0.3:5432`. Variables whose values are
+// not `tcp://` addresses are ignored and duplicate addresses are only returned once, ordered by the
+// name of the first variable that contains them.
+func envAddrs(prefix string, environ []string) ([]string, error) {
+	sorted := make([]string, len(environ))
+	copy(sorted, environ)
+	sort.Strings(sorted)
+
+	var (
+		addrs []string
+		seen  = make(map[string]bool)
+	)
+	for _, entry := range sorted {
+		name, value, _ := strings.Cut(entry, "=")
+		if !strings.HasPrefix(name, prefix) || !strings.HasPrefix(value, "tcp://") {
+			continue
+		}
+		if _, err := wait.ParseTCPSpec(value, time.Second); err != nil {
+			return nil, fmt.Errorf("invalid address in %s: %s", name, err)
+		}
+		if !seen[value] {
+			seen[value] = true
+			addrs = append(addrs, value)
+		}
+	}
+
+	return addrs, nil
+}
+
+// parseDeadline parses the given deadline, which is either an RFC3339 timestamp or a duration
+// relative to the given time.
+func parseDeadline(rawDeadline string, now time.Time) (time.Time, error) {
+	if deadline, err := time.Parse(time.RFC3339, rawDeadline); err == nil {
+		return deadline, nil
+	}
+	offset, err := time.ParseDuration(rawDeadline)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid deadline, want RFC3339 time or duration: %q", rawDeadline)
+	}
+	return now.Add(offset), nil
+}
+
+// fmtAttempt creates a single-line description of the given connection attempt, with its time
+// given in local time up to milliseconds.
+func fmtAttempt(attempt wait.Attempt) string {
+	result := "ok"
+	if attempt.Err != nil {
+		result = attempt.Err.Error()
+	}
+	return fmt.Sprintf(
+		"%7s: %s #%d at %s: %s",
+		"attempt",
+		attempt.Target,
+		attempt.Number,
+		attempt.Time.Format("15:04:05.000"),
+		result,
+	)
+}
+
+// groupSpecs groups the given specifications by name, in the order of first appearance.
+// Specifications without names each form a group of their own, named after their target.
+func groupSpecs(specs []*wait.TCPSpec) []*wait.TCPGroup {
+	var (
+		groups []*wait.TCPGroup
+		byName = make(map[string]*wait.TCPGroup)
+	)
+	for _, spec := range specs {
+		if group, exists := byName[spec.Name]; exists && spec.Name != "" {
+			group.Specs = append(group.Specs, spec)
+			continue
+		}
+		group := &wait.TCPGroup{Name: spec.Target(), Specs: []*wait.TCPSpec{spec}}
+		byName[spec.Name] = group
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// asMessages forwards the messages of the given channel as wait.Message values, until the channel
+// is closed or the given context is done.
+func asMessages[M wait.Message](ctx context.Context, ch <-chan M) <-chan wait.Message {
+	out := make(chan wait.Message)
+	go func() {
+		defer close(out)
+		for msg := range ch {
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// mergeMessages forwards the messages of all given channels into a single channel, which is closed
+// after all of them are closed or the given context is done.
+func mergeMessages(ctx context.Context, chs ...<-chan wait.Message) <-chan wait.Message {
+	var (
+		wg  sync.WaitGroup
+		out = make(chan wait.Message)
+	)
+	wg.Add(len(chs))
+	for _, ch := range chs {
+		go func(ch <-chan wait.Message) {
+			defer wg.Done()
+			for msg := range ch {
+				select {
+				case out <- msg:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(ch)
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// messageView is the view of a wait message against which output templates are executed.
+type messageView struct {
+	// Status is the status of the message, e.g. `ready`.
+	Status string
+	// Target is the entity being waited.
+	Target string
+	// Elapsed is the human-readable duration of the wait operation at the time of the message.
+	Elapsed string
+	// Err is the error of the message, or an empty string if there is none.
+	Err string
+	// Attempts is the number of connection attempts made at the time of the message.
+	Attempts int
+}
+
+// newMessageView creates the template view of the given message, with its elapsed time shown in the
+// given unit.
+func newMessageView(msg wait.Message, unit string) messageView {
+	view := messageView{
+		Status:   msg.Status().String(),
+		Target:   msg.Target(),
+		Elapsed:  fmtElapsedTime(msg.ElapsedTime(), unit),
+		Attempts: msg.Attempts(),
+	}
+	if err := msg.Err(); err != nil {
+		view.Err = err.Error()
+	}
+	return view
+}
+
+// parseFormat parses the given output template. The template is also executed once against an
+// empty view, so that references to unknown fields are reported before any message is shown.
+func parseFormat(rawFormat string) (*template.Template, error) {
+	tmpl, err := template.New("format").Parse(rawFormat)
+	if err != nil {
+		return nil, fmt.Errorf("invalid format: %s", err)
+	}
+	if err := tmpl.Execute(io.Discard, messageView{}); err != nil {
+		return nil, fmt.Errorf("invalid format: %s", err)
+	}
+	return tmpl, nil
+}
+
+// fmtMessage executes the given output template against the given message, with its elapsed time
+// shown in the given unit.
+func fmtMessage(tmpl *template.Template, msg wait.Message, unit string) (string, error) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, newMessageView(msg, unit)); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
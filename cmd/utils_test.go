@@ -4,8 +4,14 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/bow/wf/wait"
 )
 
 func TestFmtElapsedTime(t *testing.T) {
@@ -37,7 +43,392 @@ func TestFmtElapsedTime(t *testing.T) {
 			t.Parallel()
 
 			want := test.want
-			got := fmtElapsedTime(test.in)
+			got := fmtElapsedTime(test.in, "auto")
+
+			if want != got {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, name, want, got)
+			}
+		})
+	}
+}
+
+func TestFmtElapsedTimeUnit(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		in   time.Duration
+		unit string
+		want string
+	}{
+		{1523456 * time.Microsecond, "ms", "1523ms"},
+		{1523656 * time.Microsecond, "ms", "1524ms"},
+		{400 * time.Microsecond, "ms", "0ms"},
+		{301 * time.Second, "ms", "301000ms"},
+		{1523456 * time.Microsecond, "s", "1.52s"},
+		{301 * time.Second, "s", "301s"},
+		{45 * time.Millisecond, "s", "0.05s"},
+		{24313 * time.Nanosecond, "ns", "24313ns"},
+		{24313 * time.Nanosecond, "", "24.31µs"},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+		name := test.in.String() + " in " + test.unit
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			want := test.want
+			got := fmtElapsedTime(test.in, test.unit)
+
+			if want != got {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, name, want, got)
+			}
+		})
+	}
+}
+
+func TestParseTimeUnit(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		in      string
+		wantErr bool
+	}{
+		{"auto", false},
+		{"ns", false},
+		{"ms", false},
+		{"s", false},
+		{"us", true},
+		{"", true},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.in, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseTimeUnit(test.in)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("test[%d] %q failed - want err: %t, got: %v", i, test.in, test.wantErr, err)
+			}
+			if err == nil && got != test.in {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, test.in, test.in, got)
+			}
+		})
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{`PING\r\n`, "PING\r\n", false},
+		{`say "hi"\n`, "say \"hi\"\n", false},
+		{`\x00\x01`, "\x00\x01", false},
+		{`bad\q`, "", true},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.in, func(t *testing.T) {
+			t.Parallel()
+
+			want := test.want
+			got, err := unescape(test.in)
+
+			if (err != nil) != test.wantErr {
+				t.Fatalf("test[%d] %q failed - want err: %t, got: %v", i, test.in, test.wantErr, err)
+			}
+			if want != got {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, test.in, want, got)
+			}
+		})
+	}
+}
+
+func TestParseMethod(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		in      string
+		wantErr bool
+	}{
+		{"HEAD", false},
+		{"PROPFIND", false},
+		{"GET /", true},
+		{"", true},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.in, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseMethod(test.in)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("test[%d] %q failed - want err: %t, got: %v", i, test.in, test.wantErr, err)
+			}
+			if err == nil && got != test.in {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, test.in, test.in, got)
+			}
+		})
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name    string
+		in      []string
+		want    string
+		wantErr string
+	}{
+		{"none", nil, "map[]", ""},
+		{
+			"canonicalized and trimmed",
+			[]string{"x-health-token:  s3cret ", "Host: api.internal"},
+			"map[Host:[api.internal] X-Health-Token:[s3cret]]",
+			"",
+		},
+		{
+			"repeated key",
+			[]string{"Accept: text/plain", "Accept: application/json"},
+			"map[Accept:[text/plain application/json]]",
+			"",
+		},
+		{"empty value", []string{"X-Empty:"}, "map[X-Empty:[]]", ""},
+		{
+			"no separator",
+			[]string{"Authorization Bearer x"},
+			"",
+			"invalid HTTP header, want KEY: VALUE, got: \"Authorization Bearer x\"",
+		},
+		{"no key", []string{": value"}, "", "invalid HTTP header, want KEY: VALUE, got: \": value\""},
+		{
+			"space in key",
+			[]string{"X Token: value"},
+			"",
+			"invalid HTTP header, want KEY: VALUE, got: \"X Token: value\"",
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			got, err := parseHeader(test.in)
+
+			if test.wantErr != "" {
+				if fmt.Sprint(err) != test.wantErr {
+					t.Errorf("test[%d] %q failed - want err: %q, got: %v", i, name, test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("test[%d] %q failed - unexpected error: %s", i, name, err)
+			}
+			if fmt.Sprint(got) != test.want {
+				t.Errorf("test[%d] %q failed - want: %s, got: %v", i, name, test.want, got)
+			}
+		})
+	}
+}
+
+func TestSplitAddrs(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name string
+		in   []string
+		want []string
+	}{
+		{"single", []string{"db:5432"}, []string{"db:5432"}},
+		{"separate args", []string{"db:5432", "cache:6379"}, []string{"db:5432", "cache:6379"}},
+		{
+			"comma-separated",
+			[]string{"db:5432, cache:6379 ,http://api", "[::1]:80"},
+			[]string{"db:5432", "cache:6379", "http://api", "[::1]:80"},
+		},
+		{"empty entries", []string{"db:5432,,", " "}, []string{"db:5432"}},
+		{
+			"command",
+			[]string{" exec://psql -c 'select 1, 2'", "db:5432"},
+			[]string{"exec://psql -c 'select 1, 2'", "db:5432"},
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			want := test.want
+			got := splitAddrs(test.in)
+
+			if strings.Join(want, "|") != strings.Join(got, "|") {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, name, want, got)
+			}
+		})
+	}
+}
+
+func TestExpandAddrs(t *testing.T) {
+	t.Parallel()
+
+	env := map[string]string{"DB_HOST": "10.0.0.3", "DB_PORT": "5432", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		value, found := env[name]
+		return value, found
+	}
+
+	var tests = []struct {
+		name       string
+		in         []string
+		allowUnset bool
+		want       []string
+		wantErr    string
+	}{
+		{"no references", []string{"db:5432"}, false, []string{"db:5432"}, ""},
+		{
+			"braced and bare",
+			[]string{"${DB_HOST}:$DB_PORT", "tcp://${DB_HOST}:6379"},
+			false,
+			[]string{"10.0.0.3:5432", "tcp://10.0.0.3:6379"},
+			"",
+		},
+		{"set but empty", []string{"db$EMPTY:5432"}, false, []string{"db:5432"}, ""},
+		{
+			"unset",
+			[]string{"${DB_HOST}:${MISSING}"},
+			false,
+			nil,
+			"unset variable \"MISSING\" in address \"${DB_HOST}:${MISSING}\"",
+		},
+		{"unset allowed", []string{"db:5432${MISSING}"}, true, []string{"db:5432"}, ""},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			want := test.want
+			wantErr := test.wantErr
+			got, gotErr := expandAddrs(test.in, lookup, test.allowUnset)
+
+			if (wantErr == "" && gotErr != nil) || (wantErr != "" && fmt.Sprint(gotErr) != wantErr) {
+				t.Fatalf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+			}
+			if strings.Join(want, "|") != strings.Join(got, "|") {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, name, want, got)
+			}
+		})
+	}
+}
+
+func TestFmtDetails(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name string
+		in   map[string]string
+		want string
+	}{
+		{"nil", nil, ""},
+		{"empty", map[string]string{}, ""},
+		{"single", map[string]string{"tls": "1.3"}, " (tls=1.3)"},
+		{
+			"sorted",
+			map[string]string{"tls": "1.3", "cert-expiry": "2025-06-01"},
+			" (cert-expiry=2025-06-01, tls=1.3)",
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			want := test.want
+			got := fmtDetails(test.in)
+
+			if want != got {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, name, want, got)
+			}
+		})
+	}
+}
+
+// latencyMessage is a stubMessage with a connection latency.
+type latencyMessage struct {
+	stubMessage
+	latency time.Duration
+}
+
+func (msg *latencyMessage) ConnectLatency() time.Duration { return msg.latency }
+
+func TestFmtConnectLatency(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name string
+		in   wait.Message
+		unit string
+		want string
+	}{
+		{"no latency", &stubMessage{status: wait.Ready}, "", ""},
+		{"zero latency", &latencyMessage{stubMessage{status: wait.Ready}, 0}, "", ""},
+		{
+			"latency",
+			&latencyMessage{stubMessage{status: wait.Ready}, 45 * time.Millisecond},
+			"",
+			" (connect 45ms)",
+		},
+		{
+			"latency in unit",
+			&latencyMessage{stubMessage{status: wait.Ready}, 45 * time.Millisecond},
+			"s",
+			" (connect 0.05s)",
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			want := test.want
+			got := fmtConnectLatency(test.in, test.unit)
 
 			if want != got {
 				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, name, want, got)
@@ -45,3 +436,330 @@ func TestFmtElapsedTime(t *testing.T) {
 		})
 	}
 }
+
+func TestTagPriority(t *testing.T) {
+	t.Parallel()
+
+	priorities := map[string]int{"tcp://db:5432": 1}
+	if got, want := tagPriority("tcp://db:5432", priorities), "tcp://db:5432 [priority]"; got != want {
+		t.Errorf("test priority failed - want: %q, got: %q", want, got)
+	}
+	if got, want := tagPriority("tcp://cache:6379", priorities), "tcp://cache:6379"; got != want {
+		t.Errorf("test no priority failed - want: %q, got: %q", want, got)
+	}
+}
+
+func TestSortByPriority(t *testing.T) {
+	t.Parallel()
+
+	var (
+		targets    = []string{"a", "b", "c", "d", "e"}
+		priorities = map[string]int{"c": 1, "e": 2, "d": 1}
+		want       = []string{"e", "c", "d", "a", "b"}
+		got        = sortByPriority(targets, priorities)
+	)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("test failed - want: %q, got: %q", want, got)
+	}
+	if targets[0] != "a" || targets[4] != "e" {
+		t.Errorf("test failed - want input unchanged, got: %q", targets)
+	}
+}
+
+func TestEnvAddrs(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name    string
+		prefix  string
+		in      []string
+		want    []string
+		wantErr string
+	}{
+		{"empty", "DB", nil, nil, ""},
+		{
+			"linked containers",
+			"DB",
+			[]string{
+				"DB_PORT_5432_TCP=tcp://10.0.0.3:5432",
+				"DB_PORT=tcp://10.0.0.3:5432",
+				"DB_PORT_5432_TCP_ADDR=10.0.0.3",
+				"DB_REPLICA_PORT=tcp://10.0.0.4:5432",
+				"CACHE_PORT=tcp://10.0.0.5:6379",
+				"PATH=/usr/bin",
+			},
+			[]string{"tcp://10.0.0.3:5432", "tcp://10.0.0.4:5432"},
+			"",
+		},
+		{
+			"malformed",
+			"DB",
+			[]string{"DB_PORT=tcp://10.0.0.3"},
+			nil,
+			"invalid address in DB_PORT: port not given and protocol is unknown: \"tcp\"",
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			want := test.want
+			got, gotErr := envAddrs(test.prefix, test.in)
+
+			if test.wantErr != "" {
+				if gotErr == nil || gotErr.Error() != test.wantErr {
+					t.Errorf("test[%d] %q failed - want err: %q, got: %v", i, name, test.wantErr, gotErr)
+				}
+				return
+			}
+			if gotErr != nil {
+				t.Fatalf("test[%d] %q failed - want no err, got: %q", i, name, gotErr)
+			}
+			if strings.Join(want, "|") != strings.Join(got, "|") {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, name, want, got)
+			}
+		})
+	}
+}
+
+func TestFmtAttempt(t *testing.T) {
+	t.Parallel()
+
+	var (
+		attemptTime = time.Date(2022, 1, 1, 12, 0, 1, 123456789, time.Local)
+		tests       = []struct {
+			name string
+			in   wait.Attempt
+			want string
+		}{
+			{
+				"success",
+				wait.Attempt{Target: "tcp://db:5432", Number: 3, Time: attemptTime},
+				"attempt: tcp://db:5432 #3 at 12:00:01.123: ok",
+			},
+			{
+				"error",
+				wait.Attempt{
+					Target: "tcp://db:5432",
+					Number: 1,
+					Time:   attemptTime,
+					Err:    fmt.Errorf("connection refused"),
+				},
+				"attempt: tcp://db:5432 #1 at 12:00:01.123: connection refused",
+			},
+		}
+	)
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			want := test.want
+			got := fmtAttempt(test.in)
+
+			if want != got {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, name, want, got)
+			}
+		})
+	}
+}
+
+func TestGroupSpecs(t *testing.T) {
+	t.Parallel()
+
+	specs := []*wait.TCPSpec{
+		{Name: "db", Host: "primary", Port: "5432"},
+		{Host: "cache", Port: "6379"},
+		{Name: "db", Host: "replica", Port: "5432"},
+		{Host: "queue", Port: "5672"},
+	}
+	want := []string{"db:2", "tcp://cache:6379:1", "tcp://queue:5672:1"}
+
+	groups := groupSpecs(specs)
+	got := make([]string, len(groups))
+	for i, group := range groups {
+		got[i] = fmt.Sprintf("%s:%d", group.Name, len(group.Specs))
+	}
+
+	if strings.Join(want, "|") != strings.Join(got, "|") {
+		t.Errorf("test failed - want: %q, got: %q", want, got)
+	}
+}
+
+func TestFmtMessage(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name    string
+		format  string
+		in      wait.Message
+		want    string
+		wantErr string
+	}{
+		{
+			"ready",
+			"{{.Status}} {{.Target}} {{.Elapsed}} {{.Attempts}}",
+			&stubMessage{
+				status:   wait.Ready,
+				target:   "tcp://db:5432",
+				elapsed:  1500 * time.Millisecond,
+				attempts: 4,
+			},
+			"ready tcp://db:5432 1.5s 4",
+			"",
+		},
+		{
+			"failed",
+			"{{.Target}}{{if .Err}}: {{.Err}}{{end}}",
+			&stubMessage{
+				status: wait.Failed,
+				target: "tcp://db:5432",
+				err:    errors.New("connection refused"),
+			},
+			"tcp://db:5432: connection refused",
+			"",
+		},
+		{
+			"unclosed action",
+			"{{.Target",
+			nil,
+			"",
+			"invalid format: template: format:1: unclosed action",
+		},
+		{
+			"unknown field",
+			"{{.Host}}",
+			nil,
+			"",
+			"invalid format: template: format:1:2: executing \"format\" at <.Host>: " +
+				"can't evaluate field Host in type cmd.messageView",
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			want := test.want
+			wantErr := test.wantErr
+
+			tmpl, gotErr := parseFormat(test.format)
+			if (wantErr == "" && gotErr != nil) || (wantErr != "" && fmt.Sprint(gotErr) != wantErr) {
+				t.Fatalf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+			}
+			if gotErr != nil {
+				return
+			}
+
+			got, err := fmtMessage(tmpl, test.in, "")
+			if err != nil {
+				t.Fatalf("test[%d] %q failed - unexpected error: %s", i, name, err)
+			}
+			if want != got {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, name, want, got)
+			}
+		})
+	}
+}
+
+func TestTLSWarning(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name  string
+		addrs []string
+		want  string
+	}{
+		{"plain", []string{"db:5432", "http://api", "redis://cache"}, ""},
+		{
+			"secure, repeated",
+			[]string{"HTTPS://api", "ldaps://dir", "https://web:8443"},
+			"TLS is not verified for https://, ldaps:// targets, " +
+				"only that their ports accept connections",
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			specs, err := wait.ParseTCPSpecs(test.addrs, time.Second)
+			if err != nil {
+				t.Fatalf("test[%d] %q failed - unexpected error: %s", i, name, err)
+			}
+			if got := tlsWarning(specs); got != test.want {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, name, test.want, got)
+			}
+		})
+	}
+}
+
+func TestEndpointWarnings(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name  string
+		mode  mode
+		addrs []string
+		want  []string
+	}{
+		{"distinct", modeAny, []string{"db:5432", "http://api:8080", "https://api"}, nil},
+		{"same protocol", modeAny, []string{"db:5432", "tcp://DB:5432", "http://api:80"}, nil},
+		{
+			"HTTP and HTTPS",
+			modeAny,
+			[]string{"http://api:8080", "db:5432", "https://api:8080/health"},
+			[]string{"api:8080 is targeted with different protocols: http://, https://"},
+		},
+		{
+			"TCP and HTTP",
+			modeAny,
+			[]string{"https://web", "tcp://web:443", "http://api", "tcp://api:80"},
+			[]string{
+				"web:443 is targeted with different protocols: tcp://, https://",
+				"api:80 is targeted with different protocols: tcp://, http://",
+			},
+		},
+		{
+			"TCP mode",
+			modeTCP,
+			[]string{"tcp://web:80", "http://web"},
+			[]string{"web:80 is targeted with different protocols: tcp://, http://"},
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			set, err := parseSpecs(test.addrs, &config{mode: test.mode, defaultPollFreq: time.Second})
+			if err != nil {
+				t.Fatalf("test[%d] %q failed - unexpected error: %s", i, name, err)
+			}
+			if got := endpointWarnings(set.tcp, set.http); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, name, test.want, got)
+			}
+		})
+	}
+}
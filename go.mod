@@ -2,9 +2,13 @@ module github.com/bow/wf
 
 go 1.18
 
-require github.com/spf13/cobra v1.1.1
+require (
+	github.com/spf13/cobra v1.1.1
+	golang.org/x/net v0.11.0
+)
 
 require (
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
+	golang.org/x/text v0.10.0 // indirect
 )
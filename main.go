@@ -20,6 +20,7 @@ import (
 func main() {
 	if err := cmd.Execute(); err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		// Errors from the command itself are always invalid command line usage.
+		os.Exit(2)
 	}
 }
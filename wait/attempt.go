@@ -0,0 +1,65 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// errProbeFailed is the error of connection attempts whose connection was made, but whose server
+// did not respond as expected.
+var errProbeFailed = errors.New("server did not respond as expected")
+
+// attemptsExhausted checks whether a wait operation that may make at most the given number of
+// attempts, where values below 1 mean no limit, has made all of them.
+func attemptsExhausted(maxAttempts, attempts int) bool {
+	return maxAttempts > 0 && attempts >= maxAttempts
+}
+
+// errAttemptsExhausted returns the error of wait operations that gave up after the given number
+// of attempts, the last of which failed with the given error.
+func errAttemptsExhausted(attempts int, err error) error {
+	return fmt.Errorf("gave up after %d attempts: %w", attempts, err)
+}
+
+// Attempt is the result of a single connection attempt of a wait operation.
+type Attempt struct {
+	// Target is the entity being waited.
+	Target string
+	// Number is the 1-based sequence number of the attempt within its wait operation.
+	Number int
+	// Time is when the attempt finished.
+	Time time.Time
+	// Err is the error of the attempt, or nil if it succeeded.
+	Err error
+}
+
+// AttemptObserver is the interface for receiving the result of every connection attempt. Wait
+// operations on different targets run concurrently, so implementations must be safe for
+// concurrent use when shared between specifications.
+type AttemptObserver interface {
+	// ObserveAttempt is called after each connection attempt, before the next one is made.
+	ObserveAttempt(Attempt)
+}
+
+// AttemptObserverFunc is an adapter to allow the use of ordinary functions as AttemptObservers.
+type AttemptObserverFunc func(Attempt)
+
+// ObserveAttempt calls the function with the given attempt.
+func (f AttemptObserverFunc) ObserveAttempt(attempt Attempt) {
+	f(attempt)
+}
+
+// observeAttempt reports the result of the given attempt of the specifications to its observer,
+// if it has one.
+func (spec *TCPSpec) observeAttempt(number int, err error) {
+	if spec.Observer == nil {
+		return
+	}
+	spec.Observer.ObserveAttempt(
+		Attempt{Target: spec.Target(), Number: number, Time: time.Now(), Err: err},
+	)
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"errors"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+// attemptRecorder is a test AttemptObserver that records all observed attempts.
+type attemptRecorder struct {
+	mu       sync.Mutex
+	attempts []Attempt
+}
+
+// ObserveAttempt records the given attempt.
+func (r *attemptRecorder) ObserveAttempt(attempt Attempt) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts = append(r.attempts, attempt)
+}
+
+func TestOneTCPObserver(t *testing.T) {
+	t.Parallel()
+
+	var (
+		recorder = &attemptRecorder{}
+		spec     = &TCPSpec{
+			Host:     "flaky.invalid",
+			Port:     "5000",
+			PollFreq: 50 * time.Millisecond,
+			Dialer:   &flakyDialer{refusals: 2},
+			Observer: recorder,
+		}
+	)
+
+	mb := newMessageBox(OneTCP(spec, 2*time.Second))
+	if status := mb.msgs[mb.count()-1].Status(); status != Ready {
+		t.Fatalf("test msgs[-1].Status() failed - want: %s, got: %s", Ready, status)
+	}
+
+	if n := len(recorder.attempts); n != 3 {
+		t.Fatalf("test failed - want %d attempts, got %d", 3, n)
+	}
+	for i, attempt := range recorder.attempts {
+		if attempt.Number != i+1 || attempt.Target != spec.Target() {
+			t.Errorf("test attempts[%d] failed - got: %+v", i, attempt)
+		}
+		if wantErr := i < 2; (attempt.Err != nil) != wantErr {
+			t.Errorf("test attempts[%d] failed - want err: %t, got: %v", i, wantErr, attempt.Err)
+		}
+	}
+}
+
+func TestOneTCPObserverProbeFailed(t *testing.T) {
+	t.Parallel()
+
+	var (
+		attempts []Attempt
+		mu       sync.Mutex
+		spec     = &TCPSpec{
+			Host:     "flaky.invalid",
+			Port:     "5000",
+			PollFreq: 50 * time.Millisecond,
+			Expect:   regexp.MustCompile("^READY"),
+			Dialer:   &flakyDialer{},
+			Observer: AttemptObserverFunc(func(attempt Attempt) {
+				mu.Lock()
+				defer mu.Unlock()
+				attempts = append(attempts, attempt)
+			}),
+		}
+	)
+
+	newMessageBox(OneTCP(spec, 200*time.Millisecond))
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(attempts) == 0 {
+		t.Fatalf("test failed - want at least 1 attempt, got 0")
+	}
+	if err := attempts[0].Err; !errors.Is(err, errProbeFailed) {
+		t.Errorf("test attempts[0] failed - want err: %q, got: %v", errProbeFailed, err)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cidrPrefix is the prefix of addresses that denote all hosts in a CIDR block.
+const cidrPrefix = "cidr:"
+
+// DefaultMaxCIDRHosts is the default maximum number of hosts that a CIDR address may expand to.
+const DefaultMaxCIDRHosts = 256
+
+var (
+	// maxCIDRHosts is the maximum number of hosts that a CIDR address may expand to.
+	maxCIDRHosts = DefaultMaxCIDRHosts
+	// maxCIDRHostsMu guards access to maxCIDRHosts.
+	maxCIDRHostsMu sync.RWMutex
+)
+
+// SetMaxCIDRHosts sets the maximum number of hosts that a CIDR address may expand to, guarding
+// against accidentally waiting on huge address ranges. It must be at least 1.
+func SetMaxCIDRHosts(n int) error {
+	if n < 1 {
+		return fmt.Errorf("maximum number of CIDR hosts must be at least 1, got: %d", n)
+	}
+
+	maxCIDRHostsMu.Lock()
+	defer maxCIDRHostsMu.Unlock()
+	maxCIDRHosts = n
+
+	return nil
+}
+
+// isCIDRAddr checks whether the given raw address denotes all hosts in a CIDR block.
+func isCIDRAddr(rawAddr string) bool {
+	return strings.HasPrefix(rawAddr, cidrPrefix)
+}
+
+// ParseCIDRSpecs parses the given address, in the form of `cidr:<prefix>:<port>`, into one TCPSpec
+// for each host address in the CIDR block `<prefix>`, e.g. `cidr:10.0.0.0/28:8080`. IPv6 blocks
+// must be enclosed in brackets, e.g. `cidr:[fd00::/120]:8080`. For IPv4 blocks larger than /31,
+// the network and broadcast addresses are excluded. The address may be followed by a poll
+// frequency, as in ParseTCPSpec. An error is returned if the block has more hosts than the maximum
+// set with SetMaxCIDRHosts.
+func ParseCIDRSpecs(rawAddr string, defaultPollFreq time.Duration) ([]*TCPSpec, error) {
+	if !isCIDRAddr(rawAddr) {
+		return nil, fmt.Errorf("not a CIDR address: %q", rawAddr)
+	}
+
+	rawBlock, rawFreq, hasFreq := strings.Cut(strings.TrimPrefix(rawAddr, cidrPrefix), "#")
+	if hasFreq {
+		freq, err := parsePollFreq(rawFreq)
+		if err != nil {
+			return nil, err
+		}
+		defaultPollFreq = freq
+	}
+	if err := checkPollFreq(defaultPollFreq); err != nil {
+		return nil, err
+	}
+
+	rawPrefix, port, err := net.SplitHostPort(rawBlock)
+	if err != nil {
+		return nil, err
+	}
+	if err := validatePort(port); err != nil {
+		return nil, err
+	}
+	prefix, err := netip.ParsePrefix(rawPrefix)
+	if err != nil {
+		return nil, err
+	}
+	prefix = prefix.Masked()
+
+	hosts, err := cidrHosts(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	specs := make([]*TCPSpec, len(hosts))
+	for i, host := range hosts {
+		specs[i] = &TCPSpec{Host: host.String(), Port: port, PollFreq: defaultPollFreq}
+	}
+
+	return specs, nil
+}
+
+// cidrHosts returns the host addresses in the given masked prefix, in ascending order.
+func cidrHosts(prefix netip.Prefix) ([]netip.Addr, error) {
+	maxCIDRHostsMu.RLock()
+	limit := maxCIDRHosts
+	maxCIDRHostsMu.RUnlock()
+
+	var (
+		hostBits     = prefix.Addr().BitLen() - prefix.Bits()
+		skipNetBcast = prefix.Addr().Is4() && hostBits > 1
+	)
+	// Anything with more than 2^30 addresses is beyond any sensible limit, and would overflow
+	// the count below on 32-bit platforms.
+	if hostBits > 30 {
+		return nil, fmt.Errorf("CIDR block %s has more than the maximum of %d hosts", prefix, limit)
+	}
+	count := 1 << hostBits
+	if skipNetBcast {
+		count -= 2
+	}
+	if count > limit {
+		return nil, fmt.Errorf(
+			"CIDR block %s has %d hosts, more than the maximum of %d",
+			prefix,
+			count,
+			limit,
+		)
+	}
+
+	hosts := make([]netip.Addr, 0, count)
+	addr := prefix.Addr()
+	if skipNetBcast {
+		addr = addr.Next()
+	}
+	for len(hosts) < count {
+		hosts = append(hosts, addr)
+		addr = addr.Next()
+	}
+
+	return hosts, nil
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCIDRSpecs(t *testing.T) {
+	t.Parallel()
+
+	var commonPollFreq = 1 * time.Second
+	var tests = []struct {
+		name      string
+		in        string
+		wantHosts []string
+		wantPort  string
+		wantFreq  time.Duration
+		wantErr   error
+	}{
+		{
+			"IPv4 /30",
+			"cidr:10.0.0.0/30:8080",
+			[]string{"10.0.0.1", "10.0.0.2"},
+			"8080",
+			commonPollFreq,
+			nil,
+		},
+		{
+			"IPv4 /31, unmasked, poll freq",
+			"cidr:10.0.0.7/31:80#2",
+			[]string{"10.0.0.6", "10.0.0.7"},
+			"80",
+			2 * time.Second,
+			nil,
+		},
+		{
+			"IPv4 /32",
+			"cidr:192.168.1.5/32:22",
+			[]string{"192.168.1.5"},
+			"22",
+			commonPollFreq,
+			nil,
+		},
+		{
+			"IPv6 /127",
+			"cidr:[fd00::/127]:443",
+			[]string{"fd00::", "fd00::1"},
+			"443",
+			commonPollFreq,
+			nil,
+		},
+		{
+			"no port",
+			"cidr:10.0.0.0/30",
+			nil,
+			"",
+			0,
+			fmt.Errorf("address 10.0.0.0/30: missing port in address"),
+		},
+		{
+			"zero port",
+			"cidr:10.0.0.0/30:0",
+			nil,
+			"",
+			0,
+			fmt.Errorf("invalid port \"0\""),
+		},
+		{
+			"invalid prefix",
+			"cidr:10.0.0.0:80",
+			nil,
+			"",
+			0,
+			fmt.Errorf("netip.ParsePrefix(\"10.0.0.0\"): no '/'"),
+		},
+		{
+			"too many hosts",
+			"cidr:10.0.0.0/23:80",
+			nil,
+			"",
+			0,
+			fmt.Errorf("CIDR block 10.0.0.0/23 has 510 hosts, more than the maximum of 256"),
+		},
+		{
+			"huge block",
+			"cidr:[fd00::/64]:80",
+			nil,
+			"",
+			0,
+			fmt.Errorf("CIDR block fd00::/64 has more than the maximum of 256 hosts"),
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			wantErr := test.wantErr
+			gotSpecs, gotErr := ParseCIDRSpecs(test.in, commonPollFreq)
+
+			if wantErr != nil {
+				if gotErr == nil || gotErr.Error() != wantErr.Error() {
+					t.Errorf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+				}
+				return
+			}
+			if gotErr != nil {
+				t.Fatalf("test[%d] %q failed - want no err, got: %q", i, name, gotErr)
+			}
+
+			gotHosts := make([]string, len(gotSpecs))
+			for j, spec := range gotSpecs {
+				gotHosts[j] = spec.Host
+				if spec.Port != test.wantPort || spec.PollFreq != test.wantFreq {
+					t.Errorf("test[%d][%d] %q failed - got spec: %+v", i, j, name, *spec)
+				}
+			}
+			want := strings.Join(test.wantHosts, ",")
+			if got := strings.Join(gotHosts, ","); got != want {
+				t.Errorf("test[%d] %q failed - want hosts: %q, got: %q", i, name, want, got)
+			}
+		})
+	}
+}
+
+func TestSetMaxCIDRHosts(t *testing.T) {
+	t.Parallel()
+
+	want := "maximum number of CIDR hosts must be at least 1, got: 0"
+	if err := SetMaxCIDRHosts(0); err == nil || err.Error() != want {
+		t.Errorf("test failed - want err: %q, got: %v", want, err)
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+)
+
+// resolvConfPath is the path of the resolver configuration on Unix-like systems.
+const resolvConfPath = "/etc/resolv.conf"
+
+// errNoResolver is the error of host name lookups made while no resolver is configured.
+var errNoResolver = errors.New("DNS resolution unavailable: no resolver configured")
+
+// ParseBindAddr parses the given IP address into a local TCP address from which connections can
+// originate. The port is always left unset, so that the operating system picks one. An error is
+// returned if the address is not assigned to any of the local network interfaces.
+func ParseBindAddr(rawAddr string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(rawAddr)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid bind address: %q", rawAddr)
+	}
+
+	ifaceAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, ifaceAddr := range ifaceAddrs {
+		if ipNet, isIPNet := ifaceAddr.(*net.IPNet); isIPNet && ipNet.IP.Equal(ip) {
+			return &net.TCPAddr{IP: ip}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("bind address is not a local address: %q", rawAddr)
+}
+
+// networks are the supported networks of TCP connections.
+var networks = map[string]bool{"tcp": true, "tcp4": true, "tcp6": true}
+
+// ParseNetwork checks that the given network is one of `tcp`, `tcp4`, or `tcp6` and then returns
+// it. The latter two restrict connections to IPv4 and IPv6, respectively.
+func ParseNetwork(rawNetwork string) (string, error) {
+	if !networks[rawNetwork] {
+		return "", fmt.Errorf("invalid network, want tcp, tcp4, or tcp6: %q", rawNetwork)
+	}
+	return rawNetwork, nil
+}
+
+// NewResolver creates a resolver that sends all DNS queries to the DNS server at the given address,
+// instead of those configured by the operating system. The address is given as `<host>:<port>`,
+// or as `<host>` for the default DNS port 53.
+func NewResolver(rawAddr string) (*net.Resolver, error) {
+	host, port, err := net.SplitHostPort(rawAddr)
+	if err != nil {
+		host, port = rawAddr, "53"
+	}
+	if host == "" {
+		return nil, fmt.Errorf("invalid resolver address: %q", rawAddr)
+	}
+	if num, err := strconv.Atoi(port); err != nil || num < 1 || num > 65535 {
+		return nil, fmt.Errorf("invalid resolver address: %q", rawAddr)
+	}
+	addr := net.JoinHostPort(host, port)
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}, nil
+}
+
+// Dialer is the interface for making connections to the servers being waited. It is satisfied by
+// *net.Dialer, which is also what is used when a TCPSpec does not set its own Dialer.
+type Dialer interface {
+	// DialContext connects to the address on the named network using the given context.
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// dialer returns the Dialer of the specifications, which makes connections from within its network
+// namespace if it has one.
+func (spec *TCPSpec) dialer() (Dialer, error) {
+	dialer, err := spec.baseDialer()
+	if err != nil || spec.NetNS == "" {
+		return dialer, err
+	}
+	return &netnsDialer{path: spec.NetNS, dialer: dialer}, nil
+}
+
+// baseDialer returns the Dialer of the specifications. If none is set, a *net.Dialer is created
+// from the local address and resolver of the specifications, wrapped in a proxy dialer if a proxy
+// server is set.
+func (spec *TCPSpec) baseDialer() (Dialer, error) {
+	if spec.Dialer != nil {
+		return spec.Dialer, nil
+	}
+
+	dialer := &net.Dialer{Resolver: spec.Resolver, KeepAlive: spec.TCPKeepAlive}
+	if spec.LocalAddr != nil {
+		dialer.LocalAddr = spec.LocalAddr
+	}
+	if spec.NetNS != "" {
+		// Fallback addresses are dialed on other goroutines, which are outside of the namespace.
+		dialer.FallbackDelay = -1
+	}
+	if spec.Proxy == nil {
+		return dialer, nil
+	}
+
+	return newProxyDialer(spec.Proxy, dialer)
+}
+
+// dial attempts a single connection to the address of the specifications using its dialer. The
+// attempt takes at most as long as the poll frequency, and is aborted as soon as the given context
+// is done.
+func (spec *TCPSpec) dial(ctx context.Context) (net.Conn, error) {
+	dialer, err := spec.dialer()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, spec.PollFreq)
+	defer cancel()
+
+	conn, err := dialer.DialContext(ctx, spec.network(), spec.Addr())
+	if err != nil {
+		return nil, spec.annotateLookupErr(err)
+	}
+	return conn, nil
+}
+
+// annotateLookupErr checks the given dial error for a missing resolver configuration, if the
+// specifications resolve host names with the system resolver. Other errors are returned as-is.
+func (spec *TCPSpec) annotateLookupErr(err error) error {
+	if spec.Dialer != nil || spec.Proxy != nil || spec.Resolver != nil {
+		return err
+	}
+	if runtime.GOOS == "windows" {
+		return err
+	}
+	return annotateDNSErr(err, resolvConfPath)
+}
+
+// annotateDNSErr replaces the given error with errNoResolver if it is a host name lookup error and
+// there is no resolver configuration at the given path, as in `scratch` container images. Lookups
+// then go to a nameserver on localhost, whose errors do not hint at the actual cause. Other errors
+// are returned as-is.
+func annotateDNSErr(err error, confPath string) error {
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) {
+		return err
+	}
+	if _, statErr := os.Stat(confPath); !errors.Is(statErr, fs.ErrNotExist) {
+		return err
+	}
+	return fmt.Errorf(
+		"%w, consider providing %s or setting a resolver (lookup error: %s)",
+		errNoResolver,
+		confPath,
+		dnsErr,
+	)
+}
+
+// network returns the network of the specifications, defaulting to `tcp` if none is set.
+func (spec *TCPSpec) network() string {
+	if spec.Network == "" {
+		return "tcp"
+	}
+	return spec.Network
+}
@@ -0,0 +1,933 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseBindAddr(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name    string
+		in      string
+		want    string
+		wantErr error
+	}{
+		{"loopback", "127.0.0.1", "127.0.0.1:0", nil},
+		{"not an IP", "localhost", "", fmt.Errorf("invalid bind address: \"localhost\"")},
+		{
+			"not local",
+			"192.0.2.1",
+			"",
+			fmt.Errorf("bind address is not a local address: \"192.0.2.1\""),
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			wantErr := test.wantErr
+			got, gotErr := ParseBindAddr(test.in)
+
+			if wantErr != nil {
+				if gotErr == nil || gotErr.Error() != wantErr.Error() {
+					t.Errorf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+				}
+				return
+			}
+			if gotErr != nil || got.String() != test.want {
+				t.Errorf("test[%d] %q failed - want: %q, got: %v", i, name, test.want, got)
+			}
+		})
+	}
+}
+
+func TestParseNetwork(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name    string
+		in      string
+		wantErr error
+	}{
+		{"any", "tcp", nil},
+		{"IPv4", "tcp4", nil},
+		{"IPv6", "tcp6", nil},
+		{"udp", "udp", fmt.Errorf("invalid network, want tcp, tcp4, or tcp6: \"udp\"")},
+		{"empty", "", fmt.Errorf("invalid network, want tcp, tcp4, or tcp6: \"\"")},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			wantErr := test.wantErr
+			got, gotErr := ParseNetwork(test.in)
+
+			if wantErr != nil {
+				if gotErr == nil || gotErr.Error() != wantErr.Error() {
+					t.Errorf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+				}
+				return
+			}
+			if gotErr != nil || got != test.in {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, name, test.in, got)
+			}
+		})
+	}
+}
+
+func TestDialNetwork(t *testing.T) {
+	t.Parallel()
+
+	server := &tcpServer{host: tcpServerHost, port: getLocalTCPPort(), t: t}
+	_, cancel := server.start(context.Background())
+	// Cleanup is used instead of defer so that the server outlives the parallel subtests.
+	t.Cleanup(cancel)
+	time.Sleep(100 * time.Millisecond)
+
+	var tests = []struct {
+		name    string
+		network string
+		wantErr bool
+	}{
+		{"default", "", false},
+		{"IPv4", "tcp4", false},
+		{"IPv6", "tcp6", true},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			spec := &TCPSpec{
+				Host:     server.host,
+				Port:     server.port,
+				PollFreq: 500 * time.Millisecond,
+				Network:  test.network,
+			}
+			conn, err := spec.dial(context.Background())
+			if err == nil {
+				conn.Close()
+			}
+			if (err != nil) != test.wantErr {
+				t.Errorf("test[%d] %q failed - want err: %t, got: %v", i, test.name, test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDialerTCPKeepAlive(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name      string
+		keepAlive time.Duration
+	}{
+		{"default", 0},
+		{"interval", 5 * time.Second},
+		{"disabled", -1},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			spec := &TCPSpec{Host: "localhost", Port: "5000", TCPKeepAlive: test.keepAlive}
+			dialer, err := spec.dialer()
+			if err != nil {
+				t.Fatalf("test[%d] %q failed - want no err, got: %s", i, test.name, err)
+			}
+			netDialer, isNetDialer := dialer.(*net.Dialer)
+			if !isNetDialer {
+				t.Fatalf("test[%d] %q failed - want *net.Dialer, got: %T", i, test.name, dialer)
+			}
+			if got := netDialer.KeepAlive; got != test.keepAlive {
+				t.Errorf("test[%d] %q failed - want: %s, got: %s", i, test.name, test.keepAlive, got)
+			}
+		})
+	}
+}
+
+func TestNewResolver(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name    string
+		in      string
+		wantErr error
+	}{
+		{"host and port", "127.0.0.1:8600", nil},
+		{"host only", "127.0.0.1", nil},
+		{"IPv6", "[::1]:53", nil},
+		{"no host", ":53", fmt.Errorf("invalid resolver address: \":53\"")},
+		{"invalid port", "127.0.0.1:dns", fmt.Errorf("invalid resolver address: \"127.0.0.1:dns\"")},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			wantErr := test.wantErr
+			got, gotErr := NewResolver(test.in)
+
+			if wantErr != nil {
+				if gotErr == nil || gotErr.Error() != wantErr.Error() {
+					t.Errorf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+				}
+				return
+			}
+			if gotErr != nil || got == nil {
+				t.Errorf("test[%d] %q failed - want resolver, got: %v, %v", i, name, got, gotErr)
+			}
+		})
+	}
+}
+
+func TestDialResolver(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu      sync.Mutex
+		queried bool
+		spec    = &TCPSpec{
+			Host:     "wf-resolver-test.example",
+			Port:     "80",
+			PollFreq: 500 * time.Millisecond,
+			Resolver: &net.Resolver{
+				PreferGo: true,
+				Dial: func(context.Context, string, string) (net.Conn, error) {
+					mu.Lock()
+					defer mu.Unlock()
+					queried = true
+					return nil, errors.New("stub resolver")
+				},
+			},
+		}
+	)
+
+	if conn, err := spec.dial(context.Background()); err == nil {
+		conn.Close()
+		t.Fatalf("test failed - want error, got none")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !queried {
+		t.Errorf("test failed - custom resolver was not used")
+	}
+}
+
+// failingResolver returns a resolver whose queries all fail, as when no nameserver is reachable.
+func failingResolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(context.Context, string, string) (net.Conn, error) {
+			return nil, errors.New("no nameserver")
+		},
+	}
+}
+
+func TestDialIPLiteralSkipsResolver(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(tcpServerHost, "0"))
+	if err != nil {
+		t.Fatalf("failed starting listener: %s", err)
+	}
+	defer listener.Close()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	spec := &TCPSpec{
+		Host:     tcpServerHost,
+		Port:     port,
+		PollFreq: 500 * time.Millisecond,
+		Resolver: failingResolver(),
+	}
+
+	conn, err := spec.dial(context.Background())
+	if err != nil {
+		t.Fatalf("test failed - unexpected error: %s", err)
+	}
+	conn.Close()
+}
+
+// loopbackInterface returns the name of the loopback network interface, skipping the test if there
+// is none.
+func loopbackInterface(t *testing.T) string {
+	t.Helper()
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Skipf("can not list network interfaces: %s", err)
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 && iface.Flags&net.FlagUp != 0 {
+			return iface.Name
+		}
+	}
+	t.Skip("no loopback network interface")
+	return ""
+}
+
+func TestDialIPv6Zone(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %s", err)
+	}
+	defer listener.Close()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	spec, err := ParseTCPSpec(
+		fmt.Sprintf("[::1%%%s]:%s", loopbackInterface(t), port),
+		500*time.Millisecond,
+	)
+	if err != nil {
+		t.Fatalf("test failed - unexpected error: %s", err)
+	}
+	// Addresses with zones are IP literals too, so they must not be looked up.
+	spec.Resolver = failingResolver()
+
+	conn, err := spec.dial(context.Background())
+	if err != nil {
+		t.Fatalf("test failed - unexpected error: %s", err)
+	}
+	conn.Close()
+}
+
+func TestOneTCPFailingResolver(t *testing.T) {
+	t.Parallel()
+
+	spec := &TCPSpec{
+		Host:     "wf-resolver-test.example",
+		Port:     "80",
+		PollFreq: 50 * time.Millisecond,
+		Resolver: failingResolver(),
+	}
+
+	mb := newMessageBox(OneTCP(spec, 2*time.Second))
+	if msgCount := mb.count(); msgCount != 2 {
+		t.Fatalf("test failed - want %d messages, got %d", 2, msgCount)
+	}
+
+	var dnsErr *net.DNSError
+	if msg := mb.msgs[1]; msg.Status() != Failed || !errors.As(msg.Err(), &dnsErr) {
+		t.Errorf(
+			"test msgs[1] failed - want: %s with DNS error, got: %s with %v",
+			Failed,
+			msg.Status(),
+			msg.Err(),
+		)
+	}
+	if elTime := mb.msgs[1].ElapsedTime(); elTime >= 1*time.Second {
+		t.Errorf("test failed - want failure before timeout, got it after %s", elTime)
+	}
+}
+
+func TestAnnotateDNSErr(t *testing.T) {
+	t.Parallel()
+
+	var (
+		dir        = t.TempDir()
+		presentCfg = filepath.Join(dir, "resolv.conf")
+		missingCfg = filepath.Join(dir, "missing.conf")
+		dnsErr     = &net.DNSError{Err: "server misbehaving", Name: "db", Server: "127.0.0.1:53"}
+		dialErr    = &net.OpError{Op: "dial", Net: "tcp", Err: dnsErr}
+		otherErr   = errors.New("connection reset")
+	)
+	if err := os.WriteFile(presentCfg, []byte("nameserver 10.0.0.2\n"), 0o600); err != nil {
+		t.Fatalf("failed writing resolver configuration: %s", err)
+	}
+
+	var tests = []struct {
+		name       string
+		err        error
+		confPath   string
+		wantNoConf bool
+	}{
+		{"lookup error, no configuration", dialErr, missingCfg, true},
+		{"lookup error, configuration", dialErr, presentCfg, false},
+		{"other error, no configuration", otherErr, missingCfg, false},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := annotateDNSErr(test.err, test.confPath)
+			if isNoConf := errors.Is(got, errNoResolver); isNoConf != test.wantNoConf {
+				t.Fatalf(
+					"test[%d] %q failed - want no resolver error: %t, got: %v",
+					i,
+					test.name,
+					test.wantNoConf,
+					got,
+				)
+			}
+			if !test.wantNoConf && got != test.err {
+				t.Errorf("test[%d] %q failed - want: %v, got: %v", i, test.name, test.err, got)
+			}
+		})
+	}
+}
+
+func TestDialLocalAddr(t *testing.T) {
+	t.Parallel()
+
+	var (
+		server = &tcpServer{host: tcpServerHost, port: getLocalTCPPort(), t: t}
+		spec   = &TCPSpec{
+			Host:      server.host,
+			Port:      server.port,
+			PollFreq:  500 * time.Millisecond,
+			LocalAddr: &net.TCPAddr{IP: net.ParseIP(tcpServerHost)},
+		}
+	)
+
+	_, cancel := server.start(context.Background())
+	defer cancel()
+	time.Sleep(100 * time.Millisecond)
+
+	conn, err := spec.dial(context.Background())
+	if err != nil {
+		t.Fatalf("test failed - want no error, got: %s", err)
+	}
+	defer conn.Close()
+
+	if got := conn.LocalAddr().(*net.TCPAddr).IP.String(); got != tcpServerHost {
+		t.Errorf("test failed - want local address: %q, got: %q", tcpServerHost, got)
+	}
+}
+
+// flakyDialer is a test Dialer that refuses a number of connections before accepting them.
+type flakyDialer struct {
+	mu       sync.Mutex
+	refusals int
+	attempts int
+	// err is returned in place of a connection refused error, if set.
+	err error
+}
+
+// DialContext refuses the connection until the number of refusals is exhausted, after which it
+// returns one end of an in-memory connection.
+func (d *flakyDialer) DialContext(_ context.Context, network, addr string) (net.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.attempts++
+	if d.attempts <= d.refusals {
+		if d.err != nil {
+			return nil, d.err
+		}
+		return nil, &net.OpError{
+			Op:  "dial",
+			Net: network,
+			Err: os.NewSyscallError("connect", syscall.ECONNREFUSED),
+		}
+	}
+	client, server := net.Pipe()
+	server.Close()
+
+	return client, nil
+}
+
+func TestOneTCPCustomDialer(t *testing.T) {
+	t.Parallel()
+
+	var (
+		dialer = &flakyDialer{refusals: 3}
+		spec   = &TCPSpec{
+			Host:     "flaky.invalid",
+			Port:     "5000",
+			PollFreq: 50 * time.Millisecond,
+			Dialer:   dialer,
+		}
+	)
+
+	mb := newMessageBox(OneTCP(spec, 2*time.Second))
+	if msgCount := mb.count(); msgCount != 2 {
+		t.Fatalf("test failed - want %d messages, got %d", 2, msgCount)
+	}
+	if status := mb.msgs[1].Status(); status != Ready {
+		t.Errorf("test msgs[1].Status() failed - want: %s, got %s", Ready, status)
+	}
+	if dialer.attempts != 4 {
+		t.Errorf("test failed - want %d attempts, got %d", 4, dialer.attempts)
+	}
+}
+
+func TestOneTCPFailOnNXDomain(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name       string
+		failOnNX   bool
+		isNotFound bool
+		wantErr    string
+	}{
+		{"not found, failing", true, true, "host not found: typo.example"},
+		{"not found, retrying", false, true, "exceeded timeout limit of 300ms"},
+		{"temporary, failing", true, false, "exceeded timeout limit of 300ms"},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			dnsErr := &net.DNSError{
+				Err:         "no such host",
+				Name:        "typo.example",
+				IsNotFound:  test.isNotFound,
+				IsTemporary: !test.isNotFound,
+			}
+			spec := &TCPSpec{
+				Host:           "typo.example",
+				Port:           "5000",
+				PollFreq:       20 * time.Millisecond,
+				RetryOnError:   true,
+				FailOnNXDomain: test.failOnNX,
+				Dialer: &flakyDialer{
+					refusals: 1000,
+					err:      &net.OpError{Op: "dial", Net: "tcp", Err: dnsErr},
+				},
+			}
+
+			mb := newMessageBox(OneTCP(spec, 300*time.Millisecond))
+			if msgCount := mb.count(); msgCount != 2 {
+				t.Fatalf("test[%d] %q failed - want %d messages, got %d", i, test.name, 2, msgCount)
+			}
+			msg := mb.msgs[1]
+			got := msg.Err()
+			if msg.Status() != Failed || !strings.HasPrefix(fmt.Sprint(got), test.wantErr) {
+				t.Errorf(
+					"test[%d] %q failed - want: %s with %q, got: %s with %v",
+					i,
+					test.name,
+					Failed,
+					test.wantErr,
+					msg.Status(),
+					got,
+				)
+			}
+		})
+	}
+}
+
+func TestOneTCPImmediate(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name     string
+		refusals int
+		want     bool
+	}{
+		{"already up", 0, true},
+		{"up after polling", 2, false},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			spec := &TCPSpec{
+				Host:     "flaky.invalid",
+				Port:     "5000",
+				PollFreq: 20 * time.Millisecond,
+				Dialer:   &flakyDialer{refusals: test.refusals},
+			}
+
+			mb := newMessageBox(OneTCP(spec, 2*time.Second))
+			if msgCount := mb.count(); msgCount != 2 {
+				t.Fatalf("test[%d] %q failed - want %d messages, got %d", i, test.name, 2, msgCount)
+			}
+			msg := mb.msgs[1].(*TCPMessage)
+			if msg.Status() != Ready {
+				t.Fatalf("test[%d] %q failed - want: %s, got: %s", i, test.name, Ready, msg.Status())
+			}
+			if got := msg.Immediate(); got != test.want {
+				t.Errorf("test[%d] %q failed - want: %t, got: %t", i, test.name, test.want, got)
+			}
+		})
+	}
+}
+
+// slowDialer is a test Dialer that takes a fixed duration before each dial of its wrapped Dialer.
+type slowDialer struct {
+	Dialer
+	delay time.Duration
+}
+
+// DialContext dials with the wrapped Dialer after the delay has passed.
+func (d *slowDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	time.Sleep(d.delay)
+	return d.Dialer.DialContext(ctx, network, addr)
+}
+
+func TestOneTCPConnectLatency(t *testing.T) {
+	t.Parallel()
+
+	var (
+		delay = 30 * time.Millisecond
+		spec  = &TCPSpec{
+			Host:     "flaky.invalid",
+			Port:     "5000",
+			PollFreq: 50 * time.Millisecond,
+			Dialer:   &slowDialer{Dialer: &flakyDialer{refusals: 2}, delay: delay},
+		}
+	)
+
+	mb := newMessageBox(OneTCP(spec, 2*time.Second))
+	if msgCount := mb.count(); msgCount != 2 {
+		t.Fatalf("test failed - want %d messages, got %d", 2, msgCount)
+	}
+	if got := mb.msgs[0].(*TCPMessage).ConnectLatency(); got != 0 {
+		t.Errorf("test msgs[0].ConnectLatency() failed - want: 0s, got: %s", got)
+	}
+	msg := mb.msgs[1].(*TCPMessage)
+	if msg.Status() != Ready {
+		t.Fatalf("test msgs[1].Status() failed - want: %s, got: %s", Ready, msg.Status())
+	}
+	// The latency covers only the last attempt, while the elapsed time covers all three.
+	if got := msg.ConnectLatency(); got < delay || got >= msg.ElapsedTime()-2*delay {
+		t.Errorf(
+			"test msgs[1].ConnectLatency() failed - want at least %s and well below %s, got: %s",
+			delay, msg.ElapsedTime(), got,
+		)
+	}
+}
+
+func TestOneTCPSkipImmediateCheck(t *testing.T) {
+	t.Parallel()
+
+	var (
+		pollFreq = 100 * time.Millisecond
+		dialer   = &flakyDialer{}
+		spec     = &TCPSpec{
+			Host:               "flaky.invalid",
+			Port:               "5000",
+			PollFreq:           pollFreq,
+			SkipImmediateCheck: true,
+			Dialer:             dialer,
+		}
+	)
+
+	mb := newMessageBox(OneTCP(spec, 2*time.Second))
+	if msgCount := mb.count(); msgCount != 2 {
+		t.Fatalf("test failed - want %d messages, got %d", 2, msgCount)
+	}
+	msg := mb.msgs[1].(*TCPMessage)
+	if msg.Status() != Ready || msg.Immediate() {
+		t.Errorf(
+			"test msgs[1] failed - want: %s after polling, got: %s (immediate: %t)",
+			Ready,
+			msg.Status(),
+			msg.Immediate(),
+		)
+	}
+	if elTime := msg.ElapsedTime(); elTime < pollFreq {
+		t.Errorf("test failed - want first attempt after %s, got it after %s", pollFreq, elTime)
+	}
+	if attempts := msg.Attempts(); attempts != 1 {
+		t.Errorf("test failed - want %d attempts, got %d", 1, attempts)
+	}
+}
+
+func TestSingleTCPReadyIsFinal(t *testing.T) {
+	t.Parallel()
+
+	var (
+		observed    int32
+		ctx, cancel = newContext(context.Background())
+		dialer      = &flakyDialer{refusals: 2}
+		spec        = &TCPSpec{
+			Host:     "flaky.invalid",
+			Port:     "5000",
+			PollFreq: 20 * time.Millisecond,
+			Dialer:   dialer,
+			Observer: AttemptObserverFunc(func(Attempt) { atomic.AddInt32(&observed, 1) }),
+		}
+	)
+	defer cancel()
+
+	readyCount := 0
+	for msg := range singleTCP(ctx, spec) {
+		if msg.Status() == Ready {
+			readyCount++
+		}
+	}
+	if readyCount != 1 {
+		t.Fatalf("test failed - want %d Ready message, got %d", 1, readyCount)
+	}
+
+	// Give a stray poll timer several intervals to fire.
+	time.Sleep(5 * spec.PollFreq)
+
+	dialer.mu.Lock()
+	attempts := dialer.attempts
+	dialer.mu.Unlock()
+
+	if attempts != 3 {
+		t.Errorf("test failed - want %d attempts, got %d", 3, attempts)
+	}
+	if got := atomic.LoadInt32(&observed); got != 3 {
+		t.Errorf("test failed - want %d observed attempts, got %d", 3, got)
+	}
+}
+
+func TestOneTCPRetryOnError(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name         string
+		retryOnError bool
+		want         Status
+	}{
+		{"no retry", false, Failed},
+		{"retry", true, Ready},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			spec := &TCPSpec{
+				Host:         "flaky.invalid",
+				Port:         "5000",
+				PollFreq:     50 * time.Millisecond,
+				RetryOnError: test.retryOnError,
+				Dialer:       &flakyDialer{refusals: 3, err: errors.New("no route to host")},
+			}
+
+			mb := newMessageBox(OneTCP(spec, 2*time.Second))
+			if msgCount := mb.count(); msgCount != 2 {
+				t.Fatalf("test[%d] %q failed - want %d messages, got %d", i, test.name, 2, msgCount)
+			}
+			if got := mb.msgs[1].Status(); got != test.want {
+				t.Errorf("test[%d] %q failed - want: %s, got: %s", i, test.name, test.want, got)
+			}
+		})
+	}
+}
+
+func TestOneTCPStrict(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name         string
+		strict       bool
+		retryOnError bool
+		err          error
+		wantStatus   Status
+		wantAttempts int
+	}{
+		{"refused", false, false, nil, Ready, 3},
+		{"strict refused", true, false, nil, Failed, 1},
+		{"strict refused with retry", true, true, nil, Failed, 1},
+		{"strict other error with retry", true, true, errors.New("no route to host"), Ready, 3},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			spec := &TCPSpec{
+				Host:         "flaky.invalid",
+				Port:         "5000",
+				PollFreq:     50 * time.Millisecond,
+				Strict:       test.strict,
+				RetryOnError: test.retryOnError,
+				Dialer:       &flakyDialer{refusals: 2, err: test.err},
+			}
+
+			mb := newMessageBox(OneTCP(spec, 2*time.Second))
+			last := mb.msgs[mb.count()-1]
+			if got := last.Status(); got != test.wantStatus {
+				t.Errorf("test[%d] %q failed - want: %s, got: %s", i, name, test.wantStatus, got)
+			}
+			if got := last.Attempts(); got != test.wantAttempts {
+				t.Errorf("test[%d] %q failed - want attempts: %d, got: %d", i, name, test.wantAttempts, got)
+			}
+		})
+	}
+}
+
+func TestOneTCPOnce(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name     string
+		refusals int
+		want     Status
+	}{
+		{"connected", 0, Ready},
+		{"refused", 1, Failed},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				dialer = &flakyDialer{refusals: test.refusals}
+				spec   = &TCPSpec{
+					Host:         "flaky.invalid",
+					Port:         "5000",
+					PollFreq:     10 * time.Millisecond,
+					RetryOnError: true,
+					Once:         true,
+					Dialer:       dialer,
+				}
+			)
+
+			mb := newMessageBox(OneTCP(spec, 2*time.Second))
+			if msgCount := mb.count(); msgCount != 2 {
+				t.Fatalf("test[%d] %q failed - want %d messages, got %d", i, test.name, 2, msgCount)
+			}
+			if got := mb.msgs[1].Status(); got != test.want {
+				t.Errorf("test[%d] %q failed - want: %s, got: %s", i, test.name, test.want, got)
+			}
+			if dialer.attempts != 1 {
+				t.Errorf(
+					"test[%d] %q failed - want %d attempts, got %d",
+					i,
+					test.name,
+					1,
+					dialer.attempts,
+				)
+			}
+		})
+	}
+}
+
+func TestOneTCPRetryOnErrorTimeout(t *testing.T) {
+	t.Parallel()
+
+	var (
+		dialErr = errors.New("no route to host")
+		spec    = &TCPSpec{
+			Host:         "flaky.invalid",
+			Port:         "5000",
+			PollFreq:     50 * time.Millisecond,
+			RetryOnError: true,
+			Dialer:       &flakyDialer{refusals: 1000, err: dialErr},
+		}
+	)
+
+	mb := newMessageBox(OneTCP(spec, 300*time.Millisecond))
+	if msgCount := mb.count(); msgCount != 2 {
+		t.Fatalf("test failed - want %d messages, got %d", 2, msgCount)
+	}
+
+	var timeoutErr *TimeoutError
+	if err := mb.msgs[1].Err(); !errors.As(err, &timeoutErr) {
+		t.Fatalf("test failed - want TimeoutError, got: %v", err)
+	}
+	if !errors.Is(timeoutErr, dialErr) {
+		t.Errorf("test failed - want last error: %q, got: %v", dialErr, timeoutErr.LastErr)
+	}
+	want := "exceeded timeout limit of 300ms with 1 target pending, last error: no route to host"
+	if got := timeoutErr.Error(); got != want {
+		t.Errorf("test failed - want: %q, got: %q", want, got)
+	}
+}
+
+// hangingDialer is a test Dialer whose connection attempts block until their context is done.
+type hangingDialer struct{}
+
+// DialContext blocks until the given context is done and then returns its error.
+func (hangingDialer) DialContext(ctx context.Context, _, _ string) (net.Conn, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestSingleTCPCancelDuringDial(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx, cancel = newContext(context.Background())
+		spec        = &TCPSpec{
+			Host:     "hanging.invalid",
+			Port:     "5000",
+			PollFreq: 10 * time.Second,
+			Dialer:   hangingDialer{},
+		}
+	)
+	defer cancel()
+
+	msgs := singleTCP(ctx, spec)
+	if msg := <-msgs; msg.Status() != Start {
+		t.Fatalf("test msgs[0].Status() failed - want: %s, got: %s", Start, msg.Status())
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	select {
+	case msg := <-msgs:
+		if msg.Status() != Failed || !errors.Is(msg.Err(), context.Canceled) {
+			t.Errorf(
+				"test msgs[1] failed - want: %s with %q, got: %s with %v",
+				Failed,
+				context.Canceled,
+				msg.Status(),
+				msg.Err(),
+			)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatalf("test failed - no message within 1s of cancellation")
+	}
+}
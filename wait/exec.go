@@ -0,0 +1,265 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// execScheme is the prefix of addresses that denote commands.
+const execScheme = "exec://"
+
+// ExecSpec represents the input specification of a single command wait operation, which is ready
+// once the command exits with status 0.
+type ExecSpec struct {
+	// Command is the command line as given, which is also the target of the wait operation.
+	Command string
+	// Args are the program and its arguments, as split from Command by ParseExecSpec. The program
+	// is run directly with these arguments, so that no shell interprets the command line. They are
+	// ignored if Shell is true.
+	Args []string
+	// Shell is whether Command is run by the shell, i.e. `sh -c` or `cmd /C` on Windows, instead of
+	// directly. This allows pipes, redirections, and variables in the command line, but also lets
+	// any shell syntax in it run, so it must only be set for trusted command lines.
+	Shell bool
+	// PollFreq is how often the command is run.
+	PollFreq time.Duration
+	// SkipImmediateCheck is whether the first run is made only after the first poll interval, as
+	// in TCPSpec.
+	SkipImmediateCheck bool
+	// Jitter is the maximum fraction by which each poll interval randomly deviates from PollFreq,
+	// as in TCPSpec.
+	Jitter float64
+	// JitterRand is the random number generator for Jitter, as in TCPSpec.
+	JitterRand *rand.Rand
+	// Timeout is how long each run of the command may take before it is killed and counted as not
+	// ready. If zero, the poll frequency is used.
+	Timeout time.Duration
+	// Once is whether the command is run only once. If true, the wait operation fails as soon as
+	// that run does not exit with status 0.
+	Once bool
+	// MaxAttempts is the maximum number of runs, after which the wait operation fails. Values below
+	// 1 mean no limit.
+	MaxAttempts int
+	// Priority is how prominently the target is presented, as in TCPSpec.
+	Priority int
+	// Observer receives the result of every run. If nil, runs are not reported.
+	Observer AttemptObserver
+}
+
+// Target returns the command line of the specifications, with `exec://` prepended.
+func (spec *ExecSpec) Target() string {
+	return execScheme + spec.Command
+}
+
+// pollTiming returns when the runs of the command are made.
+func (spec *ExecSpec) pollTiming() pollTiming {
+	return pollTiming{
+		freq:               spec.PollFreq,
+		jitter:             spec.Jitter,
+		jitterRand:         spec.JitterRand,
+		skipImmediateCheck: spec.SkipImmediateCheck,
+	}
+}
+
+// timeout returns how long each run of the command may take.
+func (spec *ExecSpec) timeout() time.Duration {
+	if spec.Timeout > 0 {
+		return spec.Timeout
+	}
+	return spec.PollFreq
+}
+
+// command creates the command of the specifications, which is killed once the given context is
+// done. Its output is discarded.
+func (spec *ExecSpec) command(ctx context.Context) *exec.Cmd {
+	if !spec.Shell {
+		return exec.CommandContext(ctx, spec.Args[0], spec.Args[1:]...)
+	}
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", spec.Command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", spec.Command)
+}
+
+// check runs the command once. It returns nil if the command exits with status 0. Otherwise, it
+// returns why the command is not ready, and whether the wait operation should go on, which is the
+// case unless the command can not be run at all.
+func (spec *ExecSpec) check(ctx context.Context) (bool, error) {
+	runCtx, cancel := context.WithTimeout(ctx, spec.timeout())
+	defer cancel()
+
+	err := spec.command(runCtx).Run()
+	if err == nil {
+		return false, nil
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false, err
+	}
+	if ctx.Err() == nil && runCtx.Err() != nil {
+		return true, fmt.Errorf("command timed out after %s", spec.timeout())
+	}
+	return true, fmt.Errorf("command exited with status %d", exitErr.ExitCode())
+}
+
+// observeAttempt reports the result of the given run of the specifications to its observer, if it
+// has one.
+func (spec *ExecSpec) observeAttempt(number int, err error) {
+	if spec.Observer == nil {
+		return
+	}
+	spec.Observer.ObserveAttempt(
+		Attempt{Target: spec.Target(), Number: number, Time: time.Now(), Err: err},
+	)
+}
+
+// IsExecAddr checks whether the given raw address denotes a command, i.e. starts with `exec://`.
+func IsExecAddr(rawAddr string) bool {
+	return strings.HasPrefix(rawAddr, execScheme)
+}
+
+// ParseExecSpec parses the given address, in the form of `exec://<command line>`, into an ExecSpec
+// and then returns a pointer to it, e.g. `exec://pg_isready -h db`. The command line is split into
+// the program and its arguments at whitespace, except within single or double quotes, and a
+// backslash outside of single quotes takes the next character literally. No other shell syntax is
+// interpreted. Since `#` is common in command lines, the poll frequency can not be given in the
+// address, and `defaultPollFreq` is always used.
+func ParseExecSpec(rawAddr string, defaultPollFreq time.Duration) (*ExecSpec, error) {
+	if !IsExecAddr(rawAddr) {
+		return nil, fmt.Errorf("not a command address: %q", rawAddr)
+	}
+	if err := checkPollFreq(defaultPollFreq); err != nil {
+		return nil, err
+	}
+
+	command := strings.TrimSpace(strings.TrimPrefix(rawAddr, execScheme))
+	args, err := splitCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("command not given: %q", rawAddr)
+	}
+
+	return &ExecSpec{Command: command, Args: args, PollFreq: defaultPollFreq}, nil
+}
+
+// splitCommand splits the given command line into words, as described in ParseExecSpec.
+func splitCommand(command string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range command {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in command: %q", command)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// ExecMessage is a container for wait operations on commands.
+type ExecMessage struct {
+	singleMessage
+	// spec is the wait operation specifications.
+	spec *ExecSpec
+}
+
+// newExecMessage creates a new ExecMessage with the given status and error.
+func newExecMessage(
+	spec *ExecSpec,
+	status Status,
+	startTime time.Time,
+	attempts int,
+	err error,
+) *ExecMessage {
+	return &ExecMessage{
+		singleMessage: newSingleMessage(status, startTime, attempts, err),
+		spec:          spec,
+	}
+}
+
+// Target returns the target of the wait operation, which is `exec://` prepended to the command
+// line.
+func (msg *ExecMessage) Target() string {
+	return msg.spec.Target()
+}
+
+// SingleExec waits until the command of the given specifications exits with status 0, running it
+// every poll frequency, until the given context is done. Commands exiting with other statuses or
+// running longer than their timeout are run again, while commands that can not be run at all, e.g.
+// because the program does not exist, fail the wait operation immediately. It returns a channel
+// through which a Start message and then a final Ready or Failed message is sent, after which the
+// channel is closed.
+func SingleExec(ctx context.Context, spec *ExecSpec) <-chan *ExecMessage {
+	var (
+		startTime = targetStartTimeFromContext(ctx)
+		attempts  = 0
+	)
+
+	cancelled := func() *ExecMessage {
+		return newExecMessage(spec, Failed, startTime, attempts, ctx.Err())
+	}
+
+	checkExec := func(bool) *ExecMessage {
+		attempts++
+		retry, err := spec.check(ctx)
+		if err == nil {
+			spec.observeAttempt(attempts, nil)
+			return newExecMessage(spec, Ready, startTime, attempts, nil)
+		}
+		// Runs killed by cancellation are reported as such, not as command errors.
+		if ctx.Err() != nil {
+			return cancelled()
+		}
+		spec.observeAttempt(attempts, err)
+		if retry && !spec.Once {
+			if !attemptsExhausted(spec.MaxAttempts, attempts) {
+				return nil
+			}
+			err = errAttemptsExhausted(attempts, err)
+		}
+		return newExecMessage(spec, Failed, startTime, attempts, err)
+	}
+
+	start := newExecMessage(spec, Start, startTime, 0, nil)
+	return poll(ctx, spec.pollTiming(), start, checkExec, cancelled)
+}
@@ -0,0 +1,214 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseExecSpec(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name     string
+		in       string
+		wantArgs []string
+		wantErr  string
+	}{
+		{"program only", "exec://true", []string{"true"}, ""},
+		{"arguments", "exec://pg_isready  -h db ", []string{"pg_isready", "-h", "db"}, ""},
+		{
+			"quotes",
+			`exec://sh -c 'test -e "$F"' "a b" c\ d`,
+			[]string{"sh", "-c", `test -e "$F"`, "a b", "c d"},
+			"",
+		},
+		{
+			"hash kept",
+			"exec://grep -q '#ready' /tmp/log",
+			[]string{"grep", "-q", "#ready", "/tmp/log"},
+			"",
+		},
+		{"empty quotes", `exec://echo ''`, []string{"echo", ""}, ""},
+		{"no command", "exec:// ", nil, "command not given: \"exec:// \""},
+		{
+			"unterminated quote",
+			"exec://echo 'ready",
+			nil,
+			"unterminated quote or escape in command: \"echo 'ready\"",
+		},
+		{"not a command", "file:///tmp/ready", nil, "not a command address: \"file:///tmp/ready\""},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			wantErr := test.wantErr
+			got, gotErr := ParseExecSpec(test.in, time.Second)
+
+			if (wantErr == "" && gotErr != nil) || (wantErr != "" && fmt.Sprint(gotErr) != wantErr) {
+				t.Fatalf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+			}
+			if gotErr != nil {
+				return
+			}
+			if !reflect.DeepEqual(got.Args, test.wantArgs) {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, name, test.wantArgs, got.Args)
+			}
+			if got.PollFreq != time.Second {
+				t.Errorf("test[%d] %q failed - want: %s, got: %s", i, name, time.Second, got.PollFreq)
+			}
+		})
+	}
+}
+
+// collectExecMessages collects all messages sent through the given channel.
+func collectExecMessages(ch <-chan *ExecMessage) []*ExecMessage {
+	var msgs []*ExecMessage
+	for msg := range ch {
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func TestSingleExec(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("test requires a POSIX shell")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("test requires a POSIX shell")
+	}
+
+	var tests = []struct {
+		name         string
+		command      string
+		shell        bool
+		timeout      time.Duration
+		wantStatus   Status
+		wantAttempts int
+		wantErr      string
+	}{
+		{"ready", "sh -c 'exit 0'", false, 0, Ready, 1, ""},
+		// The counter file is in a new temporary directory per test, replacing `{dir}`.
+		{
+			"ready on third run",
+			`n=$(cat "{dir}/n" 2>/dev/null); echo $((n+1)) > "{dir}/n"; [ "$n" = 2 ]`,
+			true,
+			0,
+			Ready,
+			3,
+			"",
+		},
+		{"not found", "wf-no-such-program", false, 0, Failed, 1, "executable file not found"},
+		{"exit status", "sh -c 'exit 3'", false, 0, Failed, 0, "command exited with status 3"},
+		{
+			"timed out",
+			"sleep 5",
+			false,
+			50 * time.Millisecond,
+			Failed,
+			0,
+			"command timed out after 50ms",
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			command := strings.ReplaceAll(test.command, "{dir}", t.TempDir())
+			spec, err := ParseExecSpec("exec://"+command, 20*time.Millisecond)
+			if err != nil {
+				t.Fatalf("test[%d] %q failed - unexpected error: %s", i, name, err)
+			}
+			spec.Shell = test.shell
+			spec.Timeout = test.timeout
+
+			var (
+				mu      sync.Mutex
+				lastErr error
+			)
+			spec.Observer = AttemptObserverFunc(func(attempt Attempt) {
+				mu.Lock()
+				defer mu.Unlock()
+				lastErr = attempt.Err
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+			defer cancel()
+
+			msgs := collectExecMessages(SingleExec(ctx, spec))
+			last := msgs[len(msgs)-1]
+
+			if status := last.Status(); status != test.wantStatus {
+				t.Fatalf(
+					"test[%d] %q failed - want: %s, got: %s (%v)",
+					i,
+					name,
+					test.wantStatus,
+					status,
+					last.Err(),
+				)
+			}
+			// Commands that are not ready are run again until the timeout.
+			if test.wantAttempts == 0 {
+				if last.Attempts() < 2 || !errors.Is(last.Err(), context.DeadlineExceeded) {
+					t.Errorf(
+						"test[%d] %q failed - want retries until timeout, got: %d attempts, %v",
+						i,
+						name,
+						last.Attempts(),
+						last.Err(),
+					)
+				}
+			} else if last.Attempts() != test.wantAttempts {
+				t.Errorf(
+					"test[%d] %q failed - want: %d attempts, got: %d",
+					i,
+					name,
+					test.wantAttempts,
+					last.Attempts(),
+				)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if got := fmt.Sprint(lastErr); test.wantErr != "" && !strings.Contains(got, test.wantErr) {
+				t.Errorf("test[%d] %q failed - want err: %q, got: %q", i, name, test.wantErr, got)
+			}
+		})
+	}
+}
+
+func TestExecSpecTarget(t *testing.T) {
+	t.Parallel()
+
+	spec, err := ParseExecSpec("exec:// pg_isready -h db", time.Second)
+	if err != nil {
+		t.Fatalf("test failed - unexpected error: %s", err)
+	}
+	if want, got := "exec://pg_isready -h db", spec.Target(); want != got {
+		t.Errorf("test failed - want: %q, got: %q", want, got)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// fileScheme is the prefix of addresses that denote files.
+const fileScheme = "file://"
+
+// errFileNotReady is the error of single-check file wait operations whose file is not ready.
+var errFileNotReady = errors.New("file is not ready")
+
+// FileSpec represents the input specification of a single file wait operation.
+type FileSpec struct {
+	// Path is the absolute path of the file being waited.
+	Path string
+	// PollFreq is how often the file is checked.
+	PollFreq time.Duration
+	// SkipImmediateCheck is whether the first check is made only after the first poll interval, as
+	// in TCPSpec.
+	SkipImmediateCheck bool
+	// Jitter is the maximum fraction by which each poll interval randomly deviates from PollFreq,
+	// as in TCPSpec.
+	Jitter float64
+	// JitterRand is the random number generator for Jitter, as in TCPSpec.
+	JitterRand *rand.Rand
+	// NonEmpty is whether the file must not be empty for it to be ready.
+	NonEmpty bool
+	// Contains is the pattern that the contents of the file must match for it to be ready. If nil,
+	// the contents are not checked.
+	Contains *regexp.Regexp
+	// Once is whether the file is checked only once. If true, the wait operation fails as soon as
+	// that check finds the file not ready.
+	Once bool
+	// MaxAttempts is the maximum number of checks, after which the wait operation fails. Values
+	// below 1 mean no limit.
+	MaxAttempts int
+	// Priority is how prominently the target is presented, as in TCPSpec.
+	Priority int
+}
+
+// Target returns the path of the specifications, with `file://` prepended.
+func (spec *FileSpec) Target() string {
+	return fileScheme + spec.Path
+}
+
+// pollTiming returns when the checks of the file are made.
+func (spec *FileSpec) pollTiming() pollTiming {
+	return pollTiming{
+		freq:               spec.PollFreq,
+		jitter:             spec.Jitter,
+		skipImmediateCheck: spec.SkipImmediateCheck,
+		jitterRand:         spec.JitterRand,
+	}
+}
+
+// check checks whether the file of the specifications is ready. Files that do not exist yet are
+// not ready, while other errors are returned as is.
+func (spec *FileSpec) check() (bool, error) {
+	info, err := os.Stat(spec.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if info.IsDir() {
+		return !spec.NonEmpty && spec.Contains == nil, nil
+	}
+	if spec.NonEmpty && info.Size() == 0 {
+		return false, nil
+	}
+	if spec.Contains == nil {
+		return true, nil
+	}
+
+	contents, err := os.ReadFile(spec.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return spec.Contains.Match(contents), nil
+}
+
+// IsFileAddr checks whether the given raw address denotes a file, i.e. starts with `file://`.
+func IsFileAddr(rawAddr string) bool {
+	return strings.HasPrefix(rawAddr, fileScheme)
+}
+
+// ParseFileSpec parses the given address, in the form of `file:///<path>`, into a FileSpec and
+// then returns a pointer to it. The conditions for the file to be ready can be given as query
+// parameters: `nonempty` requires the file to not be empty, and `contains=<pattern>` requires its
+// contents to match the given regular expression. As in ParseTCPSpec, the address may be followed
+// by a poll frequency after a `#` sign, and `defaultPollFreq` is used if it is not.
+func ParseFileSpec(rawAddr string, defaultPollFreq time.Duration) (*FileSpec, error) {
+	if !IsFileAddr(rawAddr) {
+		return nil, fmt.Errorf("not a file address: %q", rawAddr)
+	}
+
+	rawURL, rawFreq, hasFreq := strings.Cut(rawAddr, "#")
+	if hasFreq {
+		freq, err := parsePollFreq(rawFreq)
+		if err != nil {
+			return nil, err
+		}
+		defaultPollFreq = freq
+	}
+	if err := checkPollFreq(defaultPollFreq); err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		return nil, fmt.Errorf("file host must be empty or localhost: %q", u.Host)
+	}
+	if !strings.HasPrefix(u.Path, "/") {
+		return nil, fmt.Errorf("file path must be absolute: %q", rawURL)
+	}
+
+	spec := &FileSpec{Path: u.Path, PollFreq: defaultPollFreq}
+	for key, values := range u.Query() {
+		value := values[len(values)-1]
+		switch key {
+		case "nonempty":
+			spec.NonEmpty = value != "false"
+		case "contains":
+			if spec.Contains, err = regexp.Compile(value); err != nil {
+				return nil, fmt.Errorf("invalid contents pattern: %s", err)
+			}
+		default:
+			return nil, fmt.Errorf("unknown file condition: %q", key)
+		}
+	}
+
+	return spec, nil
+}
+
+// FileMessage is a container for wait operations on files.
+type FileMessage struct {
+	singleMessage
+	// spec is the wait operation specifications.
+	spec *FileSpec
+}
+
+// newFileMessage creates a new FileMessage with the given status and error.
+func newFileMessage(
+	spec *FileSpec,
+	status Status,
+	startTime time.Time,
+	attempts int,
+	err error,
+) *FileMessage {
+	return &FileMessage{
+		singleMessage: newSingleMessage(status, startTime, attempts, err),
+		spec:          spec,
+	}
+}
+
+// Target returns the target of the wait operation, which is `file://` prepended to the path.
+func (msg *FileMessage) Target() string {
+	return msg.spec.Target()
+}
+
+// SingleFile waits until the file of the given specifications is ready, checking it every poll
+// frequency, until the given context is done. It returns a channel through which a Start message
+// and then a final Ready or Failed message is sent, after which the channel is closed.
+func SingleFile(ctx context.Context, spec *FileSpec) <-chan *FileMessage {
+	var (
+		startTime = targetStartTimeFromContext(ctx)
+		attempts  = 0
+	)
+
+	cancelled := func() *FileMessage {
+		return newFileMessage(spec, Failed, startTime, attempts, ctx.Err())
+	}
+
+	checkFile := func(bool) *FileMessage {
+		attempts++
+		isReady, err := spec.check()
+		if err != nil {
+			return newFileMessage(spec, Failed, startTime, attempts, err)
+		}
+		if isReady {
+			return newFileMessage(spec, Ready, startTime, attempts, nil)
+		}
+		if spec.Once {
+			return newFileMessage(spec, Failed, startTime, attempts, errFileNotReady)
+		}
+		if attemptsExhausted(spec.MaxAttempts, attempts) {
+			err := errAttemptsExhausted(attempts, errFileNotReady)
+			return newFileMessage(spec, Failed, startTime, attempts, err)
+		}
+		return nil
+	}
+
+	start := newFileMessage(spec, Start, startTime, 0, nil)
+	return poll(ctx, spec.pollTiming(), start, checkFile, cancelled)
+}
@@ -0,0 +1,304 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestParseFileSpec(t *testing.T) {
+	t.Parallel()
+
+	var commonPollFreq = 1 * time.Second
+	var tests = []struct {
+		name     string
+		in       string
+		wantSpec *FileSpec
+		wantErr  error
+	}{
+		{
+			"path only",
+			"file:///run/ready",
+			&FileSpec{Path: "/run/ready", PollFreq: commonPollFreq},
+			nil,
+		},
+		{
+			"localhost, nonempty, poll freq",
+			"file://localhost/run/ready?nonempty#200ms",
+			&FileSpec{Path: "/run/ready", PollFreq: 200 * time.Millisecond, NonEmpty: true},
+			nil,
+		},
+		{
+			"contains",
+			"file:///run/ready?contains=^ok",
+			&FileSpec{
+				Path:     "/run/ready",
+				PollFreq: commonPollFreq,
+				Contains: regexp.MustCompile("^ok"),
+			},
+			nil,
+		},
+		{
+			"not a file",
+			"tcp://localhost:80",
+			nil,
+			fmt.Errorf("not a file address: \"tcp://localhost:80\""),
+		},
+		{
+			"remote host",
+			"file://server/run/ready",
+			nil,
+			fmt.Errorf("file host must be empty or localhost: \"server\""),
+		},
+		{
+			"zero poll freq",
+			"file:///run/ready#0",
+			nil,
+			fmt.Errorf("poll frequency must be positive, got: 0s"),
+		},
+		{
+			"unknown condition",
+			"file:///run/ready?size=1",
+			nil,
+			fmt.Errorf("unknown file condition: \"size\""),
+		},
+		{
+			"invalid pattern",
+			"file:///run/ready?contains=(",
+			nil,
+			fmt.Errorf("invalid contents pattern: error parsing regexp: missing closing ): `(`"),
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			wantSpec := test.wantSpec
+			wantErr := test.wantErr
+			gotSpec, gotErr := ParseFileSpec(test.in, commonPollFreq)
+
+			if wantErr != nil {
+				if gotErr == nil || gotErr.Error() != wantErr.Error() {
+					t.Errorf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+				}
+				return
+			}
+			if gotErr != nil {
+				t.Fatalf("test[%d] %q failed - want no err, got: %q", i, name, gotErr)
+			}
+			if gotSpec.Path != wantSpec.Path ||
+				gotSpec.PollFreq != wantSpec.PollFreq ||
+				gotSpec.NonEmpty != wantSpec.NonEmpty ||
+				fmt.Sprint(gotSpec.Contains) != fmt.Sprint(wantSpec.Contains) {
+				t.Errorf("test[%d] %q failed - want spec: %+v, got: %+v", i, name, *wantSpec, *gotSpec)
+			}
+		})
+	}
+}
+
+// collectFileMessages collects all messages from the given channel.
+func collectFileMessages(ch <-chan *FileMessage) []*FileMessage {
+	var msgs []*FileMessage
+	for msg := range ch {
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func TestSingleFileReady(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name     string
+		nonEmpty bool
+		contains *regexp.Regexp
+		writes   []string
+	}{
+		{"exists", false, nil, []string{""}},
+		{"nonempty", true, nil, []string{"", "x"}},
+		{"contains", false, regexp.MustCompile("(?m)^ready$"), []string{"starting\n", "ready\n"}},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				path = filepath.Join(t.TempDir(), "ready")
+				spec = &FileSpec{
+					Path:     path,
+					PollFreq: 50 * time.Millisecond,
+					NonEmpty: test.nonEmpty,
+					Contains: test.contains,
+				}
+				ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+			)
+			defer cancel()
+
+			msgs := SingleFile(ctx, spec)
+			if msg := <-msgs; msg.Status() != Start {
+				t.Fatalf("test[%d] %q failed - want: %s, got: %s", i, test.name, Start, msg.Status())
+			}
+
+			// Every write but the last must leave the file not ready yet.
+			for _, contents := range test.writes {
+				time.Sleep(200 * time.Millisecond)
+				if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+					t.Fatalf("test[%d] %q failed - can not write file: %s", i, test.name, err)
+				}
+			}
+
+			got := collectFileMessages(msgs)
+			if len(got) != 1 || got[0].Status() != Ready {
+				t.Fatalf("test[%d] %q failed - want 1 %s message, got: %v", i, test.name, Ready, got)
+			}
+			if got[0].Attempts() < len(test.writes) {
+				t.Errorf(
+					"test[%d] %q failed - want at least %d attempts, got: %d",
+					i,
+					test.name,
+					len(test.writes),
+					got[0].Attempts(),
+				)
+			}
+		})
+	}
+}
+
+func TestSingleFileCancelled(t *testing.T) {
+	t.Parallel()
+
+	var (
+		spec = &FileSpec{
+			Path:     filepath.Join(t.TempDir(), "never"),
+			PollFreq: 50 * time.Millisecond,
+		}
+		ctx, cancel = context.WithTimeout(context.Background(), 300*time.Millisecond)
+	)
+	defer cancel()
+
+	msgs := collectFileMessages(SingleFile(ctx, spec))
+	if len(msgs) != 2 {
+		t.Fatalf("test failed - want %d messages, got %d", 2, len(msgs))
+	}
+	if last := msgs[1]; last.Status() != Failed || !errors.Is(last.Err(), context.DeadlineExceeded) {
+		t.Errorf(
+			"test msgs[1] failed - want: %s with %q, got: %s with %v",
+			Failed,
+			context.DeadlineExceeded,
+			last.Status(),
+			last.Err(),
+		)
+	}
+	if target := msgs[0].Target(); target != "file://"+spec.Path {
+		t.Errorf("test msgs[0].Target() failed - want: %q, got: %q", "file://"+spec.Path, target)
+	}
+}
+
+func TestSingleFileSkipImmediateCheck(t *testing.T) {
+	t.Parallel()
+
+	var (
+		pollFreq = 100 * time.Millisecond
+		spec     = &FileSpec{
+			Path:               filepath.Join(t.TempDir(), "ready"),
+			PollFreq:           pollFreq,
+			SkipImmediateCheck: true,
+		}
+		ctx, cancel = context.WithTimeout(context.Background(), 2*time.Second)
+	)
+	defer cancel()
+
+	if err := os.WriteFile(spec.Path, nil, 0o600); err != nil {
+		t.Fatalf("test failed - can not write file: %s", err)
+	}
+
+	msgs := collectFileMessages(SingleFile(ctx, spec))
+	if len(msgs) != 2 {
+		t.Fatalf("test failed - want %d messages, got %d", 2, len(msgs))
+	}
+	if status := msgs[1].Status(); status != Ready {
+		t.Errorf("test msgs[1] failed - want: %s, got: %s", Ready, status)
+	}
+	if elTime := msgs[1].ElapsedTime(); elTime < pollFreq {
+		t.Errorf("test failed - want first check after %s, got it after %s", pollFreq, elTime)
+	}
+}
+
+func TestSingleFileOnce(t *testing.T) {
+	t.Parallel()
+
+	var (
+		spec = &FileSpec{
+			Path:     filepath.Join(t.TempDir(), "never"),
+			PollFreq: 10 * time.Second,
+			Once:     true,
+		}
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	)
+	defer cancel()
+
+	msgs := collectFileMessages(SingleFile(ctx, spec))
+	if len(msgs) != 2 {
+		t.Fatalf("test failed - want %d messages, got %d", 2, len(msgs))
+	}
+	if last := msgs[1]; last.Status() != Failed || !errors.Is(last.Err(), errFileNotReady) {
+		t.Errorf(
+			"test msgs[1] failed - want: %s with %q, got: %s with %v",
+			Failed,
+			errFileNotReady,
+			last.Status(),
+			last.Err(),
+		)
+	}
+	if attempts := msgs[1].Attempts(); attempts != 1 {
+		t.Errorf("test msgs[1].Attempts() failed - want: %d, got: %d", 1, attempts)
+	}
+}
+
+func TestSingleFileMaxAttempts(t *testing.T) {
+	t.Parallel()
+
+	var (
+		spec = &FileSpec{
+			Path:        filepath.Join(t.TempDir(), "never"),
+			PollFreq:    10 * time.Millisecond,
+			MaxAttempts: 3,
+		}
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	)
+	defer cancel()
+
+	msgs := collectFileMessages(SingleFile(ctx, spec))
+	if len(msgs) != 2 {
+		t.Fatalf("test failed - want %d messages, got %d", 2, len(msgs))
+	}
+	if last := msgs[1]; last.Status() != Failed || !errors.Is(last.Err(), errFileNotReady) {
+		t.Errorf(
+			"test msgs[1] failed - want: %s with %q, got: %s with %v",
+			Failed,
+			errFileNotReady,
+			last.Status(),
+			last.Err(),
+		)
+	}
+	if attempts := msgs[1].Attempts(); attempts != 3 {
+		t.Errorf("test msgs[1].Attempts() failed - want: %d, got: %d", 3, attempts)
+	}
+}
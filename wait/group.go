@@ -0,0 +1,208 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TCPGroup is a named group of redundant TCP input specifications, any of which being ready is
+// enough for the group to be ready.
+type TCPGroup struct {
+	// Name is the name of the group, used as the target of its messages.
+	Name string
+	// Specs are the specifications of the members of the group.
+	Specs []*TCPSpec
+}
+
+// GroupTCP waits until a connection can be made to at least one member of each of the given groups
+// for at most `waitTimeout` long. It returns a channel through which all wait operation-related
+// messages will be sent. Once a member of a group is ready, the wait operations on the remaining
+// members of that group are stopped and a Ready message whose target is the group name is sent. For
+// groups with a single member, the message of the member stands for the group. Otherwise, messages
+// of named members have the member name and address as their target, e.g.
+// `db=postgres://10.0.0.3:5432`, so that they are not mistaken for those of the group. Failed
+// messages of members are only sent once all members of their group failed, since the group may
+// still be ready until then. After all groups are ready, a final Ready message with `<all>` as its
+// target is sent. If all members of a group fail, their Failed messages are followed by a final
+// Failed message whose target is the group name. If the timeout limit is exceeded, the final Failed
+// message lists the groups that were not ready as pending. As in AllTCP, a `waitTimeout` of
+// NoTimeout waits without a timeout limit. Groups without members are invalid, in which case only
+// a Failed message is sent. The returned channel is closed after the final message. It must be
+// received from until then; use GroupTCPContext to be able to stop early.
+func GroupTCP(groups []*TCPGroup, waitTimeout time.Duration) <-chan *TCPMessage {
+	return GroupTCPContext(context.Background(), groups, waitTimeout)
+}
+
+// GroupTCPContext is GroupTCP with a parent context, whose cancellation stops all wait operations
+// and closes the returned channel, as in AllTCPContext.
+func GroupTCPContext(
+	parent context.Context,
+	groups []*TCPGroup,
+	waitTimeout time.Duration,
+) <-chan *TCPMessage {
+	var (
+		out         = make(chan *TCPMessage)
+		ctx, cancel = newContext(parent)
+	)
+
+	// Callers that cancelled the parent context may not receive anymore, so sends give up then.
+	send := func(msg *TCPMessage) bool {
+		select {
+		case out <- msg:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	for _, group := range groups {
+		if len(group.Specs) == 0 {
+			go func(name string) {
+				defer close(out)
+				defer cancel()
+				send(newAggregateMessage(
+					ctx,
+					allTargetsLabel,
+					Failed,
+					fmt.Errorf("group %q has no targets", name),
+				))
+			}(group.Name)
+			return out
+		}
+	}
+
+	// Failed messages of members are held back in groupFailed until all members of their group
+	// failed.
+	var (
+		chs          []<-chan *TCPMessage
+		groupOf      = make(map[*TCPSpec]int)
+		groupCancels = make([]context.CancelFunc, len(groups))
+		groupFailed  = make([][]*TCPMessage, len(groups))
+		groupReady   = make([]bool, len(groups))
+		readyCount   = 0
+	)
+	for i, group := range groups {
+		var gctx context.Context
+		gctx, groupCancels[i] = context.WithCancel(ctx)
+		for _, spec := range group.Specs {
+			groupOf[spec] = i
+			chs = append(chs, singleTCP(gctx, spec))
+		}
+	}
+
+	msgs := merge(ctx, chs)
+	timeoutC, stopTimeout := startTimeout(waitTimeout)
+
+	go func() {
+		defer close(out)
+		defer stopTimeout()
+		defer cancel()
+
+		for {
+			select {
+			case <-timeoutC:
+				send(newGroupTimeoutMessage(ctx, groups, groupReady, waitTimeout))
+				return
+
+			case msg, isOpen := <-msgs:
+				if !isOpen {
+					return
+				}
+				i := groupOf[msg.spec]
+				// Messages of satisfied groups, such as cancellations of their remaining members,
+				// are no longer relevant.
+				if groupReady[i] {
+					continue
+				}
+				hasSiblings := len(groups[i].Specs) > 1
+				if hasSiblings && msg.spec.Name != "" {
+					msg.label = memberTarget(msg.spec)
+				}
+				if msg.status != Failed && !send(msg) {
+					return
+				}
+
+				switch msg.status {
+				case Ready:
+					groupReady[i] = true
+					groupCancels[i]()
+					if hasSiblings && !send(newAggregateMessage(ctx, groups[i].Name, Ready, nil)) {
+						return
+					}
+					if readyCount++; readyCount == len(groups) {
+						send(newAggregateMessage(ctx, allTargetsLabel, Ready, nil))
+						return
+					}
+				case Failed:
+					groupFailed[i] = append(groupFailed[i], msg)
+					if len(groupFailed[i]) < len(groups[i].Specs) {
+						continue
+					}
+					for _, failed := range groupFailed[i] {
+						if !send(failed) {
+							return
+						}
+					}
+					if hasSiblings {
+						send(newAggregateMessage(
+							ctx,
+							groups[i].Name,
+							Failed,
+							fmt.Errorf("all targets of group %q failed: %w", groups[i].Name, msg.err),
+						))
+					}
+					return
+				}
+			}
+		}
+	}()
+
+	return out
+}
+
+// newGroupTimeoutMessage creates the Failed message emitted when the wait operations on the given
+// groups exceed their timeout limit. The message lists the groups that are not ready as pending.
+func newGroupTimeoutMessage(
+	ctx context.Context,
+	groups []*TCPGroup,
+	groupReady []bool,
+	waitTimeout time.Duration,
+) *TCPMessage {
+	var (
+		pendingNames []string
+		pendingSpecs []*TCPSpec
+	)
+	for i, group := range groups {
+		if !groupReady[i] {
+			pendingNames = append(pendingNames, group.Name)
+			pendingSpecs = append(pendingSpecs, group.Specs...)
+		}
+	}
+	msg := newAggregateMessage(
+		ctx,
+		allTargetsLabel,
+		Failed,
+		&TimeoutError{
+			Limit:   waitTimeout,
+			Pending: len(pendingNames),
+			LastErr: latestRetriedErr(ctx, pendingSpecs),
+		},
+	)
+	msg.pending = pendingNames
+	return msg
+}
+
+// memberTarget returns the target of messages of a named group member that has siblings, which is
+// the member name and address with the scheme of the member, or `tcp` if it has none, e.g.
+// `db=postgres://10.0.0.3:5432`.
+func memberTarget(spec *TCPSpec) string {
+	scheme := spec.Scheme
+	if scheme == "" {
+		scheme = "tcp"
+	}
+	return spec.Name + "=" + scheme + "://" + spec.Addr()
+}
@@ -0,0 +1,247 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestGroupTCPReady(t *testing.T) {
+	t.Parallel()
+
+	var (
+		servers = []*tcpServer{
+			{tcpServerHost, getLocalTCPPort(), 10 * time.Second, t},
+			{tcpServerHost, getLocalTCPPort(), 300 * time.Millisecond, t},
+			{tcpServerHost, getLocalTCPPort(), 300 * time.Millisecond, t},
+		}
+		group  = tcpServerGroup{servers: servers, t: t}
+		groups = []*TCPGroup{
+			{
+				Name: "db",
+				Specs: []*TCPSpec{
+					{Host: servers[0].host, Port: servers[0].port, PollFreq: 100 * time.Millisecond},
+					{Host: servers[1].host, Port: servers[1].port, PollFreq: 100 * time.Millisecond},
+				},
+			},
+			{
+				Name: "cache",
+				Specs: []*TCPSpec{
+					{Host: servers[2].host, Port: servers[2].port, PollFreq: 100 * time.Millisecond},
+				},
+			},
+		}
+	)
+
+	_, cancel := group.start(context.Background())
+	defer cancel()
+
+	mb := newMessageBox(GroupTCP(groups, 5*time.Second))
+
+	// There must be 3 Start messages, 2 member Ready messages, the Ready message of the db group,
+	// and the final Ready message. The cache group has a single member, so it has no own message.
+	if msgCount := mb.count(); msgCount != 7 {
+		t.Fatalf("test failed - want %d messages, got %d", 7, msgCount)
+	}
+	var gotDB bool
+	for _, msg := range mb.msgs {
+		if msg.Target() == "db" && msg.Status() == Ready {
+			gotDB = true
+		}
+	}
+	if !gotDB {
+		t.Errorf("test failed - want Ready message of group %q, got none", "db")
+	}
+	last := mb.msgs[mb.count()-1]
+	if last.Status() != Ready || last.Target() != "<all>" {
+		t.Errorf("test msgs[-1] failed - want: %s <all>, got: %s %s", Ready, last.Status(), last.Target())
+	}
+	// The unready member of the satisfied group must not have a final message.
+	if msgCount := mb.filterByTCPAddr(servers[0].addr()).count(); msgCount != 1 {
+		t.Errorf("test failed - want %d message for unready member, got %d", 1, msgCount)
+	}
+}
+
+func TestGroupTCPTimeout(t *testing.T) {
+	t.Parallel()
+
+	groups := []*TCPGroup{
+		{
+			Name: "db",
+			Specs: []*TCPSpec{
+				{Host: tcpServerHost, Port: getLocalTCPPort(), PollFreq: 100 * time.Millisecond},
+				{Host: tcpServerHost, Port: getLocalTCPPort(), PollFreq: 100 * time.Millisecond},
+			},
+		},
+	}
+
+	mb := newMessageBox(GroupTCP(groups, 500*time.Millisecond))
+	last := mb.msgs[mb.count()-1]
+
+	var timeoutErr *TimeoutError
+	if err := last.Err(); !errors.As(err, &timeoutErr) {
+		t.Fatalf("test msgs[-1].Err() failed - want: *TimeoutError, got: %v", err)
+	}
+	if pending := last.PendingTargets(); len(pending) != 1 || pending[0] != "db" {
+		t.Errorf("test msgs[-1].PendingTargets() failed - want: [db], got: %v", pending)
+	}
+}
+
+func TestGroupTCPFailed(t *testing.T) {
+	t.Parallel()
+
+	var (
+		dialErr = errors.New("no route to host")
+		groups  = []*TCPGroup{
+			{
+				Name: "db",
+				Specs: []*TCPSpec{
+					{
+						Host:     "flaky.invalid",
+						Port:     "5000",
+						PollFreq: 50 * time.Millisecond,
+						Dialer:   &flakyDialer{refusals: 1000, err: dialErr},
+					},
+					{
+						Host:     "flaky.invalid",
+						Port:     "5001",
+						PollFreq: 50 * time.Millisecond,
+						Dialer:   &flakyDialer{refusals: 1000, err: dialErr},
+					},
+				},
+			},
+		}
+	)
+
+	mb := newMessageBox(GroupTCP(groups, 5*time.Second))
+	last := mb.msgs[mb.count()-1]
+	if last.Status() != Failed || last.Target() != "db" || !errors.Is(last.Err(), dialErr) {
+		t.Errorf(
+			"test msgs[-1] failed - want: %s db with %q, got: %s %s with %v",
+			Failed,
+			dialErr,
+			last.Status(),
+			last.Target(),
+			last.Err(),
+		)
+	}
+}
+
+func TestGroupTCPMemberFailed(t *testing.T) {
+	t.Parallel()
+
+	var (
+		dialErr = errors.New("no route to host")
+		server  = &tcpServer{tcpServerHost, getLocalTCPPort(), 300 * time.Millisecond, t}
+		groups  = []*TCPGroup{
+			{
+				Name: "db",
+				Specs: []*TCPSpec{
+					{
+						Name:     "db",
+						Host:     "flaky.invalid",
+						Port:     "5000",
+						PollFreq: 50 * time.Millisecond,
+						Dialer:   &flakyDialer{refusals: 1000, err: dialErr},
+					},
+					{
+						Name:     "db",
+						Host:     server.host,
+						Port:     server.port,
+						PollFreq: 50 * time.Millisecond,
+						Scheme:   "postgres",
+					},
+				},
+			},
+		}
+	)
+
+	_, cancel := server.start(context.Background())
+	defer cancel()
+
+	// The failed member must not fail the group, whose other member becomes ready later.
+	mb := newMessageBox(GroupTCP(groups, 5*time.Second))
+	for _, msg := range mb.msgs {
+		if msg.Status() == Failed {
+			t.Errorf("test failed - want no Failed messages, got: %s with %v", msg.Target(), msg.Err())
+		}
+	}
+	last := mb.msgs[mb.count()-1]
+	if last.Status() != Ready || last.Target() != "<all>" {
+		t.Errorf("test msgs[-1] failed - want: %s <all>, got: %s %s", Ready, last.Status(), last.Target())
+	}
+
+	// Members must not share the target of their group.
+	wantTargets := map[string]bool{
+		"db=tcp://flaky.invalid:5000":    true,
+		"db=postgres://" + server.addr(): true,
+		"db":                             true,
+		"<all>":                          true,
+	}
+	for _, msg := range mb.msgs {
+		if !wantTargets[msg.Target()] {
+			t.Errorf("test failed - want target in %v, got: %q", wantTargets, msg.Target())
+		}
+	}
+	var groupMsgs int
+	for _, msg := range mb.msgs {
+		if msg.Target() == "db" {
+			groupMsgs++
+		}
+	}
+	if groupMsgs != 1 {
+		t.Errorf("test failed - want %d message of group %q, got %d", 1, "db", groupMsgs)
+	}
+}
+
+func TestGroupTCPEmptyGroup(t *testing.T) {
+	t.Parallel()
+
+	mb := newMessageBox(GroupTCP([]*TCPGroup{{Name: "db"}}, time.Second))
+	if msgCount := mb.count(); msgCount != 1 {
+		t.Fatalf("test failed - want %d message, got %d", 1, msgCount)
+	}
+	want := "group \"db\" has no targets"
+	if err := mb.msgs[0].Err(); err == nil || err.Error() != want {
+		t.Errorf("test failed - want err: %q, got: %v", want, err)
+	}
+}
+
+// This test is not parallel, so that the number of goroutines is not affected by other tests.
+func TestGroupTCPContextCancel(t *testing.T) {
+	var (
+		before      = runtime.NumGoroutine()
+		pollFreq    = 50 * time.Millisecond
+		groups      = make([]*TCPGroup, 5)
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	defer cancel()
+
+	for i := range groups {
+		groups[i] = &TCPGroup{
+			Name: fmt.Sprintf("db%d", i),
+			Specs: []*TCPSpec{
+				{Host: tcpServerHost, Port: getLocalTCPPort(), PollFreq: pollFreq},
+				{Host: tcpServerHost, Port: getLocalTCPPort(), PollFreq: pollFreq},
+			},
+		}
+	}
+
+	// Without a timeout limit, the wait operations only end because they are cancelled. No more
+	// messages are received after cancelling, as callers that give up early would do.
+	msgs := GroupTCPContext(ctx, groups, NoTimeout)
+	if status := (<-msgs).Status(); status != Start {
+		t.Fatalf("test msgs[0].Status() failed - want: %s, got: %s", Start, status)
+	}
+	cancel()
+
+	if after := waitGoroutines(before, 2*pollFreq+time.Second); after > before {
+		t.Errorf("test failed - want at most %d goroutines, got: %d", before, after)
+	}
+}
@@ -0,0 +1,390 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxDrainSize is the maximum number of response body bytes read before the body is closed, so
+	// that the connection may be reused for the next request.
+	maxDrainSize = 4096
+	// maxBodySize is the maximum number of response body bytes matched against ExpectBody. The
+	// rest of the body is ignored.
+	maxBodySize = 64 * 1024
+	// httpDialTimeout is the connection timeout of dialers replacing that of the default transport,
+	// which they match.
+	httpDialTimeout = 30 * time.Second
+)
+
+// HTTPSpec represents the input specification of a single HTTP wait operation.
+type HTTPSpec struct {
+	// URL is the address to which requests are sent.
+	URL *url.URL
+	// Method is the method of the requests. If empty, `GET` is used.
+	Method string
+	// Header is the header sent with every request. A `Host` entry sets the host name that the
+	// request is for, which may differ from the host of URL for servers behind name-based virtual
+	// hosting. If nil, only the default header of the client is sent.
+	Header http.Header
+	// PollFreq is how often a request is sent.
+	PollFreq time.Duration
+	// SkipImmediateCheck is whether the first request is sent only after the first poll interval, as
+	// in TCPSpec.
+	SkipImmediateCheck bool
+	// Jitter is the maximum fraction by which each poll interval randomly deviates from PollFreq,
+	// as in TCPSpec.
+	Jitter float64
+	// JitterRand is the random number generator for Jitter, as in TCPSpec.
+	JitterRand *rand.Rand
+	// Proxy is the URL of the proxy through which all requests are sent. If nil, the proxy is
+	// chosen as described in NoProxy. It is ignored if Client is set.
+	Proxy *url.URL
+	// NoProxy is whether requests are sent directly to the server when Proxy is nil. If false,
+	// requests go through the proxy chosen by http.ProxyFromEnvironment, which honors HTTP_PROXY,
+	// HTTPS_PROXY, and NO_PROXY. It is ignored if Client is set.
+	NoProxy bool
+	// KeepAlive is whether connections are reused across requests. If false, every request is sent
+	// over a new connection, so that readiness reflects the current state of the server and not
+	// that of a connection made by an earlier request. It is ignored if Client is set.
+	KeepAlive bool
+	// TCPKeepAlive is the interval between TCP keep-alive probes on connections, as in TCPSpec. If
+	// zero, the interval of the default transport is used. It is ignored if Client is set.
+	TCPKeepAlive time.Duration
+	// RetryOnError is whether all request errors are retried until the wait operation is done. If
+	// false, only errors indicating that the server is not ready yet are retried and other errors
+	// end the wait operation immediately. Responses with unexpected status codes are always
+	// retried.
+	RetryOnError bool
+	// Once is whether only a single request is sent. If true, the wait operation fails as soon as
+	// that request does not succeed, regardless of RetryOnError.
+	Once bool
+	// MaxAttempts is the maximum number of requests, after which the wait operation fails even if
+	// it would otherwise retry. Values below 1 mean no limit.
+	MaxAttempts int
+	// ReadyStatuses are the response status codes of servers that are ready. Responses with other
+	// codes mean that the server is not ready yet. If nil, all 2xx codes are accepted. Redirects
+	// are followed, unless any 3xx code is accepted, in which case their own codes are checked.
+	ReadyStatuses StatusRanges
+	// ExpectBody is the pattern that the response body must match for the server to be considered
+	// ready, in addition to the status code. Only the first 64 KiB of the body are matched. If nil,
+	// the body is not read.
+	ExpectBody *regexp.Regexp
+	// FailOnNXDomain is whether the wait operation fails as soon as DNS answers that the host name
+	// does not exist, regardless of RetryOnError.
+	FailOnNXDomain bool
+	// TLSPins are the SHA-256 fingerprints of the certificates that `https://` servers may present.
+	// If set, servers are trusted only if their certificate has one of the fingerprints, instead of
+	// if it is signed by a trusted certificate authority, so that servers with self-signed
+	// certificates can be waited on. It is ignored if Client is set.
+	TLSPins []TLSPin
+	// TLSPinStrict is whether the wait operation fails as soon as the server presents a certificate
+	// that is not pinned. If false, such servers are polled again, as the expected certificate may
+	// not have been provisioned yet.
+	TLSPinStrict bool
+	// Priority is how prominently the target is presented, as in TCPSpec.
+	Priority int
+	// Client is used for sending requests. If nil, a client with the default transport settings is
+	// used.
+	Client *http.Client
+	// Observer receives the result of every request. If nil, requests are not reported.
+	Observer AttemptObserver
+}
+
+// Target returns the URL of the specifications.
+func (spec *HTTPSpec) Target() string {
+	return spec.URL.String()
+}
+
+// pollTiming returns when the requests of the specifications are sent.
+func (spec *HTTPSpec) pollTiming() pollTiming {
+	return pollTiming{
+		freq:               spec.PollFreq,
+		jitter:             spec.Jitter,
+		skipImmediateCheck: spec.SkipImmediateCheck,
+		jitterRand:         spec.JitterRand,
+	}
+}
+
+// client returns the client for sending requests of the specifications.
+func (spec *HTTPSpec) client() *http.Client {
+	if spec.Client != nil {
+		return spec.Client
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	switch {
+	case spec.Proxy != nil:
+		transport.Proxy = http.ProxyURL(spec.Proxy)
+	case spec.NoProxy:
+		transport.Proxy = nil
+	}
+	transport.DisableKeepAlives = !spec.KeepAlive
+	if spec.TCPKeepAlive != 0 {
+		dialer := &net.Dialer{Timeout: httpDialTimeout, KeepAlive: spec.TCPKeepAlive}
+		transport.DialContext = dialer.DialContext
+	}
+	if len(spec.TLSPins) > 0 {
+		pins := spec.TLSPins
+		transport.TLSClientConfig = &tls.Config{
+			// Certificates are verified against the pins instead.
+			InsecureSkipVerify: true, // nolint: gosec
+			VerifyConnection: func(state tls.ConnectionState) error {
+				return verifyTLSPins(pins, state)
+			},
+		}
+	}
+	client := &http.Client{Transport: transport}
+	if spec.acceptsRedirects() {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	return client
+}
+
+// acceptsRedirects checks whether any 3xx response status code means that the server is ready.
+func (spec *HTTPSpec) acceptsRedirects() bool {
+	for _, r := range spec.ReadyStatuses {
+		if r.Min < 400 && r.Max >= 300 {
+			return true
+		}
+	}
+	return false
+}
+
+// method returns the request method of the specifications, defaulting to `GET` if none is set.
+func (spec *HTTPSpec) method() string {
+	if spec.Method == "" {
+		return http.MethodGet
+	}
+	return spec.Method
+}
+
+// newRequest creates a request of the specifications with the given context.
+func (spec *HTTPSpec) newRequest(ctx context.Context) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, spec.method(), spec.Target(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range spec.Header {
+		req.Header[key] = append([]string(nil), values...)
+	}
+	// Outgoing requests take their host from the Host field, ignoring the header entry.
+	if host := spec.Header.Get("Host"); host != "" {
+		req.Host = host
+	}
+	return req, nil
+}
+
+// isReadyStatus checks whether the given response status code means that the server is ready,
+// which is the case for the codes in ReadyStatuses, or for all 2xx codes if it is nil.
+func (spec *HTTPSpec) isReadyStatus(code int) bool {
+	if spec.ReadyStatuses == nil {
+		return code >= 200 && code < 300
+	}
+	return spec.ReadyStatuses.Match(code)
+}
+
+// check sends a single request with the given client. If the server is ready, it returns the
+// details of the response. Otherwise, it returns why the server is not ready, and whether the wait
+// operation should go on.
+func (spec *HTTPSpec) check(
+	ctx context.Context,
+	client *http.Client,
+) (map[string]string, bool, error) {
+	req, err := spec.newRequest(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		if nfErr := hostNotFoundErr(err); spec.FailOnNXDomain && nfErr != nil {
+			return nil, false, nfErr
+		}
+		var pinErr *TLSPinError
+		if errors.As(err, &pinErr) {
+			return nil, !spec.TLSPinStrict, err
+		}
+		return nil, spec.RetryOnError || shouldWait(err), err
+	}
+	defer resp.Body.Close()
+	defer func() { _, _ = io.CopyN(io.Discard, resp.Body, maxDrainSize) }()
+
+	if !spec.isReadyStatus(resp.StatusCode) {
+		return nil, true, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	if spec.ExpectBody != nil {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+		if err != nil {
+			return nil, spec.RetryOnError || shouldWait(err), err
+		}
+		if !spec.ExpectBody.Match(body) {
+			return nil, true, fmt.Errorf("response body does not match %q", spec.ExpectBody)
+		}
+	}
+	details := map[string]string{
+		"proto":  resp.Proto,
+		"status": strconv.Itoa(resp.StatusCode),
+	}
+	return details, false, nil
+}
+
+// observeAttempt reports the result of the given request of the specifications to its observer,
+// if it has one.
+func (spec *HTTPSpec) observeAttempt(number int, err error) {
+	if spec.Observer == nil {
+		return
+	}
+	spec.Observer.ObserveAttempt(
+		Attempt{Target: spec.Target(), Number: number, Time: time.Now(), Err: err},
+	)
+}
+
+// IsHTTPAddr checks whether the given raw address is an HTTP URL, i.e. starts with `http://` or
+// `https://`, in any letter case.
+func IsHTTPAddr(rawAddr string) bool {
+	lower := strings.ToLower(rawAddr)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// ParseHTTPSpec parses the given address, in the form of an `http://` or `https://` URL, into an
+// HTTPSpec and then returns a pointer to it. As in ParseTCPSpec, the address may be followed by a
+// poll frequency after a `#` sign, and otherwise the poll frequency registered for its scheme with
+// RegisterProtoPollFreq or `defaultPollFreq` is used. URL fragments are never sent to servers, so
+// they can not be given.
+func ParseHTTPSpec(rawAddr string, defaultPollFreq time.Duration) (*HTTPSpec, error) {
+	if !IsHTTPAddr(rawAddr) {
+		return nil, fmt.Errorf("not an HTTP address: %q", rawAddr)
+	}
+
+	rawURL, rawFreq, hasFreq := strings.Cut(rawAddr, "#")
+	if hasFreq {
+		freq, err := parsePollFreq(rawFreq)
+		if err != nil {
+			return nil, err
+		}
+		defaultPollFreq = freq
+	} else {
+		scheme, _, _ := strings.Cut(rawURL, "://")
+		if freq, hasSchemeFreq := lookupProtoPollFreq(scheme); hasSchemeFreq {
+			defaultPollFreq = freq
+		}
+	}
+	if err := checkPollFreq(defaultPollFreq); err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("HTTP host not given: %q", rawURL)
+	}
+	if port := u.Port(); port != "" {
+		if err := validatePort(port); err != nil {
+			return nil, err
+		}
+	}
+
+	return &HTTPSpec{URL: u, PollFreq: defaultPollFreq}, nil
+}
+
+// HTTPMessage is a container for wait operations on HTTP servers.
+type HTTPMessage struct {
+	singleMessage
+	// spec is the wait operation specifications.
+	spec *HTTPSpec
+	// details is the metadata of the response that made the server ready.
+	details map[string]string
+}
+
+// newHTTPMessage creates a new HTTPMessage with the given status and error.
+func newHTTPMessage(
+	spec *HTTPSpec,
+	status Status,
+	startTime time.Time,
+	attempts int,
+	err error,
+) *HTTPMessage {
+	return &HTTPMessage{
+		singleMessage: newSingleMessage(status, startTime, attempts, err),
+		spec:          spec,
+	}
+}
+
+// Target returns the target of the wait operation, which is its URL.
+func (msg *HTTPMessage) Target() string {
+	return msg.spec.Target()
+}
+
+// Details returns the protocol version (`proto`) and status code (`status`) of the response that
+// made the server ready. It is empty for other messages.
+func (msg *HTTPMessage) Details() map[string]string {
+	details := make(map[string]string, len(msg.details))
+	for key, value := range msg.details {
+		details[key] = value
+	}
+	return details
+}
+
+// SingleHTTP waits until the HTTP server of the given specifications responds with a ready status
+// code, sending a request every poll frequency, until the given context is done. It returns a
+// channel through which a Start message and then a final Ready or Failed message is sent, after
+// which the channel is closed.
+func SingleHTTP(ctx context.Context, spec *HTTPSpec) <-chan *HTTPMessage {
+	var (
+		startTime = targetStartTimeFromContext(ctx)
+		client    = spec.client()
+		attempts  = 0
+	)
+
+	cancelled := func() *HTTPMessage {
+		return newHTTPMessage(spec, Failed, startTime, attempts, ctx.Err())
+	}
+
+	checkHTTP := func(bool) *HTTPMessage {
+		attempts++
+		details, retry, err := spec.check(ctx, client)
+		if err == nil {
+			spec.observeAttempt(attempts, nil)
+			msg := newHTTPMessage(spec, Ready, startTime, attempts, nil)
+			msg.details = details
+			return msg
+		}
+		// Requests aborted by cancellation are reported as such, not as request errors.
+		if ctx.Err() != nil {
+			return cancelled()
+		}
+		spec.observeAttempt(attempts, err)
+		if retry && !spec.Once {
+			if !attemptsExhausted(spec.MaxAttempts, attempts) {
+				return nil
+			}
+			err = errAttemptsExhausted(attempts, err)
+		}
+		return newHTTPMessage(spec, Failed, startTime, attempts, annotateErr(err))
+	}
+
+	start := newHTTPMessage(spec, Start, startTime, 0, nil)
+	return poll(ctx, spec.pollTiming(), start, checkHTTP, cancelled)
+}
@@ -0,0 +1,607 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseHTTPSpec(t *testing.T) {
+	t.Parallel()
+
+	var commonPollFreq = 1 * time.Second
+	var tests = []struct {
+		name       string
+		in         string
+		wantTarget string
+		wantFreq   time.Duration
+		wantErr    error
+	}{
+		{"http", "http://localhost/health", "http://localhost/health", commonPollFreq, nil},
+		{
+			"https, port, query, poll freq",
+			"HTTPS://example.com:8443/ready?deep=1#200ms",
+			"https://example.com:8443/ready?deep=1",
+			200 * time.Millisecond,
+			nil,
+		},
+		{
+			"not http",
+			"tcp://localhost:80",
+			"",
+			0,
+			fmt.Errorf("not an HTTP address: \"tcp://localhost:80\""),
+		},
+		{"no host", "http:///health", "", 0, fmt.Errorf("HTTP host not given: \"http:///health\"")},
+		{"invalid port", "http://localhost:0/", "", 0, fmt.Errorf("invalid port \"0\"")},
+		{
+			"invalid poll freq",
+			"http://localhost#-1s",
+			"",
+			0,
+			fmt.Errorf("poll frequency must be positive, got: -1s"),
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			spec, err := ParseHTTPSpec(test.in, commonPollFreq)
+
+			if test.wantErr != nil {
+				if fmt.Sprint(err) != test.wantErr.Error() {
+					t.Errorf("test[%d] %q failed - want err: %q, got: %v", i, name, test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("test[%d] %q failed - unexpected error: %s", i, name, err)
+			}
+			if got := spec.Target(); got != test.wantTarget {
+				t.Errorf("test[%d] %q failed - want target: %q, got: %q", i, name, test.wantTarget, got)
+			}
+			if spec.PollFreq != test.wantFreq {
+				t.Errorf("test[%d] %q failed - want: %s, got: %s", i, name, test.wantFreq, spec.PollFreq)
+			}
+		})
+	}
+}
+
+func TestHTTPSpecClientProxy(t *testing.T) {
+	t.Parallel()
+
+	proxyURL := &url.URL{Scheme: "http", Host: "proxy.internal:3128"}
+
+	var tests = []struct {
+		name      string
+		proxy     *url.URL
+		noProxy   bool
+		wantProxy bool
+	}{
+		{"environment proxy", nil, false, true},
+		{"no proxy", nil, true, false},
+		{"given proxy", proxyURL, false, true},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			spec := &HTTPSpec{Proxy: test.proxy, NoProxy: test.noProxy}
+			transport, ok := spec.client().Transport.(*http.Transport)
+			if !ok {
+				t.Fatalf("test[%d] %q failed - want *http.Transport", i, test.name)
+			}
+			if got := transport.Proxy != nil; got != test.wantProxy {
+				t.Errorf("test[%d] %q failed - want proxy: %t, got: %t", i, test.name, test.wantProxy, got)
+			}
+			if test.proxy == nil {
+				return
+			}
+			req := httptest.NewRequest(http.MethodGet, "http://api.internal/health", nil)
+			if got, err := transport.Proxy(req); err != nil || got.String() != test.proxy.String() {
+				t.Errorf(
+					"test[%d] %q failed - want proxy URL: %s, got: %v, %v",
+					i,
+					test.name,
+					test.proxy,
+					got,
+					err,
+				)
+			}
+		})
+	}
+}
+
+// newFlakyHTTPServer starts an HTTP server that responds with 503 to a number of requests before
+// responding with 200. It also returns the number of requests received so far.
+func newFlakyHTTPServer(t *testing.T, failures int32) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &requests
+}
+
+// newBodyHTTPServer starts an HTTP server that responds with 200 and the given bodies, one per
+// request, repeating the last body once all others are sent.
+func newBodyHTTPServer(t *testing.T, bodies ...string) *httptest.Server {
+	t.Helper()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		idx := int(atomic.AddInt32(&requests, 1)) - 1
+		if idx >= len(bodies) {
+			idx = len(bodies) - 1
+		}
+		fmt.Fprint(w, bodies[idx])
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestSingleHTTPExpectBody(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name         string
+		bodies       []string
+		wantStatus   Status
+		wantAttempts int
+	}{
+		{"matches", []string{`{"status":"UP"}`}, Ready, 1},
+		{
+			"matches after polling",
+			[]string{`{"status":"DOWN"}`, `{"status":"DOWN"}`, `{"status":"UP"}`},
+			Ready,
+			3,
+		},
+		{"never matches", []string{`{"status":"DOWN"}`}, Failed, 0},
+		{
+			"matches beyond size limit",
+			[]string{strings.Repeat(" ", maxBodySize) + `{"status":"UP"}`},
+			Failed,
+			0,
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			server := newBodyHTTPServer(t, test.bodies...)
+			spec, err := ParseHTTPSpec(server.URL, 20*time.Millisecond)
+			if err != nil {
+				t.Fatalf("test[%d] %q failed - unexpected error: %s", i, name, err)
+			}
+			spec.NoProxy = true
+			spec.ExpectBody = regexp.MustCompile(`"status":\s*"UP"`)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+			defer cancel()
+
+			msgs := collectHTTPMessages(SingleHTTP(ctx, spec))
+			if len(msgs) != 2 {
+				t.Fatalf("test[%d] %q failed - want %d messages, got %d", i, name, 2, len(msgs))
+			}
+			last := msgs[1]
+			if status := last.Status(); status != test.wantStatus {
+				t.Fatalf(
+					"test[%d] %q failed - want: %s, got: %s (%v)",
+					i,
+					name,
+					test.wantStatus,
+					status,
+					last.Err(),
+				)
+			}
+			if test.wantAttempts > 0 && last.Attempts() != test.wantAttempts {
+				t.Errorf(
+					"test[%d] %q failed - want attempts: %d, got: %d",
+					i,
+					name,
+					test.wantAttempts,
+					last.Attempts(),
+				)
+			}
+		})
+	}
+}
+
+func TestSingleHTTPRequest(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu      sync.Mutex
+		gotReq  *http.Request
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			gotReq = r
+		})
+		server = httptest.NewServer(handler)
+	)
+	t.Cleanup(server.Close)
+
+	spec, err := ParseHTTPSpec(server.URL+"/health", 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("test failed - unexpected error: %s", err)
+	}
+	spec.NoProxy = true
+	spec.Method = http.MethodHead
+	spec.Header = http.Header{
+		"Host":           {"api.internal"},
+		"X-Health-Token": {"s3cret"},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	msgs := collectHTTPMessages(SingleHTTP(ctx, spec))
+	if len(msgs) != 2 || msgs[1].Status() != Ready {
+		t.Fatalf("test failed - want final message: %s, got: %v", Ready, msgs)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if gotReq.Method != http.MethodHead {
+		t.Errorf("test failed - want method: %q, got: %q", http.MethodHead, gotReq.Method)
+	}
+	if gotReq.Host != "api.internal" {
+		t.Errorf("test failed - want host: %q, got: %q", "api.internal", gotReq.Host)
+	}
+	if got := gotReq.Header.Get("X-Health-Token"); got != "s3cret" {
+		t.Errorf("test failed - want header value: %q, got: %q", "s3cret", got)
+	}
+}
+
+func collectHTTPMessages(ch <-chan *HTTPMessage) []*HTTPMessage {
+	var msgs []*HTTPMessage
+	for msg := range ch {
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func TestSingleHTTPReady(t *testing.T) {
+	t.Parallel()
+
+	server, requests := newFlakyHTTPServer(t, 2)
+	spec, err := ParseHTTPSpec(server.URL+"/health", 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("test failed - unexpected error: %s", err)
+	}
+	spec.NoProxy = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	msgs := collectHTTPMessages(SingleHTTP(ctx, spec))
+	if len(msgs) != 2 {
+		t.Fatalf("test failed - want %d messages, got %d", 2, len(msgs))
+	}
+	if status := msgs[1].Status(); status != Ready {
+		t.Fatalf("test msgs[1].Status() failed - want: %s, got: %s (%v)", Ready, status, msgs[1].Err())
+	}
+	if attempts := msgs[1].Attempts(); attempts != 3 {
+		t.Errorf("test msgs[1].Attempts() failed - want: %d, got: %d", 3, attempts)
+	}
+	if got := atomic.LoadInt32(requests); got != 3 {
+		t.Errorf("test failed - want %d requests, got %d", 3, got)
+	}
+	if got := msgs[1].Details()["status"]; got != "200" {
+		t.Errorf("test msgs[1].Details() failed - want status: %q, got: %q", "200", got)
+	}
+}
+
+func TestSingleHTTPTCPKeepAlive(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name      string
+		keepAlive time.Duration
+	}{
+		{"interval", 5 * time.Second},
+		{"disabled", -1},
+	}
+
+	server, _ := newFlakyHTTPServer(t, 0)
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			spec, err := ParseHTTPSpec(server.URL, 20*time.Millisecond)
+			if err != nil {
+				t.Fatalf("test[%d] %q failed - unexpected error: %s", i, test.name, err)
+			}
+			spec.NoProxy = true
+			spec.TCPKeepAlive = test.keepAlive
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			msgs := collectHTTPMessages(SingleHTTP(ctx, spec))
+			if status := msgs[len(msgs)-1].Status(); status != Ready {
+				t.Errorf("test[%d] %q failed - want: %s, got: %s", i, test.name, Ready, status)
+			}
+		})
+	}
+}
+
+func TestSingleHTTPKeepAlive(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name      string
+		keepAlive bool
+		wantConns int32
+	}{
+		{"new connection per request", false, 3},
+		{"reused connection", true, 1},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				requests int32
+				conns    int32
+				server   = httptest.NewUnstartedServer(
+					http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+						if atomic.AddInt32(&requests, 1) <= 2 {
+							w.WriteHeader(http.StatusServiceUnavailable)
+							return
+						}
+						w.WriteHeader(http.StatusOK)
+					}),
+				)
+			)
+			server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					atomic.AddInt32(&conns, 1)
+				}
+			}
+			server.Start()
+			t.Cleanup(server.Close)
+
+			spec, err := ParseHTTPSpec(server.URL, 20*time.Millisecond)
+			if err != nil {
+				t.Fatalf("test[%d] %q failed - unexpected error: %s", i, test.name, err)
+			}
+			spec.NoProxy = true
+			spec.KeepAlive = test.keepAlive
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			msgs := collectHTTPMessages(SingleHTTP(ctx, spec))
+			if status := msgs[len(msgs)-1].Status(); status != Ready {
+				t.Fatalf("test[%d] %q failed - want: %s, got: %s", i, test.name, Ready, status)
+			}
+			if got := atomic.LoadInt32(&conns); got != test.wantConns {
+				t.Errorf(
+					"test[%d] %q failed - want %d connections, got: %d",
+					i, test.name, test.wantConns, got,
+				)
+			}
+		})
+	}
+}
+
+func TestSingleHTTPOnce(t *testing.T) {
+	t.Parallel()
+
+	server, _ := newFlakyHTTPServer(t, 1)
+	spec, err := ParseHTTPSpec(server.URL, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("test failed - unexpected error: %s", err)
+	}
+	spec.NoProxy = true
+	spec.Once = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	msgs := collectHTTPMessages(SingleHTTP(ctx, spec))
+	if len(msgs) != 2 {
+		t.Fatalf("test failed - want %d messages, got %d", 2, len(msgs))
+	}
+	want := "unexpected status: 503 Service Unavailable"
+	if last := msgs[1]; last.Status() != Failed || fmt.Sprint(last.Err()) != want {
+		t.Errorf(
+			"test msgs[1] failed - want: %s with %q, got: %s with %v",
+			Failed,
+			want,
+			last.Status(),
+			last.Err(),
+		)
+	}
+}
+
+func TestSingleHTTPReadyStatuses(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name       string
+		code       int
+		statuses   StatusRanges
+		wantStatus Status
+	}{
+		{"default no content", http.StatusNoContent, nil, Ready},
+		// Redirects without a location are not followed, so their status code is seen as is.
+		{"default redirect", http.StatusMovedPermanently, nil, Failed},
+		{"redirect in range", http.StatusMovedPermanently, StatusRanges{{200, 399}}, Ready},
+		{"ok not listed", http.StatusOK, StatusRanges{{204, 204}}, Failed},
+		{"unavailable listed", http.StatusServiceUnavailable, StatusRanges{{503, 503}}, Ready},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			server := httptest.NewServer(
+				http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+					w.WriteHeader(test.code)
+				}),
+			)
+			t.Cleanup(server.Close)
+
+			spec, err := ParseHTTPSpec(server.URL, 20*time.Millisecond)
+			if err != nil {
+				t.Fatalf("test[%d] %q failed - unexpected error: %s", i, name, err)
+			}
+			spec.NoProxy = true
+			spec.Once = true
+			spec.ReadyStatuses = test.statuses
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			msgs := collectHTTPMessages(SingleHTTP(ctx, spec))
+			last := msgs[len(msgs)-1]
+			if status := last.Status(); status != test.wantStatus {
+				t.Errorf(
+					"test[%d] %q failed - want: %s, got: %s (%v)",
+					i,
+					name,
+					test.wantStatus,
+					status,
+					last.Err(),
+				)
+			}
+		})
+	}
+}
+
+func TestSingleHTTPRedirect(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name       string
+		statuses   StatusRanges
+		wantStatus Status
+	}{
+		{"default", nil, Failed},
+		{"redirect in range", StatusRanges{{200, 399}}, Ready},
+		{"redirect listed", StatusRanges{{200, 200}, {302, 302}}, Ready},
+		{"redirect not listed", StatusRanges{{200, 299}}, Failed},
+		{"redirect target listed", StatusRanges{{503, 503}}, Ready},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			mux := http.NewServeMux()
+			mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, "/login", http.StatusFound)
+			})
+			mux.HandleFunc("/login", func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			})
+			server := httptest.NewServer(mux)
+			t.Cleanup(server.Close)
+
+			spec, err := ParseHTTPSpec(server.URL, 20*time.Millisecond)
+			if err != nil {
+				t.Fatalf("test[%d] %q failed - unexpected error: %s", i, name, err)
+			}
+			spec.NoProxy = true
+			spec.Once = true
+			spec.ReadyStatuses = test.statuses
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			msgs := collectHTTPMessages(SingleHTTP(ctx, spec))
+			last := msgs[len(msgs)-1]
+			if status := last.Status(); status != test.wantStatus {
+				t.Errorf(
+					"test[%d] %q failed - want: %s, got: %s (%v)",
+					i,
+					name,
+					test.wantStatus,
+					status,
+					last.Err(),
+				)
+			}
+		})
+	}
+}
+
+func TestSingleHTTPTimeout(t *testing.T) {
+	t.Parallel()
+
+	server, _ := newFlakyHTTPServer(t, 1000)
+	spec, err := ParseHTTPSpec(server.URL, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("test failed - unexpected error: %s", err)
+	}
+	spec.NoProxy = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	msgs := collectHTTPMessages(SingleHTTP(ctx, spec))
+	if len(msgs) != 2 {
+		t.Fatalf("test failed - want %d messages, got %d", 2, len(msgs))
+	}
+	if last := msgs[1]; last.Status() != Failed || last.Err() != context.DeadlineExceeded {
+		t.Errorf(
+			"test msgs[1] failed - want: %s with %q, got: %s with %v",
+			Failed,
+			context.DeadlineExceeded,
+			last.Status(),
+			last.Err(),
+		)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StatusRange is an inclusive range of HTTP response status codes.
+type StatusRange struct {
+	// Min is the lowest status code of the range.
+	Min int
+	// Max is the highest status code of the range, which is Min for ranges of a single code.
+	Max int
+}
+
+// String returns the range as its single code, or as its lowest and highest codes joined by `-`.
+func (r StatusRange) String() string {
+	if r.Min == r.Max {
+		return strconv.Itoa(r.Min)
+	}
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+// StatusRanges are the HTTP response status codes accepted from servers that are ready.
+type StatusRanges []StatusRange
+
+// Match checks whether the given status code is in any of the ranges.
+func (rs StatusRanges) Match(code int) bool {
+	for _, r := range rs {
+		if code >= r.Min && code <= r.Max {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the ranges in the form accepted by ParseStatusRanges.
+func (rs StatusRanges) String() string {
+	parts := make([]string, len(rs))
+	for i, r := range rs {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseStatusRanges parses the given comma-separated HTTP status codes and ranges of codes, e.g.
+// `200,204,301-399`. Ranges include both of their ends, and all codes must be from 100 to 599.
+func ParseStatusRanges(rawRanges string) (StatusRanges, error) {
+	var rs StatusRanges
+	for _, rawRange := range strings.Split(rawRanges, ",") {
+		rawRange = strings.TrimSpace(rawRange)
+		rawMin, rawMax, isRange := strings.Cut(rawRange, "-")
+		if !isRange {
+			rawMax = rawMin
+		}
+		lo, loErr := parseStatusCode(rawMin)
+		hi, hiErr := parseStatusCode(rawMax)
+		if loErr != nil || hiErr != nil || lo > hi {
+			return nil, fmt.Errorf(
+				"invalid HTTP status, want code or range of codes from 100 to 599, got: %q",
+				rawRange,
+			)
+		}
+		rs = append(rs, StatusRange{Min: lo, Max: hi})
+	}
+	return rs, nil
+}
+
+// parseStatusCode parses the given HTTP status code, which must be from 100 to 599.
+func parseStatusCode(rawCode string) (int, error) {
+	code, err := strconv.Atoi(strings.TrimSpace(rawCode))
+	if err != nil {
+		return 0, err
+	}
+	if code < 100 || code > 599 {
+		return 0, fmt.Errorf("status code out of range: %d", code)
+	}
+	return code, nil
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseStatusRanges(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name      string
+		in        string
+		want      string
+		wantMatch []int
+		wantMiss  []int
+		wantErr   string
+	}{
+		{"single code", "204", "204", []int{204}, []int{200, 205}, ""},
+		{
+			"codes and ranges",
+			" 200, 204 ,301-399",
+			"200,204,301-399",
+			[]int{200, 204, 301, 350, 399},
+			[]int{201, 300, 400},
+			"",
+		},
+		{"single code range", "200-200", "200", []int{200}, []int{201}, ""},
+		{
+			"empty",
+			"",
+			"",
+			nil,
+			nil,
+			"invalid HTTP status, want code or range of codes from 100 to 599, got: \"\"",
+		},
+		{
+			"empty part",
+			"200,,204",
+			"",
+			nil,
+			nil,
+			"invalid HTTP status, want code or range of codes from 100 to 599, got: \"\"",
+		},
+		{
+			"reversed range",
+			"399-301",
+			"",
+			nil,
+			nil,
+			"invalid HTTP status, want code or range of codes from 100 to 599, got: \"399-301\"",
+		},
+		{
+			"open range",
+			"200-",
+			"",
+			nil,
+			nil,
+			"invalid HTTP status, want code or range of codes from 100 to 599, got: \"200-\"",
+		},
+		{
+			"out of range",
+			"200-600",
+			"",
+			nil,
+			nil,
+			"invalid HTTP status, want code or range of codes from 100 to 599, got: \"200-600\"",
+		},
+		{
+			"not a code",
+			"2xx",
+			"",
+			nil,
+			nil,
+			"invalid HTTP status, want code or range of codes from 100 to 599, got: \"2xx\"",
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			wantErr := test.wantErr
+			got, gotErr := ParseStatusRanges(test.in)
+
+			if (wantErr == "" && gotErr != nil) || (wantErr != "" && fmt.Sprint(gotErr) != wantErr) {
+				t.Fatalf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+			}
+			if gotErr != nil {
+				return
+			}
+			if got.String() != test.want {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, name, test.want, got)
+			}
+			for _, code := range test.wantMatch {
+				if !got.Match(code) {
+					t.Errorf("test[%d] %q failed - want %d to match, got no match", i, name, code)
+				}
+			}
+			for _, code := range test.wantMiss {
+				if got.Match(code) {
+					t.Errorf("test[%d] %q failed - want %d not to match, got match", i, name, code)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// errNetNSUnsupported is the error of entering network namespaces on platforms other than Linux.
+var errNetNSUnsupported = errors.New("network namespaces are only supported on Linux")
+
+// inNetNS calls the given function on a thread in the network namespace at the given path. The
+// function must not start goroutines for work that needs to be in the namespace, since these run
+// on other threads.
+func inNetNS(path string, fn func()) error {
+	errs := make(chan error, 1)
+	go func() {
+		// The thread is never unlocked, so that it exits along with the goroutine instead of
+		// running other goroutines from within the namespace.
+		runtime.LockOSThread()
+		if err := enterNetNS(path); err != nil {
+			errs <- fmt.Errorf("can not enter network namespace %s: %w", path, err)
+			return
+		}
+		fn()
+		errs <- nil
+	}()
+	return <-errs
+}
+
+// CheckNetNS checks that the network namespace at the given path can be entered, for setting it
+// as TCPSpec.NetNS.
+func CheckNetNS(path string) error {
+	return inNetNS(path, func() {})
+}
+
+// netnsDialer is a Dialer that makes connections from within a network namespace.
+type netnsDialer struct {
+	// path is the path of the network namespace.
+	path string
+	// dialer makes the connections once in the namespace.
+	dialer Dialer
+}
+
+// DialContext connects to the address on the named network from within the network namespace of
+// the dialer.
+func (d *netnsDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	var (
+		conn    net.Conn
+		dialErr error
+	)
+	err := inNetNS(d.path, func() {
+		conn, dialErr = d.dialer.DialContext(ctx, network, addr)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conn, dialErr
+}
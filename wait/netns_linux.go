@@ -0,0 +1,27 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux
+
+package wait
+
+import (
+	"os"
+	"syscall"
+)
+
+// enterNetNS moves the calling thread into the network namespace at the given path. The calling
+// goroutine must be locked to its thread.
+func enterNetNS(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, _, errno := syscall.RawSyscall(sysSetns, f.Fd(), syscall.CLONE_NEWNET, 0)
+	if errno != 0 {
+		return os.NewSyscallError("setns", errno)
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !linux
+
+package wait
+
+// enterNetNS always fails, as network namespaces only exist on Linux.
+func enterNetNS(string) error {
+	return errNetNSUnsupported
+}
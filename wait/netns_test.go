@@ -0,0 +1,82 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ownNetNSPath is the path of the network namespace of the test process, which can be entered
+// again without changing where connections are made from.
+const ownNetNSPath = "/proc/self/ns/net"
+
+// requireNetNS skips the test if network namespaces can not be entered.
+func requireNetNS(t *testing.T) {
+	t.Helper()
+
+	if runtime.GOOS != "linux" {
+		t.Skip("test requires Linux")
+	}
+	if err := CheckNetNS(ownNetNSPath); err != nil {
+		t.Skipf("test requires entering network namespaces: %s", err)
+	}
+}
+
+func TestCheckNetNS(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS != "linux" {
+		err := CheckNetNS(ownNetNSPath)
+		if !errors.Is(err, errNetNSUnsupported) {
+			t.Errorf("test failed - want: %q, got: %v", errNetNSUnsupported, err)
+		}
+		return
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing")
+	if err := CheckNetNS(missing); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("test missing failed - want not exist err, got: %v", err)
+	}
+
+	// Regular files are not namespaces, which entering them reports.
+	notNS := filepath.Join(t.TempDir(), "netns")
+	if err := os.WriteFile(notNS, nil, 0o600); err != nil {
+		t.Fatalf("test failed - can not write file: %s", err)
+	}
+	err := CheckNetNS(notNS)
+	if err == nil || !strings.HasPrefix(err.Error(), "can not enter network namespace ") {
+		t.Errorf("test not namespace failed - want err, got: %v", err)
+	}
+}
+
+func TestOneTCPNetNS(t *testing.T) {
+	t.Parallel()
+
+	requireNetNS(t)
+
+	var (
+		server = &tcpServer{host: tcpServerHost, port: getLocalTCPPort(), t: t}
+		spec   = &TCPSpec{
+			Host:     server.host,
+			Port:     server.port,
+			PollFreq: 100 * time.Millisecond,
+			NetNS:    ownNetNSPath,
+		}
+	)
+	_, cancel := server.start(context.Background())
+	defer cancel()
+
+	mb := newMessageBox(OneTCP(spec, 2*time.Second))
+	last := mb.msgs[mb.count()-1]
+	if last.Status() != Ready {
+		t.Errorf("test failed - want: %s, got: %s (%v)", Ready, last.Status(), last.Err())
+	}
+}
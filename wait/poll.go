@@ -0,0 +1,175 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	// jitterRand is the random number generator for poll interval jitters.
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano())) // nolint: gosec
+	// jitterRandMu guards access to jitterRand and to the jitterRand of all poll timings.
+	jitterRandMu sync.Mutex
+)
+
+// pollTiming is when the checks of a wait operation are made, as set in its specifications.
+type pollTiming struct {
+	// freq is the poll frequency.
+	freq time.Duration
+	// jitter is the maximum fraction by which each poll interval randomly deviates from freq.
+	jitter float64
+	// skipImmediateCheck is whether the first check is made only after the first poll interval.
+	skipImmediateCheck bool
+	// jitterRand is the random number generator for jitter. If nil, the shared jitterRand is used.
+	jitterRand *rand.Rand
+}
+
+// interval returns the duration until the next check. This is the poll frequency, randomly varied
+// by up to the jitter fraction.
+func (timing pollTiming) interval() time.Duration {
+	if timing.jitter <= 0 {
+		return timing.freq
+	}
+
+	rng := timing.jitterRand
+	if rng == nil {
+		rng = jitterRand
+	}
+	jitterRandMu.Lock()
+	factor := 2*rng.Float64() - 1
+	jitterRandMu.Unlock()
+
+	return timing.freq + time.Duration(factor*timing.jitter*float64(timing.freq))
+}
+
+// poll runs the given check every poll interval of the given timing, until the check returns a
+// final message or the context is cancelled, in which case the message returned by `cancelled` is
+// final. The check returns the zero value, i.e. nil, to keep polling, and is told whether it is
+// the first check made right at the start, which the timing may skip. All messages are sent
+// through the returned channel, starting with the given Start message.
+func poll[M comparable](
+	ctx context.Context,
+	timing pollTiming,
+	start M,
+	check func(immediate bool) M,
+	cancelled func() M,
+) <-chan M {
+	var (
+		out  = make(chan M, 2)
+		none M
+	)
+
+	// All checks run sequentially in the goroutine below, so at most one is in progress at any
+	// time. The first final message is sent only after the poll timer is stopped, and no check is
+	// made after it.
+	go func() {
+		pollTimer := time.NewTimer(timing.interval())
+		defer pollTimer.Stop()
+
+		defer close(out)
+
+		finish := func(msg M) {
+			pollTimer.Stop()
+			out <- msg
+		}
+
+		out <- start
+
+		// So that we start polling immediately, without waiting for the first tick.
+		if !timing.skipImmediateCheck {
+			if msg := check(true); msg != none {
+				finish(msg)
+				return
+			}
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				finish(cancelled())
+				return
+
+			case tick := <-pollTimer.C:
+				// Both cases may be ready at the same time, in which case the select statement
+				// picks one at random. Cancellation must win, so no check is made after it.
+				if ctx.Err() != nil {
+					finish(cancelled())
+					return
+				}
+				if msg := check(false); msg != none {
+					finish(msg)
+					return
+				}
+				// Measure the next interval from the current tick, like a ticker would.
+				next := timing.interval() - time.Since(tick)
+				if next < 0 {
+					next = 0
+				}
+				pollTimer.Reset(next)
+			}
+		}
+	}()
+
+	return out
+}
+
+// singleMessage holds what the messages of wait operations on single targets have in common, so
+// that each kind of message only needs to add its specifications and target.
+type singleMessage struct {
+	// status is the wait operation status.
+	status Status
+	// startTime is when the wait operation starts, from which the elapsed time is measured.
+	startTime time.Time
+	// emitTime is when the message is created and emitted.
+	emitTime time.Time
+	// err is any operation that may have occurred.
+	err error
+	// attempts is the number of attempts made before the message was emitted.
+	attempts int
+}
+
+// newSingleMessage creates a new singleMessage with the given status and error.
+func newSingleMessage(status Status, startTime time.Time, attempts int, err error) singleMessage {
+	return singleMessage{
+		status:    status,
+		startTime: startTime,
+		emitTime:  time.Now(),
+		err:       err,
+		attempts:  attempts,
+	}
+}
+
+// Status returns the status of the message.
+func (msg *singleMessage) Status() Status {
+	return msg.status
+}
+
+// Err returns the error contained in the message, if any.
+func (msg *singleMessage) Err() error {
+	return msg.err
+}
+
+// ElapsedTime returns the duration of the wait operation at the time of message creation.
+func (msg *singleMessage) ElapsedTime() time.Duration {
+	return msg.emitTime.Sub(msg.startTime)
+}
+
+// PendingTargets returns nil, since these messages always belong to a single target.
+func (msg *singleMessage) PendingTargets() []string {
+	return nil
+}
+
+// Attempts returns the number of attempts made before the message was emitted.
+func (msg *singleMessage) Attempts() int {
+	return msg.attempts
+}
+
+// Details returns an empty map, since there is nothing to negotiate by default.
+func (msg *singleMessage) Details() map[string]string {
+	return map[string]string{}
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPoll(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name          string
+		skipImmediate bool
+		checks        int
+		wantStatus    Status
+		wantImmediate []bool
+	}{
+		{"ready immediately", false, 1, Ready, []bool{true}},
+		{"ready after polling", false, 3, Ready, []bool{true, false, false}},
+		{"immediate check skipped", true, 1, Ready, []bool{false}},
+		{"cancelled", false, 0, Failed, nil},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				name        = test.name
+				startTime   = time.Now()
+				immediates  []bool
+				ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+			)
+			defer cancel()
+
+			newMsg := func(status Status, err error) *singleMessage {
+				msg := newSingleMessage(status, startTime, len(immediates), err)
+				return &msg
+			}
+			check := func(immediate bool) *singleMessage {
+				immediates = append(immediates, immediate)
+				if len(immediates) == test.checks {
+					return newMsg(Ready, nil)
+				}
+				return nil
+			}
+			cancelled := func() *singleMessage {
+				return newMsg(Failed, ctx.Err())
+			}
+
+			timing := pollTiming{freq: 20 * time.Millisecond, skipImmediateCheck: test.skipImmediate}
+			var statuses []Status
+			for msg := range poll(ctx, timing, newMsg(Start, nil), check, cancelled) {
+				statuses = append(statuses, msg.Status())
+			}
+
+			if want := []Status{Start, test.wantStatus}; !reflect.DeepEqual(statuses, want) {
+				t.Errorf("test[%d] %q failed - want: %v, got: %v", i, name, want, statuses)
+			}
+			if test.checks > 0 && !reflect.DeepEqual(immediates, test.wantImmediate) {
+				t.Errorf(
+					"test[%d] %q failed - want immediate checks: %v, got: %v",
+					i,
+					name,
+					test.wantImmediate,
+					immediates,
+				)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"time"
+)
+
+// errConnDropped is the error of connection attempts whose connection was closed by the server
+// before the hold duration passed.
+var errConnDropped = errors.New("connection was closed before hold duration passed")
+
+// responseReadSize is the default maximum number of bytes read from a connection when matching
+// banners or responses.
+const responseReadSize = 512
+
+// readSize returns the maximum number of bytes read from the server when matching Expect.
+func (spec *TCPSpec) readSize() int {
+	if spec.ReadBytes > 0 {
+		return spec.ReadBytes
+	}
+	return responseReadSize
+}
+
+// readTimeout returns how long to wait for the server to send data matching Expect.
+func (spec *TCPSpec) readTimeout() time.Duration {
+	if spec.ReadTimeout > 0 {
+		return spec.ReadTimeout
+	}
+	return spec.PollFreq
+}
+
+// probe checks whether the server behind the given connection is ready according to the
+// specifications. Servers are ready as soon as a connection is made, unless the specifications
+// set a payload or an expected pattern. In that case, the payload must be sent successfully and
+// the data sent back by the server must match the expected pattern. Sending takes at most as long
+// as the poll frequency, while receiving is limited by the read size and timeout.
+func (spec *TCPSpec) probe(conn net.Conn) bool {
+	if spec.Payload != "" {
+		if err := conn.SetWriteDeadline(time.Now().Add(spec.PollFreq)); err != nil {
+			return false
+		}
+		if _, err := io.WriteString(conn, spec.Payload); err != nil {
+			return false
+		}
+	}
+	if spec.Expect == nil {
+		return true
+	}
+	return readMatch(conn, spec.Expect, spec.readSize(), spec.readTimeout())
+}
+
+// verify checks whether the server behind the given connection is ready according to the
+// specifications, first by sending the PROXY protocol header if needed, then by probing it, and
+// finally by holding the connection open. It returns the error of sending the header, or
+// errProbeFailed or errConnDropped if the later steps fail, or nil if the server is ready.
+func (spec *TCPSpec) verify(ctx context.Context, conn net.Conn) error {
+	if err := spec.sendProxyHeader(conn); err != nil {
+		return err
+	}
+	if !spec.probe(conn) {
+		return errProbeFailed
+	}
+	if !holdOpen(ctx, conn, spec.Hold) {
+		return errConnDropped
+	}
+	return nil
+}
+
+// holdOpen keeps the given connection open for the given duration, discarding any data sent by the
+// server, and returns whether the connection was still open afterwards. Holding stops early if the
+// given context is done, in which case false is returned. Nothing is done if the duration is not
+// positive.
+func holdOpen(ctx context.Context, conn net.Conn, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(d)); err != nil {
+		return false
+	}
+
+	// Reads are not interrupted by cancellation, so the deadline is moved to end them instead.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	buf := make([]byte, responseReadSize)
+	for {
+		if _, err := conn.Read(buf); err != nil {
+			return os.IsTimeout(err) && ctx.Err() == nil
+		}
+	}
+}
+
+// readMatch reads from the given connection until the bytes read match the given pattern. It
+// returns false if no match is found after `size` bytes are read, after the connection is closed,
+// or after `timeout` has passed.
+func readMatch(conn net.Conn, pattern *regexp.Regexp, size int, timeout time.Duration) bool {
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return false
+	}
+
+	buf := make([]byte, 0, size)
+	for len(buf) < size {
+		n, err := conn.Read(buf[len(buf):size])
+		buf = buf[:len(buf)+n]
+		if n > 0 && pattern.Match(buf) {
+			return true
+		}
+		if err != nil {
+			return false
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,309 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestReadMatch(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name    string
+		chunks  []string
+		pattern string
+		size    int
+		want    bool
+	}{
+		{"single chunk", []string{"220 smtp ready\r\n"}, "^220 ", 512, true},
+		{"split chunks", []string{"22", "0 smtp"}, "^220 smtp", 512, true},
+		{"mismatch", []string{"SSH-2.0-OpenSSH\r\n"}, "^220 ", 512, false},
+		{"empty", []string{}, ".*", 512, false},
+		{"beyond size", []string{"xxxxxxxx", "220"}, "220", 8, false},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			client, server := net.Pipe()
+			defer client.Close()
+
+			go func() {
+				defer server.Close()
+				for _, chunk := range test.chunks {
+					if _, err := server.Write([]byte(chunk)); err != nil {
+						return
+					}
+				}
+			}()
+
+			name := test.name
+			want := test.want
+			got := readMatch(client, regexp.MustCompile(test.pattern), test.size, 1*time.Second)
+
+			if want != got {
+				t.Errorf("test[%d] %q failed - want: %t, got: %t", i, name, want, got)
+			}
+		})
+	}
+}
+
+// startBannerServer starts a TCP server that sends the given banner to every client and returns
+// its address.
+func startBannerServer(t *testing.T, banner string) *net.TCPAddr {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(tcpServerHost, "0"))
+	if err != nil {
+		t.Fatalf("failed starting test banner server: %s", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte(banner))
+			conn.Close()
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr)
+}
+
+func TestOneTCPBanner(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name       string
+		pattern    string
+		readBytes  int
+		wantStatus Status
+	}{
+		{"match", "^220 ", 0, Ready},
+		{"mismatch", "^SSH-", 0, Failed},
+		{"match within read bytes", "ready", 14, Ready},
+		{"match beyond read bytes", "ready", 8, Failed},
+	}
+
+	addr := startBannerServer(t, "220 smtp ready\r\n")
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			spec := &TCPSpec{
+				Host:      addr.IP.String(),
+				Port:      strconv.Itoa(addr.Port),
+				PollFreq:  200 * time.Millisecond,
+				Expect:    regexp.MustCompile(test.pattern),
+				ReadBytes: test.readBytes,
+			}
+
+			name := test.name
+			mb := newMessageBox(OneTCP(spec, 1*time.Second))
+			want := test.wantStatus
+			got := mb.msgs[mb.count()-1].Status()
+
+			if want != got {
+				t.Errorf("test[%d] %q failed - want: %s, got: %s", i, name, want, got)
+			}
+		})
+	}
+}
+
+// startPongServer starts a TCP server that replies `+PONG` to clients sending `PING`, and returns
+// its address.
+func startPongServer(t *testing.T) *net.TCPAddr {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(tcpServerHost, "0"))
+	if err != nil {
+		t.Fatalf("failed starting test pong server: %s", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				line, err := bufio.NewReader(conn).ReadString('\n')
+				if err == nil && line == "PING\r\n" {
+					_, _ = conn.Write([]byte("+PONG\r\n"))
+				}
+			}(conn)
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr)
+}
+
+func TestOneTCPPayload(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name       string
+		payload    string
+		wantStatus Status
+	}{
+		{"expected response", "PING\r\n", Ready},
+		{"no response", "HELLO\r\n", Failed},
+	}
+
+	addr := startPongServer(t)
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			spec := &TCPSpec{
+				Host:     addr.IP.String(),
+				Port:     strconv.Itoa(addr.Port),
+				PollFreq: 200 * time.Millisecond,
+				Payload:  test.payload,
+				Expect:   regexp.MustCompile(`^\+PONG`),
+			}
+
+			name := test.name
+			mb := newMessageBox(OneTCP(spec, 1*time.Second))
+			want := test.wantStatus
+			got := mb.msgs[mb.count()-1].Status()
+
+			if want != got {
+				t.Errorf("test[%d] %q failed - want: %s, got: %s", i, name, want, got)
+			}
+		})
+	}
+}
+
+func TestHoldOpen(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name       string
+		hold       time.Duration
+		sendData   bool
+		closeAfter time.Duration
+		cancel     bool
+		want       bool
+	}{
+		{"no hold", 0, false, 10 * time.Millisecond, false, true},
+		{"stays open", 100 * time.Millisecond, false, 0, false, true},
+		{"sends data and stays open", 100 * time.Millisecond, true, 0, false, true},
+		{"closed during hold", 500 * time.Millisecond, false, 20 * time.Millisecond, false, false},
+		{"cancelled", 500 * time.Millisecond, false, 0, true, false},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+
+			go func() {
+				if test.sendData {
+					_, _ = server.Write([]byte("hello"))
+				}
+				if test.closeAfter > 0 {
+					time.Sleep(test.closeAfter)
+					server.Close()
+				}
+			}()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if test.cancel {
+				time.AfterFunc(20*time.Millisecond, cancel)
+			}
+
+			name := test.name
+			start := time.Now()
+			got := holdOpen(ctx, client, test.hold)
+
+			if got != test.want {
+				t.Errorf("test[%d] %q failed - want: %t, got: %t", i, name, test.want, got)
+			}
+			if elapsed := time.Since(start); elapsed > test.hold+200*time.Millisecond {
+				t.Errorf("test[%d] %q failed - want return within hold, took: %s", i, name, elapsed)
+			}
+		})
+	}
+}
+
+func TestOneTCPHold(t *testing.T) {
+	t.Parallel()
+
+	// Connections to a listener that never accepts them are still established, and stay open.
+	listener, err := net.Listen("tcp", net.JoinHostPort(tcpServerHost, "0"))
+	if err != nil {
+		t.Fatalf("failed starting test listener: %s", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	var (
+		openAddr    = listener.Addr().(*net.TCPAddr)
+		closingAddr = startBannerServer(t, "220 smtp ready\r\n")
+		tests       = []struct {
+			name       string
+			addr       *net.TCPAddr
+			wantStatus Status
+		}{
+			{"stays open", openAddr, Ready},
+			{"closed by server", closingAddr, Failed},
+		}
+	)
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			spec := &TCPSpec{
+				Host:     test.addr.IP.String(),
+				Port:     strconv.Itoa(test.addr.Port),
+				PollFreq: 100 * time.Millisecond,
+				Hold:     100 * time.Millisecond,
+			}
+
+			name := test.name
+			mb := newMessageBox(OneTCP(spec, 1*time.Second))
+			want := test.wantStatus
+			got := mb.msgs[mb.count()-1].Status()
+
+			if want != got {
+				t.Errorf("test[%d] %q failed - want: %s, got: %s", i, name, want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+// ProgressUpdate is a snapshot of the aggregate progress of a wait operation on multiple targets.
+type ProgressUpdate struct {
+	// Ready is the number of targets that are ready.
+	Ready int
+	// Failed is the number of targets whose wait operations failed.
+	Failed int
+	// Pending is the number of targets that are still being waited.
+	Pending int
+	// Total is the number of targets being waited.
+	Total int
+}
+
+// Progress consumes the messages of a wait operation on `total` targets, such as those returned by
+// AllTCP, and returns a channel through which a ProgressUpdate is sent every time a target becomes
+// ready or fails. Messages that do not belong to a single target, such as the timeout message of
+// AllTCP, do not trigger updates. The returned channel is closed after the input channel is
+// closed.
+func Progress(msgs <-chan *TCPMessage, total int) <-chan ProgressUpdate {
+	out := make(chan ProgressUpdate)
+
+	go func() {
+		defer close(out)
+
+		update := ProgressUpdate{Pending: total, Total: total}
+		for msg := range msgs {
+			if msg.spec == nil {
+				continue
+			}
+			switch msg.Status() {
+			case Ready:
+				update.Ready++
+			case Failed:
+				update.Failed++
+			case Start:
+				continue
+			}
+			update.Pending = total - update.Ready - update.Failed
+			out <- update
+		}
+	}()
+
+	return out
+}
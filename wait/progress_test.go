@@ -0,0 +1,55 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	t.Parallel()
+
+	var (
+		startTime = time.Now()
+		specs     = []*TCPSpec{
+			{Host: "localhost", Port: "7000", PollFreq: 1 * time.Second},
+			{Host: "localhost", Port: "7001", PollFreq: 1 * time.Second},
+			{Host: "localhost", Port: "7002", PollFreq: 1 * time.Second},
+		}
+		msgs = []*TCPMessage{
+			newTCPMessageStart(specs[0], startTime),
+			newTCPMessageStart(specs[1], startTime),
+			newTCPMessageStart(specs[2], startTime),
+			newTCPMessageReady(specs[1], startTime),
+			newTCPMessageFailed(specs[0], startTime, fmt.Errorf("stub")),
+			newTCPMessageFailed(nil, startTime, &TimeoutError{Limit: 1 * time.Second}),
+		}
+		want = []ProgressUpdate{
+			{Ready: 1, Failed: 0, Pending: 2, Total: 3},
+			{Ready: 1, Failed: 1, Pending: 1, Total: 3},
+		}
+	)
+
+	in := make(chan *TCPMessage, len(msgs))
+	for _, msg := range msgs {
+		in <- msg
+	}
+	close(in)
+
+	got := make([]ProgressUpdate, 0)
+	for update := range Progress(in, len(specs)) {
+		got = append(got, update)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("test failed - want %d updates, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if want[i] != got[i] {
+			t.Errorf("test[%d] failed - want: %+v, got: %+v", i, want[i], got[i])
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+)
+
+var (
+	// proxyEnvVars are the environment variables from which the proxy URL is read, in order of
+	// precedence.
+	proxyEnvVars = []string{"ALL_PROXY", "all_proxy", "HTTP_PROXY", "http_proxy"}
+	// noProxyEnvVars are the environment variables from which the hosts that are connected to
+	// directly are read, in order of precedence.
+	noProxyEnvVars = []string{"NO_PROXY", "no_proxy"}
+	// proxySchemes are the supported proxy URL schemes.
+	proxySchemes = map[string]bool{"socks5": true, "socks5h": true, "http": true}
+	// errProxyTargetUnavailable is the error returned when a proxy server reports that the target
+	// server is not (yet) accepting connections.
+	errProxyTargetUnavailable = errors.New("target unavailable through proxy")
+)
+
+func init() {
+	proxy.RegisterDialerType("http", newHTTPConnectDialer)
+}
+
+// ParseProxyURL parses the given raw proxy URL and then returns a pointer to it. The supported
+// schemes are `socks5`, `socks5h`, and `http`. The latter tunnels connections through the proxy
+// using the HTTP CONNECT method.
+func ParseProxyURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if !proxySchemes[u.Scheme] {
+		return nil, fmt.Errorf("unsupported proxy scheme: %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("proxy host not given: %q", rawURL)
+	}
+	return u, nil
+}
+
+// ProxyFromEnvironment returns the proxy URL for connections to the given address, in the form of
+// `host:port`, as set in the ALL_PROXY or HTTP_PROXY environment variables, or their lowercase
+// variants, in that order. Hosts matching the NO_PROXY environment variable or its lowercase
+// variant, as well as `localhost` and loopback addresses, are connected to directly, following
+// the same rules as http.ProxyFromEnvironment. If there is no proxy for the address, nil is
+// returned.
+func ProxyFromEnvironment(addr string) (*url.URL, error) {
+	name, rawURL := lookupEnv(proxyEnvVars)
+	if rawURL == "" {
+		return nil, nil
+	}
+	u, err := ParseProxyURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+
+	_, noProxy := lookupEnv(noProxyEnvVars)
+	cfg := httpproxy.Config{HTTPProxy: u.String(), NoProxy: noProxy}
+	if viaProxy, err := cfg.ProxyFunc()(&url.URL{Scheme: "http", Host: addr}); viaProxy == nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// lookupEnv returns the name and value of the first of the given environment variables that is
+// set to a non-empty value. If there is none, empty strings are returned.
+func lookupEnv(names []string) (string, string) {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return name, value
+		}
+	}
+	return "", ""
+}
+
+// proxyDialer dials connections through a proxy server.
+type proxyDialer struct {
+	dialer proxy.Dialer
+}
+
+// newProxyDialer creates a proxyDialer for the given proxy URL. Connections to the proxy server
+// itself are made using the given forward dialer.
+func newProxyDialer(proxyURL *url.URL, forward *net.Dialer) (*proxyDialer, error) {
+	dialer, err := proxy.FromURL(proxyURL, forward)
+	if err != nil {
+		return nil, err
+	}
+	return &proxyDialer{dialer: dialer}, nil
+}
+
+// DialContext connects to the given address through the proxy server. Proxy replies indicating that
+// the target server refused the connection are returned as errors wrapping
+// errProxyTargetUnavailable, so that they can be retried just like direct connections.
+func (d *proxyDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	var (
+		conn net.Conn
+		err  error
+	)
+	if cd, isContextDialer := d.dialer.(proxy.ContextDialer); isContextDialer {
+		conn, err = cd.DialContext(ctx, network, addr)
+	} else {
+		conn, err = d.dialer.Dial(network, addr)
+	}
+	if err != nil && isSOCKSRefused(err) {
+		return nil, fmt.Errorf("%w: %s", errProxyTargetUnavailable, err)
+	}
+	return conn, err
+}
+
+// isSOCKSRefused checks whether the given error is a SOCKS reply indicating that the target server
+// refused the connection.
+func isSOCKSRefused(err error) bool {
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) || !strings.HasPrefix(opErr.Op, "socks") {
+		return false
+	}
+	return strings.HasSuffix(opErr.Err.Error(), "connection refused")
+}
+
+// httpConnectDialer is a proxy.Dialer that tunnels connections through an HTTP proxy server using
+// the CONNECT method.
+type httpConnectDialer struct {
+	proxyAddr string
+	user      *url.Userinfo
+	forward   proxy.Dialer
+}
+
+// newHTTPConnectDialer creates an httpConnectDialer for the given proxy URL. If the URL does not
+// specify a port, the default HTTP port is used.
+func newHTTPConnectDialer(proxyURL *url.URL, forward proxy.Dialer) (proxy.Dialer, error) {
+	port := proxyURL.Port()
+	if port == "" {
+		port = protoPort["http"]
+	}
+	return &httpConnectDialer{
+		proxyAddr: net.JoinHostPort(proxyURL.Hostname(), port),
+		user:      proxyURL.User,
+		forward:   forward,
+	}, nil
+}
+
+// Dial connects to the given address through the proxy server.
+func (d *httpConnectDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// DialContext connects to the given address through the proxy server, using the given context for
+// the connection to the proxy server and the CONNECT request.
+func (d *httpConnectDialer) DialContext(
+	ctx context.Context,
+	network, addr string,
+) (net.Conn, error) {
+	var (
+		conn net.Conn
+		err  error
+	)
+	if cd, isContextDialer := d.forward.(proxy.ContextDialer); isContextDialer {
+		conn, err = cd.DialContext(ctx, network, d.proxyAddr)
+	} else {
+		conn, err = d.forward.Dial(network, d.proxyAddr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, hasDeadline := ctx.Deadline(); hasDeadline {
+		_ = conn.SetDeadline(deadline)
+		defer func() { _ = conn.SetDeadline(time.Time{}) }()
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if d.user != nil {
+		password, _ := d.user.Password()
+		creds := base64.StdEncoding.EncodeToString([]byte(d.user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+creds)
+	}
+	if err = req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		conn.Close()
+		return nil, fmt.Errorf("%w: proxy responded with %q", errProxyTargetUnavailable, resp.Status)
+	default:
+		conn.Close()
+		return nil, fmt.Errorf("proxy responded with %q", resp.Status)
+	}
+
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a net.Conn whose reads are served from a buffered reader first, so that bytes
+// read ahead while parsing the proxy response are not lost.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// Read reads data from the underlying buffered reader.
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// proxyV2Signature is the signature that starts every version 2 PROXY protocol header.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ParseProxyProtocol parses the given PROXY protocol version, given as `v1` or `v2`, into the
+// version number accepted by TCPSpec.
+func ParseProxyProtocol(rawVersion string) (int, error) {
+	switch strings.ToLower(rawVersion) {
+	case "v1":
+		return 1, nil
+	case "v2":
+		return 2, nil
+	default:
+		return 0, fmt.Errorf("invalid PROXY protocol version, want v1 or v2, got: %q", rawVersion)
+	}
+}
+
+// proxyHeader creates the PROXY protocol header of the given version for the given connection,
+// with the local address of the connection as the source and its remote address as the
+// destination. If the addresses are not TCP addresses of the same IP version, the header tells the
+// server that the source is unknown.
+func proxyHeader(version int, conn net.Conn) ([]byte, error) {
+	var (
+		src, srcOK = conn.LocalAddr().(*net.TCPAddr)
+		dst, dstOK = conn.RemoteAddr().(*net.TCPAddr)
+		srcIP      net.IP
+		dstIP      net.IP
+	)
+	if srcOK && dstOK {
+		srcIP, dstIP = src.IP.To4(), dst.IP.To4()
+		switch {
+		case srcIP == nil && dstIP == nil:
+			srcIP, dstIP = src.IP.To16(), dst.IP.To16()
+		case srcIP == nil || dstIP == nil:
+			srcIP, dstIP = nil, nil
+		}
+	}
+
+	switch version {
+	case 1:
+		if srcIP == nil || dstIP == nil {
+			return []byte("PROXY UNKNOWN\r\n"), nil
+		}
+		proto := "TCP4"
+		if len(srcIP) == net.IPv6len {
+			proto = "TCP6"
+		}
+		header := fmt.Sprintf("PROXY %s %s %s %d %d\r\n", proto, srcIP, dstIP, src.Port, dst.Port)
+		return []byte(header), nil
+
+	case 2:
+		header := append([]byte{}, proxyV2Signature...)
+		if srcIP == nil || dstIP == nil {
+			// Version 2, LOCAL command, unspecified family, and no addresses.
+			return append(header, 0x20, 0x00, 0x00, 0x00), nil
+		}
+		family := byte(0x11) // TCP over IPv4.
+		if len(srcIP) == net.IPv6len {
+			family = 0x21 // TCP over IPv6.
+		}
+		// Version 2 and PROXY command, followed by the family and the length of the addresses.
+		header = append(header, 0x21, family, 0, 0)
+		binary.BigEndian.PutUint16(header[len(header)-2:], uint16(2*len(srcIP)+4))
+		header = append(header, srcIP...)
+		header = append(header, dstIP...)
+		header = append(header, 0, 0, 0, 0)
+		binary.BigEndian.PutUint16(header[len(header)-4:], uint16(src.Port))
+		binary.BigEndian.PutUint16(header[len(header)-2:], uint16(dst.Port))
+		return header, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported PROXY protocol version: %d", version)
+	}
+}
+
+// sendProxyHeader sends the PROXY protocol header of the specifications to the server behind the
+// given connection, taking at most as long as the poll frequency. Nothing is sent if the
+// specifications do not set a PROXY protocol version.
+func (spec *TCPSpec) sendProxyHeader(conn net.Conn) error {
+	if spec.ProxyProtocol == 0 {
+		return nil
+	}
+	header, err := proxyHeader(spec.ProxyProtocol, conn)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetWriteDeadline(time.Now().Add(spec.PollFreq)); err != nil {
+		return err
+	}
+	if _, err := conn.Write(header); err != nil {
+		return fmt.Errorf("can not send PROXY protocol header: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseProxyProtocol(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		in      string
+		want    int
+		wantErr string
+	}{
+		{"v1", 1, ""},
+		{"V2", 2, ""},
+		{"v3", 0, "invalid PROXY protocol version, want v1 or v2, got: \"v3\""},
+		{"1", 0, "invalid PROXY protocol version, want v1 or v2, got: \"1\""},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.in, func(t *testing.T) {
+			t.Parallel()
+
+			wantErr := test.wantErr
+			got, gotErr := ParseProxyProtocol(test.in)
+
+			if (wantErr == "" && gotErr != nil) || (wantErr != "" && fmt.Sprint(gotErr) != wantErr) {
+				t.Errorf("test[%d] %q failed - want err: %q, got: %v", i, test.in, wantErr, gotErr)
+			}
+			if got != test.want {
+				t.Errorf("test[%d] %q failed - want: %d, got: %d", i, test.in, test.want, got)
+			}
+		})
+	}
+}
+
+// addrConn is a net.Conn with fixed local and remote addresses, for testing.
+type addrConn struct {
+	net.Conn
+	local, remote net.Addr
+}
+
+func (c *addrConn) LocalAddr() net.Addr  { return c.local }
+func (c *addrConn) RemoteAddr() net.Addr { return c.remote }
+
+func TestProxyHeader(t *testing.T) {
+	t.Parallel()
+
+	var (
+		v4Src = &net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 56324}
+		v4Dst = &net.TCPAddr{IP: net.ParseIP("192.168.0.11"), Port: 443}
+		v6Src = &net.TCPAddr{IP: net.ParseIP("::1"), Port: 56324}
+		v6Dst = &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 443}
+		sig   = string(proxyV2Signature)
+		tests = []struct {
+			name    string
+			version int
+			local   net.Addr
+			remote  net.Addr
+			want    string
+		}{
+			{"v1 IPv4", 1, v4Src, v4Dst, "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"},
+			{"v1 IPv6", 1, v6Src, v6Dst, "PROXY TCP6 ::1 2001:db8::1 56324 443\r\n"},
+			{"v1 mixed", 1, v4Src, v6Dst, "PROXY UNKNOWN\r\n"},
+			{"v1 not TCP", 1, &net.UnixAddr{Name: "/run/wf.sock"}, v4Dst, "PROXY UNKNOWN\r\n"},
+			{
+				"v2 IPv4",
+				2,
+				v4Src,
+				v4Dst,
+				sig + "\x21\x11\x00\x0c\xc0\xa8\x00\x01\xc0\xa8\x00\x0b\xdc\x04\x01\xbb",
+			},
+			{
+				"v2 IPv6",
+				2,
+				v6Src,
+				v6Dst,
+				sig + "\x21\x21\x00\x24" +
+					"\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01" +
+					"\x20\x01\x0d\xb8\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01" +
+					"\xdc\x04\x01\xbb",
+			},
+			{"v2 mixed", 2, v6Src, v4Dst, sig + "\x20\x00\x00\x00"},
+		}
+	)
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			want := []byte(test.want)
+			got, err := proxyHeader(test.version, &addrConn{local: test.local, remote: test.remote})
+
+			if err != nil {
+				t.Fatalf("test[%d] %q failed - want no err, got: %s", i, name, err)
+			}
+			if !bytes.Equal(want, got) {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, name, want, got)
+			}
+		})
+	}
+}
+
+// startProxiedServer starts a TCP server that replies `+OK` to clients that send a version 1 PROXY
+// protocol header, and closes the connection of any other client. It returns its address.
+func startProxiedServer(t *testing.T) *net.TCPAddr {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(tcpServerHost, "0"))
+	if err != nil {
+		t.Fatalf("failed starting test proxied server: %s", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+				line, err := bufio.NewReader(conn).ReadString('\n')
+				if err == nil && strings.HasPrefix(line, "PROXY TCP4 ") {
+					_, _ = conn.Write([]byte("+OK\r\n"))
+				}
+			}(conn)
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr)
+}
+
+func TestOneTCPProxyProtocol(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name          string
+		proxyProtocol int
+		wantStatus    Status
+	}{
+		{"header sent", 1, Ready},
+		{"no header", 0, Failed},
+	}
+
+	addr := startProxiedServer(t)
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			spec := &TCPSpec{
+				Host:          addr.IP.String(),
+				Port:          strconv.Itoa(addr.Port),
+				PollFreq:      100 * time.Millisecond,
+				ProxyProtocol: test.proxyProtocol,
+				Expect:        regexp.MustCompile(`^\+OK`),
+			}
+
+			name := test.name
+			mb := newMessageBox(OneTCP(spec, 500*time.Millisecond))
+			want := test.wantStatus
+			got := mb.msgs[mb.count()-1].Status()
+
+			if want != got {
+				t.Errorf("test[%d] %q failed - want: %s, got: %s", i, name, want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// QuorumError is the error for quorum wait operations that ended before enough targets were ready.
+type QuorumError struct {
+	// Ready is the number of targets that were ready.
+	Ready int
+	// Want is the number of targets that had to be ready.
+	Want int
+	// Err is the error that ended the wait operation, such as a *TimeoutError.
+	Err error
+}
+
+// Error returns the error message.
+func (e *QuorumError) Error() string {
+	return fmt.Sprintf("only %d of %d required targets ready: %s", e.Ready, e.Want, e.Err)
+}
+
+// Unwrap returns the error that ended the wait operation.
+func (e *QuorumError) Unwrap() error {
+	return e.Err
+}
+
+// QuorumTCP waits until connections can be made to at least `k` of the given TCP input
+// specifications for at most `waitTimeout` long. It returns a channel through which all wait
+// operation-related messages will be sent. Once `k` targets are ready, the remaining wait
+// operations are stopped and a final Ready message with `<all>` as its target is sent.
+// If the timeout limit is exceeded or too many targets fail for `k` of them to be ready, a final
+// Failed message with a *QuorumError is sent instead. `k` must be between 1 and the number of
+// specifications, otherwise only a Failed message is sent. As in AllTCP, a `waitTimeout` of
+// NoTimeout waits without a timeout limit. The returned channel is closed after the final message.
+func QuorumTCP(specs []*TCPSpec, k int, waitTimeout time.Duration) <-chan *TCPMessage {
+	return quorumTCP(specs, k, waitTimeout, singleTCP)
+}
+
+// QuorumClosed is the inverse of QuorumTCP: it waits until connections to at least `k` of the given
+// TCP input specifications are refused, i.e. until `k` of the target servers are down, for at most
+// `waitTimeout` long. Each target that is down is reported with a Ready message, after which the
+// final messages are sent as in QuorumTCP. The Ready field of its *QuorumError counts the targets
+// that were down. `k` must be between 1 and the number of specifications, otherwise only a Failed
+// message is sent. The returned channel is closed after the final message.
+func QuorumClosed(specs []*TCPSpec, k int, waitTimeout time.Duration) <-chan *TCPMessage {
+	return quorumTCP(specs, k, waitTimeout, singleTCPClosed)
+}
+
+// quorumTCP counts the Ready messages of the given single-target wait operation over all the given
+// specifications, and ends once `k` of them are ready.
+func quorumTCP(
+	specs []*TCPSpec,
+	k int,
+	waitTimeout time.Duration,
+	single func(context.Context, *TCPSpec) <-chan *TCPMessage,
+) <-chan *TCPMessage {
+	var (
+		out         = make(chan *TCPMessage)
+		ctx, cancel = newContext(context.Background())
+	)
+
+	if k < 1 || k > len(specs) {
+		go func() {
+			defer close(out)
+			defer cancel()
+			out <- newAggregateMessage(
+				ctx,
+				allTargetsLabel,
+				Failed,
+				fmt.Errorf("quorum must be between 1 and %d, got: %d", len(specs), k),
+			)
+		}()
+		return out
+	}
+
+	var (
+		chs     = make([](<-chan *TCPMessage), len(specs))
+		pending = make(map[*TCPSpec]bool, len(specs))
+	)
+	for i, spec := range specs {
+		pending[spec] = true
+		chs[i] = single(ctx, spec)
+	}
+
+	msgs := merge(ctx, chs)
+	timeoutC, stopTimeout := startTimeout(waitTimeout)
+
+	go func() {
+		defer close(out)
+		defer stopTimeout()
+		defer cancel()
+
+		ready := 0
+		for {
+			select {
+			case <-timeoutC:
+				msg := newTimeoutMessage(ctx, specs, pending, waitTimeout)
+				msg.err = &QuorumError{Ready: ready, Want: k, Err: msg.err}
+				out <- msg
+				return
+
+			case msg, isOpen := <-msgs:
+				if !isOpen {
+					return
+				}
+				if msg.status != Start {
+					delete(pending, msg.spec)
+				}
+				out <- msg
+
+				switch {
+				case msg.status == Ready:
+					ready++
+					if ready == k {
+						out <- newAggregateMessage(ctx, allTargetsLabel, Ready, nil)
+						return
+					}
+				case msg.status == Failed && ready+len(pending) < k:
+					out <- newAggregateMessage(
+						ctx,
+						allTargetsLabel,
+						Failed,
+						&QuorumError{Ready: ready, Want: k, Err: msg.err},
+					)
+					return
+				}
+			}
+		}
+	}()
+
+	return out
+}
@@ -0,0 +1,268 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestQuorumTCPReady(t *testing.T) {
+	t.Parallel()
+
+	var (
+		servers = []*tcpServer{
+			{tcpServerHost, getLocalTCPPort(), 10 * time.Second, t},
+			{tcpServerHost, getLocalTCPPort(), 500 * time.Millisecond, t},
+			{tcpServerHost, getLocalTCPPort(), 500 * time.Millisecond, t},
+		}
+		group = tcpServerGroup{servers: servers, t: t}
+		specs = make([]*TCPSpec, len(servers))
+	)
+	for i, server := range servers {
+		specs[i] = &TCPSpec{Host: server.host, Port: server.port, PollFreq: 200 * time.Millisecond}
+	}
+
+	_, cancel := group.start(context.Background())
+	defer cancel()
+
+	// There must be 3 Start messages, 2 Ready messages, and the final Ready message.
+	mb := newMessageBox(QuorumTCP(specs, 2, 5*time.Second))
+	if msgCount := mb.count(); msgCount != 6 {
+		t.Fatalf("test failed - want %d messages, got %d", 6, msgCount)
+	}
+
+	last := mb.msgs[mb.count()-1]
+	if status := last.Status(); status != Ready {
+		t.Errorf("test msgs[-1].Status() failed - want: %s, got: %s", Ready, status)
+	}
+	if target := last.Target(); target != "<all>" {
+		t.Errorf("test msgs[-1].Target() failed - want: %q, got: %q", "<all>", target)
+	}
+	if elTime := last.ElapsedTime(); elTime >= 5*time.Second {
+		t.Errorf("test failed - elapsed time %s exceeded timeout limit of %s", elTime, 5*time.Second)
+	}
+	if msgCount := mb.filterByTCPAddr(servers[0].addr()).count(); msgCount != 1 {
+		t.Errorf("test failed - want %d message for unready server, got %d", 1, msgCount)
+	}
+}
+
+func TestQuorumTCPTimeout(t *testing.T) {
+	t.Parallel()
+
+	var (
+		servers = []*tcpServer{
+			{tcpServerHost, getLocalTCPPort(), 10 * time.Second, t},
+			{tcpServerHost, getLocalTCPPort(), 500 * time.Millisecond, t},
+		}
+		group = tcpServerGroup{servers: servers, t: t}
+		specs = []*TCPSpec{
+			{Host: servers[0].host, Port: servers[0].port, PollFreq: 200 * time.Millisecond},
+			{Host: servers[1].host, Port: servers[1].port, PollFreq: 200 * time.Millisecond},
+		}
+	)
+
+	_, cancel := group.start(context.Background())
+	defer cancel()
+
+	mb := newMessageBox(QuorumTCP(specs, 2, 2*time.Second))
+	last := mb.msgs[mb.count()-1]
+	if status := last.Status(); status != Failed {
+		t.Fatalf("test msgs[-1].Status() failed - want: %s, got: %s", Failed, status)
+	}
+
+	var (
+		quorumErr  *QuorumError
+		timeoutErr *TimeoutError
+	)
+	if err := last.Err(); !errors.As(err, &quorumErr) || !errors.As(err, &timeoutErr) {
+		t.Fatalf("test msgs[-1].Err() failed - want: *QuorumError with *TimeoutError, got: %v", err)
+	}
+	if quorumErr.Ready != 1 || quorumErr.Want != 2 {
+		t.Errorf("test failed - want 1 of 2 ready, got %d of %d", quorumErr.Ready, quorumErr.Want)
+	}
+	wantPending := specs[0].Target()
+	if pending := last.PendingTargets(); len(pending) != 1 || pending[0] != wantPending {
+		t.Errorf("test msgs[-1].PendingTargets() failed - want: [%s], got: %v", wantPending, pending)
+	}
+}
+
+func TestQuorumTCPUnreachable(t *testing.T) {
+	t.Parallel()
+
+	var (
+		dialErr = errors.New("no route to host")
+		specs   = []*TCPSpec{
+			{
+				Host:     "flaky.invalid",
+				Port:     "5000",
+				PollFreq: 50 * time.Millisecond,
+				Dialer:   &flakyDialer{refusals: 1000, err: dialErr},
+			},
+			{
+				Host:     "flaky.invalid",
+				Port:     "5001",
+				PollFreq: 50 * time.Millisecond,
+				Dialer:   &flakyDialer{refusals: 1000},
+			},
+		}
+	)
+
+	// Once the first target fails, the quorum can no longer be reached.
+	mb := newMessageBox(QuorumTCP(specs, 2, 5*time.Second))
+	last := mb.msgs[mb.count()-1]
+
+	var quorumErr *QuorumError
+	if err := last.Err(); !errors.As(err, &quorumErr) || !errors.Is(err, dialErr) {
+		t.Fatalf("test msgs[-1].Err() failed - want: *QuorumError with %q, got: %v", dialErr, err)
+	}
+	if elTime := last.ElapsedTime(); elTime >= 5*time.Second {
+		t.Errorf("test failed - elapsed time %s reached timeout limit of %s", elTime, 5*time.Second)
+	}
+}
+
+func TestQuorumTCPInvalidK(t *testing.T) {
+	t.Parallel()
+
+	var (
+		specs = []*TCPSpec{
+			{Host: "localhost", Port: "5000", PollFreq: time.Second},
+			{Host: "localhost", Port: "5001", PollFreq: time.Second},
+		}
+		tests = []struct {
+			name   string
+			quorum func([]*TCPSpec, int, time.Duration) <-chan *TCPMessage
+			k      int
+			want   string
+		}{
+			{"zero", QuorumTCP, 0, "quorum must be between 1 and 2, got: 0"},
+			{"too large", QuorumTCP, 3, "quorum must be between 1 and 2, got: 3"},
+			{"closed zero", QuorumClosed, 0, "quorum must be between 1 and 2, got: 0"},
+			{"closed too large", QuorumClosed, 3, "quorum must be between 1 and 2, got: 3"},
+		}
+	)
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			mb := newMessageBox(test.quorum(specs, test.k, time.Second))
+			if msgCount := mb.count(); msgCount != 1 {
+				t.Fatalf("test[%d] %q failed - want %d message, got %d", i, test.name, 1, msgCount)
+			}
+			if got := mb.msgs[0].Err(); got == nil || got.Error() != test.want {
+				t.Errorf("test[%d] %q failed - want: %q, got: %v", i, test.name, test.want, got)
+			}
+		})
+	}
+}
+
+// startAcceptingServer starts a TCP server that accepts and closes all connections until it is
+// closed. It returns the server's listener.
+func startAcceptingServer(t *testing.T) net.Listener {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(tcpServerHost, "0"))
+	if err != nil {
+		t.Fatalf("failed starting test accepting server: %s", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	return listener
+}
+
+// newListenerSpec creates the specifications for waiting on the given listener.
+func newListenerSpec(listener net.Listener) *TCPSpec {
+	addr := listener.Addr().(*net.TCPAddr)
+	return &TCPSpec{
+		Host:     addr.IP.String(),
+		Port:     strconv.Itoa(addr.Port),
+		PollFreq: 100 * time.Millisecond,
+	}
+}
+
+func TestQuorumClosedReady(t *testing.T) {
+	t.Parallel()
+
+	var (
+		up       = startAcceptingServer(t)
+		stopping = startAcceptingServer(t)
+		specs    = []*TCPSpec{
+			newListenerSpec(up),
+			{Host: tcpServerHost, Port: getLocalTCPPort(), PollFreq: 100 * time.Millisecond},
+			newListenerSpec(stopping),
+		}
+	)
+	time.AfterFunc(300*time.Millisecond, func() { stopping.Close() })
+
+	// There must be 3 Start messages, 2 Ready messages, and the final Ready message.
+	mb := newMessageBox(QuorumClosed(specs, 2, 5*time.Second))
+	if msgCount := mb.count(); msgCount != 6 {
+		t.Fatalf("test failed - want %d messages, got %d", 6, msgCount)
+	}
+
+	last := mb.msgs[mb.count()-1]
+	if status := last.Status(); status != Ready {
+		t.Errorf("test msgs[-1].Status() failed - want: %s, got: %s", Ready, status)
+	}
+	if target := last.Target(); target != "<all>" {
+		t.Errorf("test msgs[-1].Target() failed - want: %q, got: %q", "<all>", target)
+	}
+	if elTime := last.ElapsedTime(); elTime < 300*time.Millisecond {
+		t.Errorf("test failed - elapsed time %s is shorter than server shutdown", elTime)
+	}
+	if msgCount := mb.filterByTCPAddr(specs[0].Addr()).count(); msgCount != 1 {
+		t.Errorf("test failed - want %d message for running server, got %d", 1, msgCount)
+	}
+}
+
+func TestQuorumClosedTimeout(t *testing.T) {
+	t.Parallel()
+
+	var (
+		up    = startAcceptingServer(t)
+		specs = []*TCPSpec{
+			newListenerSpec(up),
+			{Host: tcpServerHost, Port: getLocalTCPPort(), PollFreq: 100 * time.Millisecond},
+		}
+	)
+
+	mb := newMessageBox(QuorumClosed(specs, 2, 500*time.Millisecond))
+	last := mb.msgs[mb.count()-1]
+	if status := last.Status(); status != Failed {
+		t.Fatalf("test msgs[-1].Status() failed - want: %s, got: %s", Failed, status)
+	}
+
+	var (
+		quorumErr  *QuorumError
+		timeoutErr *TimeoutError
+	)
+	if err := last.Err(); !errors.As(err, &quorumErr) || !errors.As(err, &timeoutErr) {
+		t.Fatalf("test msgs[-1].Err() failed - want: *QuorumError with *TimeoutError, got: %v", err)
+	}
+	if quorumErr.Ready != 1 || quorumErr.Want != 2 {
+		t.Errorf("test failed - want 1 of 2 down, got %d of %d", quorumErr.Ready, quorumErr.Want)
+	}
+	wantPending := specs[0].Target()
+	if pending := last.PendingTargets(); len(pending) != 1 || pending[0] != wantPending {
+		t.Errorf("test msgs[-1].PendingTargets() failed - want: [%s], got: %v", wantPending, pending)
+	}
+}
@@ -0,0 +1,12 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !windows
+
+package wait
+
+import "syscall"
+
+// connRefusedErrs are the errors indicating that the server refused the connection, i.e. that it is
+// not ready yet.
+var connRefusedErrs = []error{syscall.ECONNREFUSED}
@@ -0,0 +1,16 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build windows
+
+package wait
+
+import "syscall"
+
+// wsaeconnrefused is the Winsock error code for refused connections, which is what dials on
+// Windows fail with instead of syscall.ECONNREFUSED.
+const wsaeconnrefused = syscall.Errno(10061)
+
+// connRefusedErrs are the errors indicating that the server refused the connection, i.e. that it is
+// not ready yet.
+var connRefusedErrs = []error{syscall.ECONNREFUSED, wsaeconnrefused}
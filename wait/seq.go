@@ -0,0 +1,38 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"context"
+	"time"
+)
+
+// AllTCPSeq is AllTCP as an iterator, for use with range-over-func in Go 1.23 or later:
+//
+//	for msg := range wait.AllTCPSeq(specs, waitTimeout) {
+//		...
+//	}
+//
+// It yields the same messages as AllTCP, in the same order. The wait operation only starts once
+// the iteration does, and ending the iteration early, e.g. with `break`, cancels it. In that case,
+// the iteration returns only after the cancelled wait operation has closed its channel, as in
+// AllTCPContext. The returned function has the same type as `iter.Seq[*TCPMessage]`, and may also
+// be called directly on older Go versions.
+func AllTCPSeq(specs []*TCPSpec, waitTimeout time.Duration) func(yield func(*TCPMessage) bool) {
+	return func(yield func(*TCPMessage) bool) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		msgs := AllTCPContext(ctx, specs, waitTimeout)
+		for msg := range msgs {
+			if yield(msg) {
+				continue
+			}
+			cancel()
+			for range msgs {
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestAllTCPSeq(t *testing.T) {
+	t.Parallel()
+
+	server := &tcpServer{tcpServerHost, getLocalTCPPort(), 100 * time.Millisecond, t}
+	_, cancel := server.start(context.Background())
+	defer cancel()
+
+	var (
+		spec     = &TCPSpec{Host: server.host, Port: server.port, PollFreq: 50 * time.Millisecond}
+		statuses []Status
+	)
+	AllTCPSeq([]*TCPSpec{spec}, 5*time.Second)(func(msg *TCPMessage) bool {
+		statuses = append(statuses, msg.Status())
+		return true
+	})
+
+	if len(statuses) != 2 || statuses[0] != Start || statuses[1] != Ready {
+		t.Errorf("test failed - want: %v, got: %v", []Status{Start, Ready}, statuses)
+	}
+}
+
+// This test is not parallel, so that the number of goroutines is not affected by other tests.
+func TestAllTCPSeqBreak(t *testing.T) {
+	var (
+		before   = runtime.NumGoroutine()
+		pollFreq = 50 * time.Millisecond
+		specs    = make([]*TCPSpec, 10)
+	)
+	for i := range specs {
+		specs[i] = &TCPSpec{Host: tcpServerHost, Port: getLocalTCPPort(), PollFreq: pollFreq}
+	}
+
+	// Without a timeout limit, the iteration only ends because it is stopped.
+	var (
+		yields = 0
+		done   = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		AllTCPSeq(specs, NoTimeout)(func(*TCPMessage) bool {
+			yields++
+			return false
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("test failed - iteration did not end after it was stopped")
+	}
+	if yields != 1 {
+		t.Errorf("test failed - want: %d yields, got: %d", 1, yields)
+	}
+	if after := waitGoroutines(before, 2*pollFreq+time.Second); after > before {
+		t.Errorf("test failed - want at most %d goroutines, got: %d", before, after)
+	}
+}
@@ -0,0 +1,11 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux && !amd64 && !386
+
+package wait
+
+import "syscall"
+
+// sysSetns is the number of the setns system call.
+const sysSetns = syscall.SYS_SETNS
@@ -0,0 +1,10 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux && amd64
+
+package wait
+
+// sysSetns is the number of the setns system call, which the syscall package does not define on
+// this architecture.
+const sysSetns = 308
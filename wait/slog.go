@@ -0,0 +1,56 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build go1.21
+
+package wait
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LogMessages logs every message from the given channel as a structured record with the given
+// logger, while forwarding the message through the returned channel. Failed messages are logged at
+// the error level and all other messages at the info level. Each record has the target, status,
+// and elapsed time of its message, and the error if there is any. The returned channel is closed
+// after the input channel is closed.
+func LogMessages(logger *slog.Logger, msgs <-chan *TCPMessage) <-chan *TCPMessage {
+	out := make(chan *TCPMessage)
+
+	go func() {
+		defer close(out)
+
+		for msg := range msgs {
+			logMessage(logger, msg)
+			out <- msg
+		}
+	}()
+
+	return out
+}
+
+// logMessage logs a single message with the given logger.
+func logMessage(logger *slog.Logger, msg Message) {
+	var (
+		level = slog.LevelInfo
+		attrs = []slog.Attr{
+			slog.String("target", msg.Target()),
+			slog.String("status", msg.Status().String()),
+			slog.Duration("elapsed", msg.ElapsedTime()),
+		}
+	)
+	if err := msg.Err(); err != nil {
+		level = slog.LevelError
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	if pending := msg.PendingTargets(); len(pending) > 0 {
+		attrs = append(attrs, slog.Any("pending", pending))
+	}
+
+	if tcpMsg, isTCP := msg.(*TCPMessage); isTCP && tcpMsg.spec != nil && tcpMsg.spec.Name != "" {
+		attrs = append(attrs, slog.String("addr", tcpMsg.Addr()))
+	}
+
+	logger.LogAttrs(context.Background(), level, "wait "+msg.Status().String(), attrs...)
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build go1.21
+
+package wait
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestLogMessages(t *testing.T) {
+	t.Parallel()
+
+	var (
+		buf       bytes.Buffer
+		logger    = slog.New(slog.NewJSONHandler(&buf, nil))
+		startTime = time.Now()
+		spec      = &TCPSpec{Host: "localhost", Port: "7000", PollFreq: 1 * time.Second}
+		named     = &TCPSpec{Name: "cache", Host: "localhost", Port: "7001", PollFreq: time.Second}
+		msgs      = []*TCPMessage{
+			newTCPMessageStart(spec, startTime),
+			newTCPMessageFailed(spec, startTime, fmt.Errorf("stub")),
+			newTCPMessageReady(named, startTime),
+		}
+		want = []map[string]string{
+			{"level": "INFO", "msg": "wait start", "target": "tcp://localhost:7000"},
+			{"level": "ERROR", "msg": "wait failed", "error": "stub", "status": "failed"},
+			{"level": "INFO", "target": "cache", "addr": "localhost:7001"},
+		}
+	)
+
+	in := make(chan *TCPMessage, len(msgs))
+	for _, msg := range msgs {
+		in <- msg
+	}
+	close(in)
+
+	var forwarded int
+	for range LogMessages(logger, in) {
+		forwarded++
+	}
+	if forwarded != len(msgs) {
+		t.Errorf("test failed - want %d forwarded messages, got %d", len(msgs), forwarded)
+	}
+
+	dec := json.NewDecoder(&buf)
+	for i, wantRecord := range want {
+		var gotRecord map[string]any
+		if err := dec.Decode(&gotRecord); err != nil {
+			t.Fatalf("test[%d] failed - can not decode record: %s", i, err)
+		}
+		for key, wantValue := range wantRecord {
+			if gotValue := gotRecord[key]; gotValue != wantValue {
+				t.Errorf("test[%d][%s] failed - want: %q, got: %v", i, key, wantValue, gotValue)
+			}
+		}
+	}
+}
@@ -5,42 +5,244 @@ package wait
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"math/rand"
 	"net"
+	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+	"unicode"
 )
 
 var (
 	// addrPattern is used for parsing input TCP addresses and extracting the relevant parts.
 	addrPattern = regexp.MustCompile(
-		"^(?P<schema>(?P<proto>[A-Za-z]+)://)?(?P<host>[^#]+)(#(?P<freq>.+))?",
+		"^((?P<name>[A-Za-z0-9_.-]+)=)?(?P<schema>(?P<proto>[A-Za-z][A-Za-z0-9]*)://)?" +
+			"(?P<host>[^#]+)(#(?P<freq>.+))?",
 	)
 	// protoPort is a mapping between popular TCP-backed protocol names to their default port
 	// numbers.
 	protoPort = map[string]string{
-		"amqp":       "5672",
-		"amqps":      "5671",
-		"http":       "80",
-		"https":      "443",
-		"imap":       "143",
-		"mysql":      "3306",
-		"ldap":       "389",
-		"ldaps":      "636",
-		"postgresql": "5432",
-		"smtp":       "25",
+		"amqp":          "5672",
+		"amqps":         "5671",
+		"elasticsearch": "9200",
+		"grpc":          "50051",
+		"http":          "80",
+		"https":         "443",
+		"imap":          "143",
+		"kafka":         "9092",
+		"memcached":     "11211",
+		"mongodb":       "27017",
+		"mysql":         "3306",
+		"ldap":          "389",
+		"ldaps":         "636",
+		"postgres":      "5432",
+		"postgresql":    "5432",
+		"rabbitmq":      "15672",
+		"redis":         "6379",
+		"smtp":          "25",
 	}
+	// customProtoPort is a mapping between protocol names and their default port numbers, as
+	// registered by users. Its entries take precedence over those in protoPort.
+	customProtoPort = map[string]string{}
+	// customProtoPortMu guards access to customProtoPort.
+	customProtoPortMu sync.RWMutex
+	// customProtoPollFreq is a mapping between protocol names and their default poll frequencies,
+	// as registered by users.
+	customProtoPollFreq = map[string]time.Duration{}
+	// customProtoPollFreqMu guards access to customProtoPollFreq.
+	customProtoPollFreqMu sync.RWMutex
+	// protoNetwork is a mapping between protocol names and the networks on which connections to
+	// their servers are made. Protocols not listed here use the default network of TCPSpec.
+	protoNetwork = map[string]string{
+		"tcp":  "tcp",
+		"tcp4": "tcp4",
+		"tcp6": "tcp6",
+	}
+	// protoNamePattern is the pattern that protocol names must match so that they can be parsed
+	// from addresses.
+	protoNamePattern = regexp.MustCompile("^[A-Za-z]+$")
 )
 
+// RegisterProtoPort sets the default port number of the given protocol, overriding the builtin
+// default if there is any. The protocol name is case-insensitive and may only contain letters.
+// The port number must be between 1 and 65535.
+func RegisterProtoPort(proto, port string) error {
+	if !protoNamePattern.MatchString(proto) {
+		return fmt.Errorf("invalid protocol name: %q", proto)
+	}
+	if num, err := strconv.Atoi(port); err != nil || num < 1 || num > 65535 {
+		return fmt.Errorf("invalid port for protocol %q: %q", proto, port)
+	}
+
+	customProtoPortMu.Lock()
+	defer customProtoPortMu.Unlock()
+	customProtoPort[strings.ToLower(proto)] = port
+
+	return nil
+}
+
+// lookupProtoPort returns the default port number of the given protocol, preferring ports
+// registered via RegisterProtoPort over the builtin ones.
+func lookupProtoPort(proto string) (string, bool) {
+	proto = strings.ToLower(proto)
+
+	customProtoPortMu.RLock()
+	defer customProtoPortMu.RUnlock()
+	if port, isCustom := customProtoPort[proto]; isCustom {
+		return port, true
+	}
+	port, isBuiltin := protoPort[proto]
+
+	return port, isBuiltin
+}
+
+// RegisterProtoPollFreq sets the default poll frequency of the given protocol, which is used for
+// addresses with the protocol that do not specify their own poll frequency. The protocol name is
+// case-insensitive and may only contain letters. The poll frequency must be positive.
+func RegisterProtoPollFreq(proto string, freq time.Duration) error {
+	if !protoNamePattern.MatchString(proto) {
+		return fmt.Errorf("invalid protocol name: %q", proto)
+	}
+	if err := checkPollFreq(freq); err != nil {
+		return fmt.Errorf("invalid poll frequency for protocol %q: %s", proto, err)
+	}
+
+	customProtoPollFreqMu.Lock()
+	defer customProtoPollFreqMu.Unlock()
+	customProtoPollFreq[strings.ToLower(proto)] = freq
+
+	return nil
+}
+
+// lookupProtoPollFreq returns the default poll frequency of the given protocol, as registered via
+// RegisterProtoPollFreq.
+func lookupProtoPollFreq(proto string) (time.Duration, bool) {
+	customProtoPollFreqMu.RLock()
+	defer customProtoPollFreqMu.RUnlock()
+	freq, isCustom := customProtoPollFreq[strings.ToLower(proto)]
+
+	return freq, isCustom
+}
+
+// lookupProtoNetwork returns the network selected by the given protocol, or an empty string if the
+// protocol does not select any.
+func lookupProtoNetwork(proto string) string {
+	return protoNetwork[strings.ToLower(proto)]
+}
+
 // TCPSpec represents the input specification of a single TCP wait operation.
 type TCPSpec struct {
+	// Name is the human-readable label of the target. If empty, the target is identified by its
+	// address.
+	Name string
 	// Host is the hostname or IP address being waited.
 	Host string
 	// Port is the port number for the connection.
 	Port string
 	// PollFreq is how often a connection is attempted.
 	PollFreq time.Duration
+	// Scheme is the protocol given in the address, in lower case, e.g. `https` for
+	// `https://example.com`. It is empty if the address has no protocol. It does not change how
+	// connections are made; only Port and Network, which may be derived from it, do.
+	Scheme string
+	// Path is the path given in the address after the host, e.g. `/healthz` for
+	// `http://example.com/healthz`. It is empty if the address has no path. Like Scheme, it does
+	// not change how connections are made, but is kept for protocol-specific checks.
+	Path string
+	// RawQuery is the encoded query given in the address after the path, without the leading `?`.
+	// It is empty if the address has no query.
+	RawQuery string
+	// Network is the network on which connections are made: `tcp4` for IPv4 only, `tcp6` for IPv6
+	// only, or `tcp` for either. If empty, `tcp` is used.
+	Network string
+	// Proxy is the URL of the proxy server through which connections are made. If nil, connections
+	// are made directly.
+	Proxy *url.URL
+	// LocalAddr is the local address from which connections originate. If nil, the local address
+	// is chosen by the operating system.
+	LocalAddr *net.TCPAddr
+	// NetNS is the path of the network namespace from which connections are made, e.g.
+	// `/var/run/netns/foo`, for servers that are only reachable from within that namespace.
+	// Entering a namespace requires Linux and the CAP_SYS_ADMIN capability. Host names are still
+	// resolved from the network namespace of the process. If empty, connections are made from the
+	// network namespace of the process.
+	NetNS string
+	// Resolver resolves the host name before connecting. If nil, the default resolver is used.
+	// When connecting through Proxy, it only resolves the host name of the proxy server, and it is
+	// ignored entirely if Dialer is set.
+	Resolver *net.Resolver
+	// SkipImmediateCheck is whether the first connection attempt is made only after the first poll
+	// interval has passed, instead of right at the start of the wait operation. This avoids false
+	// readiness of servers that briefly open their port early in their startup.
+	SkipImmediateCheck bool
+	// Jitter is the maximum fraction by which each poll interval randomly deviates from PollFreq,
+	// in either direction. It must be in [0, 1). If 0, polling happens exactly every PollFreq.
+	Jitter float64
+	// JitterRand is the random number generator for Jitter, which makes jittered poll intervals
+	// reproducible when seeded with a fixed value. It is only used under a package-wide lock, so it
+	// may be shared by multiple specifications. If nil, a shared time-seeded generator is used.
+	JitterRand *rand.Rand
+	// RetryOnError is whether all connection errors are retried until the timeout limit is
+	// exceeded. If false, only errors indicating that the server is not ready yet are retried and
+	// other errors end the wait operation immediately.
+	RetryOnError bool
+	// Once is whether only a single connection attempt is made. If true, the wait operation fails
+	// as soon as that attempt does not succeed, regardless of RetryOnError.
+	Once bool
+	// MaxAttempts is the maximum number of connection attempts, after which the wait operation
+	// fails even if it would otherwise retry. Values below 1 mean no limit.
+	MaxAttempts int
+	// FailOnNXDomain is whether the wait operation fails as soon as DNS answers that the host name
+	// does not exist, regardless of RetryOnError. Temporary lookup failures are still retried
+	// according to RetryOnError.
+	FailOnNXDomain bool
+	// Strict is whether the wait operation fails as soon as the server refuses a connection,
+	// regardless of RetryOnError, for servers that must already be up. If false, refused
+	// connections mean that the server is not ready yet and are retried. It is ignored by
+	// QuorumClosed, for which refused connections are the goal.
+	Strict bool
+	// TCPKeepAlive is the interval between TCP keep-alive probes on connections, so that
+	// connections that are dropped silently while open, such as during Hold, are detected. As in
+	// net.Dialer, zero uses the default interval and negative values disable keep-alive probes. It
+	// is ignored if Dialer is set.
+	TCPKeepAlive time.Duration
+	// ProxyProtocol is the version of the PROXY protocol header sent to the server upon connection,
+	// before anything else: 1 for the text header or 2 for the binary one. This is for servers
+	// behind load balancers that reset connections without the header. Resets only happen after
+	// the header is sent, so they are detected through Expect or Hold. If 0, no header is sent.
+	ProxyProtocol int
+	// Payload is sent to the server upon connection. If empty, nothing is sent.
+	Payload string
+	// Expect is the pattern that the data sent by the server must match for the server to be
+	// considered ready. This is the response to Payload if it is set, or the banner sent by the
+	// server upon connection otherwise. If nil, servers are ready as soon as a connection is made
+	// and Payload is sent.
+	Expect *regexp.Regexp
+	// ReadBytes is the maximum number of bytes read from the server when matching Expect, so that
+	// misbehaving servers can not make reads unbounded. If 0, 512 bytes are read at most.
+	ReadBytes int
+	// ReadTimeout is how long to wait for the server to send data matching Expect. If 0, the poll
+	// frequency is used.
+	ReadTimeout time.Duration
+	// Hold is how long connections are kept open after the server is found ready otherwise. If the
+	// server closes or resets the connection within this duration, the server is not ready yet. If
+	// zero, connections are closed right away.
+	Hold time.Duration
+	// Dialer is used for making connections. If nil, a *net.Dialer configured with LocalAddr and
+	// Proxy is used.
+	Dialer Dialer
+	// Observer receives the result of every connection attempt. If nil, attempts are not reported.
+	Observer AttemptObserver
+	// Priority is how prominently the target is presented, with higher values first. It does not
+	// change the wait operation, which runs in parallel for all targets regardless.
+	Priority int
 }
 
 // Addr returns the host and port of the TCP specifications, joined by ':'.
@@ -48,6 +250,80 @@ func (spec *TCPSpec) Addr() string {
 	return net.JoinHostPort(spec.Host, spec.Port)
 }
 
+// Target returns the name of the specifications if it is set, or its address with `tcp://`
+// prepended otherwise.
+func (spec *TCPSpec) Target() string {
+	if spec.Name != "" {
+		return spec.Name
+	}
+	return "tcp://" + spec.Addr()
+}
+
+// String returns the specifications in the address form accepted by ParseTCPSpec, with the port
+// and poll frequency always given, e.g. `db=postgres://10.0.0.3:5432#1s`. Parsing it back gives
+// specifications with the same name, address, scheme, path, query, and poll frequency. All other
+// options, such as the payload, are not part of the address and are left out.
+func (spec *TCPSpec) String() string {
+	var b strings.Builder
+	if spec.Name != "" {
+		b.WriteString(spec.Name + "=")
+	}
+	if spec.Scheme != "" {
+		b.WriteString(spec.Scheme + "://")
+	}
+	b.WriteString(spec.Addr())
+	if spec.Path != "" {
+		b.WriteString((&url.URL{Path: spec.Path}).EscapedPath())
+	}
+	if spec.RawQuery != "" {
+		b.WriteString("?" + spec.RawQuery)
+	}
+	b.WriteString("#" + spec.PollFreq.String())
+	return b.String()
+}
+
+// pollTiming returns when the connection attempts of the specifications are made.
+func (spec *TCPSpec) pollTiming() pollTiming {
+	return pollTiming{
+		freq:               spec.PollFreq,
+		jitter:             spec.Jitter,
+		skipImmediateCheck: spec.SkipImmediateCheck,
+		jitterRand:         spec.JitterRand,
+	}
+}
+
+// TimeoutError is the error for wait operations that did not finish within their timeout limit.
+type TimeoutError struct {
+	// Limit is the timeout limit that was exceeded.
+	Limit time.Duration
+	// Pending is the number of targets that were still being waited when the limit was exceeded.
+	// If zero, the number is unknown.
+	Pending int
+	// LastErr is the most recent error of the unfinished wait operations that was retried. It may
+	// be nil, for example when the servers accept connections but are not ready otherwise.
+	LastErr error
+}
+
+// Error returns the error message.
+func (e *TimeoutError) Error() string {
+	msg := fmt.Sprintf("exceeded timeout limit of %s", e.Limit)
+	switch {
+	case e.Pending == 1:
+		msg += " with 1 target pending"
+	case e.Pending > 1:
+		msg += fmt.Sprintf(" with %d targets pending", e.Pending)
+	}
+	if e.LastErr != nil {
+		msg += fmt.Sprintf(", last error: %s", e.LastErr)
+	}
+	return msg
+}
+
+// Unwrap returns the last retried error.
+func (e *TimeoutError) Unwrap() error {
+	return e.LastErr
+}
+
 // Message is the interface for messages sent by the wait operations.
 type Message interface {
 	// Status returns the status of the message.
@@ -56,8 +332,20 @@ type Message interface {
 	Target() string
 	// Err returns an error, if the message contains any.
 	Err() error
-	// ElapsedTime returns the duration of the wait operation at the time of message creation.
+	// ElapsedTime returns the duration of the wait operation at the time of message creation. For
+	// messages of a single target, this is measured from the start of the wait operation on that
+	// target, which is the start of the whole wait operation unless set with
+	// WithTargetStartTime. For messages of groups or of the whole wait operation, it is always
+	// measured from the start of the whole wait operation.
 	ElapsedTime() time.Duration
+	// PendingTargets returns the entities that were still being waited at the time of message
+	// creation. This is only set for messages that end the whole wait operation prematurely.
+	PendingTargets() []string
+	// Attempts returns the number of connection attempts made at the time of message creation.
+	Attempts() int
+	// Details returns metadata negotiated with the server, keyed by name, such as the protocol
+	// version. It is never nil, but may be empty when there is nothing to report.
+	Details() map[string]string
 }
 
 // TCPMessage is a container for wait operations on TCP servers.
@@ -66,13 +354,26 @@ type TCPMessage struct {
 	spec *TCPSpec
 	// status is the wait operation status.
 	status Status
-	// startTime is when the wait operation starts.
+	// startTime is when the wait operation starts, from which the elapsed time is measured.
 	startTime time.Time
 	// emitTime is when the message is created and emitted. The current implementation creates and
 	// emits at the same time.
 	emitTime time.Time
 	// err is any operation that may have occurred.
 	err error
+	// label is the target of messages that do not belong to a single specifications, such as
+	// those of groups, or of messages of group members that would otherwise have the same target as
+	// their group. If empty, the target of spec is used.
+	label string
+	// pending is the targets that have not finished waiting when the message is emitted.
+	pending []string
+	// attempts is the number of connection attempts made when the message is emitted.
+	attempts int
+	// immediate is whether the message is the result of the first attempt, which is made right at
+	// the start instead of after polling.
+	immediate bool
+	// connectLatency is how long making the connection to the server took, for Ready messages.
+	connectLatency time.Duration
 }
 
 // newTCPMessageStart creates a new TCPMessage with status Start and no errors.
@@ -108,18 +409,36 @@ func newTCPMessageFailed(spec *TCPSpec, startTime time.Time, err error) *TCPMess
 	}
 }
 
+// newAggregateMessage creates a new TCPMessage with the given status and error that does not
+// belong to any single specifications, but to a group of them or to the whole wait operation, as
+// denoted by the label.
+func newAggregateMessage(ctx context.Context, label string, status Status, err error) *TCPMessage {
+	return &TCPMessage{
+		status:    status,
+		startTime: startTimeFromContext(ctx),
+		emitTime:  time.Now(),
+		err:       err,
+		label:     label,
+	}
+}
+
 // Status returns the status of the message.
 func (msg *TCPMessage) Status() Status {
 	return msg.status
 }
 
-// Target returns the target of the wait operation, which is `tcp://` prepended to Addr. If the
-// specifications is nil, this returns `<none>`.
+// Target returns the target of the wait operation, which is the name of the specifications or
+// `tcp://` prepended to Addr if it has no name. Messages of groups and of their members return
+// their label instead, as described in GroupTCP. If the specifications is nil and there is no
+// label either, this returns `<none>`.
 func (msg *TCPMessage) Target() string {
+	if msg.label != "" {
+		return msg.label
+	}
 	if msg.spec == nil {
 		return "<none>"
 	}
-	return "tcp://" + msg.Addr()
+	return msg.spec.Target()
 }
 
 // Addr returns the address being waited. If the specifications is nil, this returns `<none>`.
@@ -140,19 +459,115 @@ func (msg *TCPMessage) Err() error {
 	return msg.err
 }
 
+// PendingTargets returns the targets whose wait operations had not finished when the message was
+// emitted. It is only non-empty for the timeout message of AllTCP.
+func (msg *TCPMessage) PendingTargets() []string {
+	return msg.pending
+}
+
+// Attempts returns the number of connection attempts made before the message was emitted. It is
+// zero for Start messages and for messages not belonging to a single target.
+func (msg *TCPMessage) Attempts() int {
+	return msg.attempts
+}
+
+// Immediate returns whether the message results from the first connection attempt, made right at
+// the start of the wait operation. For Ready messages, this means that the server was already
+// ready before the wait began, instead of becoming ready while it was polled.
+func (msg *TCPMessage) Immediate() bool {
+	return msg.immediate
+}
+
+// ConnectLatency returns how long making the connection took in the attempt that found the server
+// ready, from dialing until the connection was established. Unlike ElapsedTime, it does not include
+// earlier attempts nor the time spent probing the server afterwards. It is zero for messages other
+// than the Ready messages of single targets.
+func (msg *TCPMessage) ConnectLatency() time.Duration {
+	return msg.connectLatency
+}
+
+// Details returns metadata negotiated with the server. Plain TCP connections negotiate nothing, so
+// this is always empty.
+func (msg *TCPMessage) Details() map[string]string {
+	return map[string]string{}
+}
+
+// allTargetsLabel is the target of messages about the whole wait operation.
+const allTargetsLabel = "<all>"
+
 // ctxKey is the key type for wait contexts.
 type ctxKey int
 
-// startTimeCtxKey is the key for retrieving wait operation start time from contexts.
-const startTimeCtxKey ctxKey = 0
+const (
+	// startTimeCtxKey is the key for retrieving wait operation start time from contexts.
+	startTimeCtxKey ctxKey = iota
+	// targetStartTimeCtxKey is the key for retrieving the start time of the wait operations on
+	// single targets from contexts.
+	targetStartTimeCtxKey
+	// retriedErrsCtxKey is the key for retrieving the retriedErrs of wait operations from
+	// contexts.
+	retriedErrsCtxKey
+)
+
+// retriedErr is an error that was retried, along with when it occurred.
+type retriedErr struct {
+	err  error
+	time time.Time
+}
+
+// retriedErrs records the last retried error of each wait operation.
+type retriedErrs struct {
+	mu   sync.Mutex
+	errs map[*TCPSpec]retriedErr
+}
+
+// record records the given error as the last retried error of the given specifications.
+func (re *retriedErrs) record(spec *TCPSpec, err error) {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+	re.errs[spec] = retriedErr{err: err, time: time.Now()}
+}
 
-// newContext creates a new context containing current time along with a cancellation function,
-// based on the background context.
-func newContext() (context.Context, context.CancelFunc) {
-	ctx, cancel := context.WithCancel(context.Background())
+// latest returns the most recent of the last retried errors of the given specifications, or nil if
+// there is none.
+func (re *retriedErrs) latest(specs []*TCPSpec) error {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+
+	var last retriedErr
+	for _, spec := range specs {
+		if rerr, exists := re.errs[spec]; exists && rerr.time.After(last.time) {
+			last = rerr
+		}
+	}
+	return last.err
+}
+
+// newContext creates a new context containing current time and an empty retriedErrs along with a
+// cancellation function, based on the given parent context.
+func newContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	ctx = context.WithValue(ctx, retriedErrsCtxKey, &retriedErrs{errs: map[*TCPSpec]retriedErr{}})
 	return context.WithValue(ctx, startTimeCtxKey, time.Now()), cancel
 }
 
+// recordRetriedErr records the given error as the last retried error of the given specifications,
+// if the context contains a retriedErrs.
+func recordRetriedErr(ctx context.Context, spec *TCPSpec, err error) {
+	if re, ok := ctx.Value(retriedErrsCtxKey).(*retriedErrs); ok {
+		re.record(spec, err)
+	}
+}
+
+// latestRetriedErr returns the most recent of the last retried errors of the given specifications
+// recorded in the context, or nil if there is none.
+func latestRetriedErr(ctx context.Context, specs []*TCPSpec) error {
+	if re, ok := ctx.Value(retriedErrsCtxKey).(*retriedErrs); ok {
+		return re.latest(specs)
+	}
+	return nil
+}
+
 // startTimeFromContext extracts the wait operation start time from the given context. If the
 // expected value does not exist or it does not typecheck, the current time is returned.
 func startTimeFromContext(ctx context.Context) time.Time {
@@ -163,14 +578,38 @@ func startTimeFromContext(ctx context.Context) time.Time {
 	return startTime
 }
 
+// WithTargetStartTime returns a copy of the parent context in which the wait operations on single
+// targets measure their elapsed time from the given start time, instead of from the start of the
+// whole wait operation. This keeps the elapsed time of targets that are waited later than others
+// from including the time before their own wait operation started.
+func WithTargetStartTime(parent context.Context, startTime time.Time) context.Context {
+	return context.WithValue(parent, targetStartTimeCtxKey, startTime)
+}
+
+// targetStartTimeFromContext extracts the start time of the wait operations on single targets from
+// the given context. If none is set, the start time of the whole wait operation is returned, as by
+// startTimeFromContext.
+func targetStartTimeFromContext(ctx context.Context) time.Time {
+	if startTime, ok := ctx.Value(targetStartTimeCtxKey).(time.Time); ok {
+		return startTime
+	}
+	return startTimeFromContext(ctx)
+}
+
 // ParseTCPSpec parses the given address into a TCPSpec and then returns a pointer to it. The
 // address can be given in several forms: `<host>:<port>`, `<protocol>://<host>`, or
-// `<protocol>://<host>:<port>`. For the second form, if the protocol is known, the port will be
-// inferred from it (e.g. port 80 for HTTP and 443 for HTTPS). For the last form, the `<protocol>`
-// is ignored.  This function also takes a `defaultPollFreq` argument, which it will use as the poll
-// frequency of the TCPSpec if the raw address does not specify a poll frequency value.  The poll
-// frequency value in the raw address is the string value of time.Duration, appended to the address
-// after a `#` sign.
+// `<protocol>://<host>:<port>`, each of which may be prefixed with `<name>=` to label the target.
+// For the second form, if the protocol is known, the port will be inferred from it (e.g. port 80
+// for HTTP and 443 for HTTPS). Protocols not known by default can be added with
+// RegisterProtoPort. For the last form, the `<protocol>` is only used for selecting the network of
+// the TCPSpec: `tcp4://` and `tcp6://` restrict connections to IPv4 and IPv6, respectively, and
+// other protocols leave the network unset. IPv6 hosts are enclosed in brackets and may have a zone,
+// e.g. `[fe80::1%eth0]:8080`, which may also be given as `%25eth0` in the URL forms.  This function
+// also takes a `defaultPollFreq` argument, which it will use as the poll frequency of the TCPSpec
+// if the raw address does not specify a poll frequency value and no default poll frequency is
+// registered for its protocol with RegisterProtoPollFreq.  The poll frequency value in the raw
+// address is the string value of time.Duration, or a unit-less number of seconds, appended to the
+// address after a `#` sign.
 func ParseTCPSpec(rawAddr string, defaultPollFreq time.Duration) (*TCPSpec, error) {
 	var (
 		proto             string
@@ -181,114 +620,369 @@ func ParseTCPSpec(rawAddr string, defaultPollFreq time.Duration) (*TCPSpec, erro
 		groups            = make(map[string]string)
 	)
 
+	if matches == nil {
+		return nil, fmt.Errorf("host not given: %q", rawAddr)
+	}
 	for i, value := range matches {
 		groups[subexpNames[i]] = value
 	}
 
 	rawHost = groups["host"]
-	hasPort = strings.ContainsRune(rawHost, ':')
+	// Protocols are only parsed if followed by a host, so they are left in the host otherwise.
+	if strings.Contains(rawHost, "://") {
+		return nil, fmt.Errorf("host not given: %q", rawAddr)
+	}
+	proto, hasProto = groups["proto"]
+	// Addresses with a protocol are URLs, whose path and query are kept apart from the host. Only
+	// these are parsed as URL parts, so that hosts and ports are validated as in other addresses.
+	if i := strings.IndexAny(rawHost, "/?"); hasProto && proto != "" && i >= 0 {
+		u, err := url.Parse(rawHost[i:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL path or query: %q", rawHost[i:])
+		}
+		rawHost = rawHost[:i]
+		groups["path"] = u.Path
+		groups["query"] = u.RawQuery
+	}
+	// IPv6 addresses contain colons themselves, so only a colon after their closing bracket comes
+	// before a port.
+	hasPort = strings.ContainsRune(rawHost[strings.LastIndex(rawHost, "]")+1:], ':')
 
 	if hasPort {
 		host, port, err := net.SplitHostPort(rawHost)
 		if err != nil {
 			return nil, err
 		}
+		if hasProto && proto != "" {
+			host = unescapeZone(host)
+		}
+		if err := validateHost(host, rawAddr); err != nil {
+			return nil, err
+		}
+		if err := validatePort(port); err != nil {
+			return nil, err
+		}
 		groups["host"] = host
 		groups["port"] = port
-	} else if proto, hasProto = groups["proto"]; hasProto {
-		port, knownProto := protoPort[strings.ToLower(proto)]
+	} else if hasProto {
+		port, knownProto := lookupProtoPort(proto)
 		if !knownProto {
 			if proto == "" {
 				return nil, fmt.Errorf("neither port nor protocol is given")
 			}
 			return nil, fmt.Errorf("port not given and protocol is unknown: %q", proto)
 		}
-		groups["host"] = rawHost
+		host := rawHost
+		if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") && strings.Contains(host, ":") {
+			host = unescapeZone(host[1 : len(host)-1])
+		}
+		if err := validateHost(host, rawAddr); err != nil {
+			return nil, err
+		}
+		groups["host"] = host
 		groups["port"] = port
 	}
 
 	if rawFreq, hasFreq := groups["freq"]; hasFreq && rawFreq != "" {
-		freq, err := time.ParseDuration(rawFreq)
+		freq, err := parsePollFreq(rawFreq)
 		if err != nil {
 			return nil, err
 		}
 		defaultPollFreq = freq
+	} else if freq, hasProtoFreq := lookupProtoPollFreq(proto); hasProtoFreq {
+		defaultPollFreq = freq
+	}
+	if err := checkPollFreq(defaultPollFreq); err != nil {
+		return nil, err
 	}
 
 	return &TCPSpec{
+		Name:     groups["name"],
 		Host:     groups["host"],
 		Port:     groups["port"],
 		PollFreq: defaultPollFreq,
+		Scheme:   strings.ToLower(proto),
+		Path:     groups["path"],
+		RawQuery: groups["query"],
+		Network:  lookupProtoNetwork(proto),
 	}, nil
 }
 
+// unescapeZone replaces the `%25` that separates the zone of the given IPv6 address from the
+// address, as URLs require, with a plain `%`, e.g. `fe80::1%25eth0` becomes `fe80::1%eth0`. Other
+// hosts are returned as is.
+func unescapeZone(host string) string {
+	if i := strings.Index(host, "%25"); i >= 0 && strings.ContainsRune(host[:i], ':') {
+		return host[:i] + "%" + host[i+len("%25"):]
+	}
+	return host
+}
+
+// validateHost checks that the given host, parsed from the given raw address, is not empty and
+// does not contain characters that can not be part of host names or IP addresses, such as those
+// left over from malformed protocols (`/`) or names (`=`). Only IPv6 addresses may have a zone,
+// e.g. `fe80::1%eth0`.
+func validateHost(host, rawAddr string) error {
+	if host == "" {
+		return fmt.Errorf("host not given: %q", rawAddr)
+	}
+	if i := strings.IndexByte(host, '%'); i >= 0 {
+		if ip := net.ParseIP(host[:i]); ip == nil || ip.To4() != nil || i == len(host)-1 {
+			return fmt.Errorf("invalid host %q", host)
+		}
+	}
+	for _, r := range host {
+		if r == '/' || r == '=' || r == '#' || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return fmt.Errorf("invalid host %q", host)
+		}
+	}
+	return nil
+}
+
+// validatePort checks that the given port is either a number between 1 and 65535 or the name of a
+// TCP service known to the system, e.g. `http`.
+func validatePort(port string) error {
+	if num, err := strconv.ParseUint(port, 10, 64); err == nil {
+		if num < 1 || num > 65535 {
+			return fmt.Errorf("invalid port %q", port)
+		}
+		return nil
+	}
+	if num, err := net.LookupPort("tcp", port); err != nil || num == 0 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+// parsePollFreq parses the given poll frequency, which is either the string value of
+// time.Duration or a unit-less number of seconds.
+func parsePollFreq(rawFreq string) (time.Duration, error) {
+	if freq, err := time.ParseDuration(rawFreq); err == nil {
+		return freq, nil
+	}
+	secs, err := strconv.ParseFloat(rawFreq, 64)
+	if err != nil || math.IsNaN(secs) || math.IsInf(secs, 0) {
+		return 0, fmt.Errorf("invalid poll frequency: %q", rawFreq)
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// checkPollFreq checks that the given poll frequency is positive, as polling can not happen any
+// more often than continuously.
+func checkPollFreq(freq time.Duration) error {
+	if freq <= 0 {
+		return fmt.Errorf("poll frequency must be positive, got: %s", freq)
+	}
+	return nil
+}
+
 // ParseTCPSpecs parses multiple addresses into separate TCPSpecs, returned as a slice of pointers.
 // It has the same semantics as `ParseTCPSpec`, only it works with multiple addresses instead of
-// one.
+// one. Addresses prefixed with `cidr:` are expanded into one TCPSpec per host, as in
+// ParseCIDRSpecs.
 func ParseTCPSpecs(rawAddrs []string, defaultPollFreq time.Duration) ([]*TCPSpec, error) {
-	specs := make([]*TCPSpec, len(rawAddrs))
+	specs := make([]*TCPSpec, 0, len(rawAddrs))
 
 	for i, rawAddr := range rawAddrs {
+		if isCIDRAddr(rawAddr) {
+			cidrSpecs, err := ParseCIDRSpecs(rawAddr, defaultPollFreq)
+			if err != nil {
+				return []*TCPSpec{}, fmt.Errorf("address %d: %w", i, err)
+			}
+			specs = append(specs, cidrSpecs...)
+			continue
+		}
 		spec, err := ParseTCPSpec(rawAddr, defaultPollFreq)
 		if err != nil {
-			return []*TCPSpec{}, fmt.Errorf("address %d: %s", i, err)
+			return []*TCPSpec{}, fmt.Errorf("address %d: %w", i, err)
 		}
-		specs[i] = spec
+		specs = append(specs, spec)
 	}
 
 	return specs, nil
 }
 
+// DedupTCPSpecs collapses the given specifications with identical addresses into one, preserving
+// the order of first appearance. The collapsed specifications take all their values from the
+// first one with that address, except for the poll frequency: the smallest one wins. The given
+// specifications are not modified.
+func DedupTCPSpecs(specs []*TCPSpec) []*TCPSpec {
+	var (
+		deduped = make([]*TCPSpec, 0, len(specs))
+		seen    = make(map[string]*TCPSpec, len(specs))
+	)
+	for _, spec := range specs {
+		first, isDup := seen[spec.Addr()]
+		if !isDup {
+			cp := *spec
+			seen[spec.Addr()] = &cp
+			deduped = append(deduped, &cp)
+			continue
+		}
+		if spec.PollFreq < first.PollFreq {
+			first.PollFreq = spec.PollFreq
+		}
+	}
+	return deduped
+}
+
 // singleTCP is a helper function for checking TCP server status that accepts a cancellable parent
 // context, along with specifications of which server to poll.
 func singleTCP(ctx context.Context, spec *TCPSpec) <-chan *TCPMessage {
-	startTime := startTimeFromContext(ctx)
-	out := make(chan *TCPMessage, 2)
+	startTime := targetStartTimeFromContext(ctx)
+	attempts := 0
+
+	cancelled := func() *TCPMessage {
+		msg := newTCPMessageFailed(spec, startTime, ctx.Err())
+		msg.attempts = attempts
+		return msg
+	}
 
 	checkConn := func() *TCPMessage {
-		_, err := net.DialTimeout("tcp", spec.Addr(), spec.PollFreq)
+		attempts++
+		dialStart := time.Now()
+		conn, err := spec.dial(ctx)
+		latency := time.Since(dialStart)
 
 		if err == nil {
-			return newTCPMessageReady(spec, startTime)
+			defer conn.Close()
+			if err := spec.verify(ctx, conn); err != nil {
+				if ctx.Err() != nil {
+					return cancelled()
+				}
+				spec.observeAttempt(attempts, err)
+				if spec.Once {
+					msg := newTCPMessageFailed(spec, startTime, err)
+					msg.attempts = attempts
+					return msg
+				}
+				if attemptsExhausted(spec.MaxAttempts, attempts) {
+					msg := newTCPMessageFailed(spec, startTime, errAttemptsExhausted(attempts, err))
+					msg.attempts = attempts
+					return msg
+				}
+				return nil
+			}
+			spec.observeAttempt(attempts, nil)
+			msg := newTCPMessageReady(spec, startTime)
+			msg.attempts = attempts
+			msg.connectLatency = latency
+			return msg
 		}
-		if shouldWait(err) {
-			return nil
+		// Dials aborted by cancellation are reported as such, not as connection errors.
+		if ctx.Err() != nil {
+			return cancelled()
+		}
+		spec.observeAttempt(attempts, err)
+		if nfErr := hostNotFoundErr(err); spec.FailOnNXDomain && nfErr != nil {
+			msg := newTCPMessageFailed(spec, startTime, nfErr)
+			msg.attempts = attempts
+			return msg
+		}
+		if !spec.Once && !(spec.Strict && isConnRefused(err)) &&
+			(spec.RetryOnError || shouldWait(err)) {
+			if attemptsExhausted(spec.MaxAttempts, attempts) {
+				err = errAttemptsExhausted(attempts, err)
+			} else {
+				recordRetriedErr(ctx, spec, err)
+				return nil
+			}
 		}
-		return newTCPMessageFailed(spec, startTime, err)
+		msg := newTCPMessageFailed(spec, startTime, annotateErr(err))
+		msg.attempts = attempts
+		return msg
 	}
 
-	go func() {
-		pollTicker := time.NewTicker(spec.PollFreq)
-		defer pollTicker.Stop()
+	return pollTCP(ctx, spec, startTime, checkConn, cancelled)
+}
 
-		defer close(out)
+// errStillAccepting is the error of attempts against servers that are expected to be down, but
+// still accept connections.
+var errStillAccepting = errors.New("server still accepts connections")
 
-		out <- newTCPMessageStart(spec, startTime)
+// singleTCPClosed is the inverse of singleTCP: it polls the server of the given specifications
+// until its connections are refused, in which case the server is down and a Ready message is sent.
+// Accepted connections are closed right away and count as failed attempts.
+func singleTCPClosed(ctx context.Context, spec *TCPSpec) <-chan *TCPMessage {
+	startTime := targetStartTimeFromContext(ctx)
 
-		// So that we start polling immediately, without waiting for the first tick.
-		// There is no way to do this via the current ticker API.
-		// See: https://github.com/golang/go/issues/17601
-		if msg := checkConn(); msg != nil {
-			out <- msg
-			return
-		}
+	attempts := 0
 
-		for {
-			select {
-			case <-ctx.Done():
-				out <- newTCPMessageFailed(spec, startTime, ctx.Err())
-				return
+	cancelled := func() *TCPMessage {
+		msg := newTCPMessageFailed(spec, startTime, ctx.Err())
+		msg.attempts = attempts
+		return msg
+	}
 
-			case <-pollTicker.C:
-				if msg := checkConn(); msg != nil {
-					out <- msg
-					return
-				}
+	checkClosed := func() *TCPMessage {
+		attempts++
+		conn, err := spec.dial(ctx)
+
+		if err == nil {
+			conn.Close()
+			spec.observeAttempt(attempts, errStillAccepting)
+			if spec.Once {
+				msg := newTCPMessageFailed(spec, startTime, errStillAccepting)
+				msg.attempts = attempts
+				return msg
+			}
+			if attemptsExhausted(spec.MaxAttempts, attempts) {
+				err := errAttemptsExhausted(attempts, errStillAccepting)
+				msg := newTCPMessageFailed(spec, startTime, err)
+				msg.attempts = attempts
+				return msg
 			}
+			return nil
 		}
-	}()
+		if ctx.Err() != nil {
+			return cancelled()
+		}
+		if isConnRefused(err) {
+			spec.observeAttempt(attempts, nil)
+			msg := newTCPMessageReady(spec, startTime)
+			msg.attempts = attempts
+			return msg
+		}
+		spec.observeAttempt(attempts, err)
+		// Servers that are shutting down may reset connections before refusing them.
+		isReset := errors.Is(err, syscall.ECONNRESET)
+		if !spec.Once && (spec.RetryOnError || shouldWait(err) || isReset) {
+			if attemptsExhausted(spec.MaxAttempts, attempts) {
+				err = errAttemptsExhausted(attempts, err)
+			} else {
+				recordRetriedErr(ctx, spec, err)
+				return nil
+			}
+		}
+		msg := newTCPMessageFailed(spec, startTime, annotateErr(err))
+		msg.attempts = attempts
+		return msg
+	}
 
-	return out
+	return pollTCP(ctx, spec, startTime, checkClosed, cancelled)
+}
+
+// pollTCP runs the given check on the specifications every poll interval, until the check returns
+// a message or the context is cancelled. The check returns nil to keep polling. All messages are
+// sent through the returned channel, starting with a Start message.
+func pollTCP(
+	ctx context.Context,
+	spec *TCPSpec,
+	startTime time.Time,
+	check func() *TCPMessage,
+	cancelled func() *TCPMessage,
+) <-chan *TCPMessage {
+	// The result of the first attempt is marked, since it tells whether the server was already
+	// ready, or down, at the start.
+	checkTCP := func(immediate bool) *TCPMessage {
+		msg := check()
+		if msg != nil {
+			msg.immediate = immediate
+		}
+		return msg
+	}
+
+	return poll(ctx, spec.pollTiming(), newTCPMessageStart(spec, startTime), checkTCP, cancelled)
 }
 
 // OneTCP waits until a TCP connection can be made to an address, attempting a connection every
@@ -301,52 +995,162 @@ func OneTCP(spec *TCPSpec, waitTimeout time.Duration) <-chan *TCPMessage {
 }
 
 // AllTCP waits until connections can be made to all given TCP input specifications for at most
-// `waitTimeout` long. It returns a channel through which all wait operation-related messages will
-// be sent.  The returned channel is closed after all wait operations have finished.
+// `waitTimeout` long. If `waitTimeout` is NoTimeout, it waits without a timeout limit. It returns
+// a channel through which all wait operation-related messages will be sent.  The returned channel
+// is closed after all wait operations have finished. It must be received from until then, since
+// the wait operations can not be stopped otherwise; use AllTCPContext to be able to stop early.
 func AllTCP(specs []*TCPSpec, waitTimeout time.Duration) <-chan *TCPMessage {
+	return AllTCPContext(context.Background(), specs, waitTimeout)
+}
 
-	addrs := make([]string, len(specs))
-	for i, spec := range specs {
-		addrs[i] = spec.Addr()
-	}
-
+// AllTCPContext is AllTCP with a parent context, whose cancellation stops all wait operations and
+// closes the returned channel. Callers must either receive from the channel until it is closed or
+// cancel the context, or else the goroutines and connections of the wait operations are leaked.
+// Messages are not sent anymore once the context is done, so that callers may stop receiving
+// right after cancelling it.
+func AllTCPContext(
+	parent context.Context,
+	specs []*TCPSpec,
+	waitTimeout time.Duration,
+) <-chan *TCPMessage {
 	var (
 		chs         = make([](<-chan *TCPMessage), len(specs))
 		out         = make(chan *TCPMessage)
-		ctx, cancel = newContext()
+		ctx, cancel = newContext(parent)
 	)
 
+	// Track which wait operations have not emitted their final message yet, for reporting when
+	// the timeout limit is exceeded.
+	pending := make(map[*TCPSpec]bool, len(specs))
 	for i, spec := range specs {
+		pending[spec] = true
 		chs[i] = singleTCP(ctx, spec)
 	}
 
-	msgs := merge(chs)
-	timeout := time.NewTimer(waitTimeout)
+	msgs := merge(ctx, chs)
+	timeoutC, stopTimeout := startTimeout(waitTimeout)
 
 	go func() {
-		defer timeout.Stop()
-		defer cancel()
+		// Deferred calls run in reverse order: the output channel is closed only after all the
+		// underlying wait operations and forwarders have been signalled to stop.
 		defer close(out)
+		defer stopTimeout()
+		defer cancel()
+
+		// Callers that cancelled the parent context may not receive anymore, so sends give up then.
+		send := func(msg *TCPMessage) bool {
+			select {
+			case out <- msg:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
 
 		for {
 			select {
-			case <-timeout.C:
-				msg := newTCPMessageFailed(
-					nil,
-					startTimeFromContext(ctx),
-					fmt.Errorf("exceeded timeout limit of %s", waitTimeout),
-				)
-				out <- msg
+			case <-timeoutC:
+				send(newTimeoutMessage(ctx, specs, pending, waitTimeout))
 				return
 
 			case msg, isOpen := <-msgs:
 				if !isOpen {
 					return
 				}
-				out <- msg
+				if msg.status != Start {
+					delete(pending, msg.spec)
+				}
+				if !send(msg) {
+					return
+				}
 			}
 		}
 	}()
 
 	return out
 }
+
+// WaitTCP waits until connections can be made to all given addresses for at most `waitTimeout`
+// long, attempting a connection to each every `pollFreq`, unless the address sets its own. As in
+// AllTCP, a `waitTimeout` of NoTimeout waits without a timeout limit. The addresses are parsed as
+// in ParseTCPSpecs. It blocks until all servers are ready, in which case
+// nil is returned, or until the wait fails. Failures of single targets are returned with the
+// target prepended, while exceeding the timeout limit returns a *TimeoutError that counts all
+// pending targets. If the given context is done first, its error is returned. Progress messages
+// are discarded; use AllTCP to receive them.
+func WaitTCP(ctx context.Context, waitTimeout, pollFreq time.Duration, addrs ...string) error {
+	specs, err := ParseTCPSpecs(addrs, pollFreq)
+	if err != nil {
+		return err
+	}
+	return waitAllTCP(ctx, specs, waitTimeout)
+}
+
+// SingleTCPBlocking waits until a connection can be made to the server of the given specifications
+// for at most `waitTimeout` long. It is the blocking counterpart of OneTCP: nil is returned once
+// the server is ready, and otherwise the error is returned as in WaitTCP.
+func SingleTCPBlocking(ctx context.Context, spec *TCPSpec, waitTimeout time.Duration) error {
+	return waitAllTCP(ctx, []*TCPSpec{spec}, waitTimeout)
+}
+
+// waitAllTCP waits on the given specifications until all are ready, for WaitTCP and
+// SingleTCPBlocking.
+func waitAllTCP(ctx context.Context, specs []*TCPSpec, waitTimeout time.Duration) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	msgs := AllTCPContext(ctx, specs, waitTimeout)
+	// So that no wait operation is left running after an early return.
+	defer func() {
+		cancel()
+		for range msgs {
+		}
+	}()
+
+	for msg := range msgs {
+		if msg.status != Failed {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if msg.spec == nil {
+			return msg.err
+		}
+		return fmt.Errorf("%s: %w", msg.Target(), msg.err)
+	}
+
+	// Cancellation may stop the messages before any Failed message is sent.
+	return ctx.Err()
+}
+
+// newTimeoutMessage creates the Failed message emitted when the wait operations on the given
+// specifications exceed their timeout limit. The message lists the specifications that are still
+// pending, in the order they were given.
+func newTimeoutMessage(
+	ctx context.Context,
+	specs []*TCPSpec,
+	pending map[*TCPSpec]bool,
+	waitTimeout time.Duration,
+) *TCPMessage {
+	pendingSpecs := make([]*TCPSpec, 0, len(pending))
+	for _, spec := range specs {
+		if pending[spec] {
+			pendingSpecs = append(pendingSpecs, spec)
+		}
+	}
+	msg := newAggregateMessage(
+		ctx,
+		allTargetsLabel,
+		Failed,
+		&TimeoutError{
+			Limit:   waitTimeout,
+			Pending: len(pendingSpecs),
+			LastErr: latestRetriedErr(ctx, pendingSpecs),
+		},
+	)
+	for _, spec := range pendingSpecs {
+		msg.pending = append(msg.pending, spec.Target())
+	}
+	return msg
+}
@@ -5,9 +5,15 @@ package wait
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
 	"net"
+	"reflect"
+	"regexp"
+	"runtime"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -29,6 +35,19 @@ func TestMessageTarget(t *testing.T) {
 			),
 			"tcp://localhost:7000",
 		},
+		{
+			"with named TCPSpec",
+			newTCPMessageReady(
+				&TCPSpec{Name: "cache", Host: "localhost", Port: "7000", PollFreq: 1 * time.Second},
+				time.Now(),
+			),
+			"cache",
+		},
+		{
+			"aggregate",
+			newAggregateMessage(context.Background(), allTargetsLabel, Failed, fmt.Errorf("stub")),
+			"<all>",
+		},
 		{
 			"no TCPSpec",
 			newTCPMessageFailed(nil, time.Now(), fmt.Errorf("stub")),
@@ -54,6 +73,215 @@ func TestMessageTarget(t *testing.T) {
 	}
 }
 
+func TestTimeoutErrorError(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name string
+		in   *TimeoutError
+		want string
+	}{
+		{"limit only", &TimeoutError{Limit: time.Second}, "exceeded timeout limit of 1s"},
+		{
+			"one pending",
+			&TimeoutError{Limit: time.Second, Pending: 1},
+			"exceeded timeout limit of 1s with 1 target pending",
+		},
+		{
+			"many pending, last error",
+			&TimeoutError{Limit: time.Second, Pending: 3, LastErr: fmt.Errorf("stub")},
+			"exceeded timeout limit of 1s with 3 targets pending, last error: stub",
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			want := test.want
+			got := test.in.Error()
+
+			if want != got {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, name, want, got)
+			}
+		})
+	}
+}
+
+func TestPollInterval(t *testing.T) {
+	t.Parallel()
+
+	var (
+		freq  = 1 * time.Second
+		exact = &TCPSpec{PollFreq: freq}
+		jit   = &TCPSpec{PollFreq: freq, Jitter: 0.2}
+		seen  = make(map[time.Duration]bool)
+	)
+
+	if got := exact.pollTiming().interval(); got != freq {
+		t.Errorf("test no jitter failed - want: %s, got: %s", freq, got)
+	}
+
+	for i := 0; i < 100; i++ {
+		got := jit.pollTiming().interval()
+		if got < 800*time.Millisecond || got > 1200*time.Millisecond {
+			t.Fatalf("test jitter[%d] failed - want within 800ms-1.2s, got: %s", i, got)
+		}
+		seen[got] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("test jitter failed - want varying intervals, got: %v", seen)
+	}
+}
+
+func TestPollIntervalJitterRand(t *testing.T) {
+	t.Parallel()
+
+	var (
+		freq = 1 * time.Second
+		a    = &TCPSpec{PollFreq: freq, Jitter: 0.2, JitterRand: rand.New(rand.NewSource(42))}
+		b    = &TCPSpec{PollFreq: freq, Jitter: 0.2, JitterRand: rand.New(rand.NewSource(42))}
+	)
+
+	for i := 0; i < 10; i++ {
+		if want, got := a.pollTiming().interval(), b.pollTiming().interval(); want != got {
+			t.Errorf("test jitter[%d] failed - want: %s, got: %s", i, want, got)
+		}
+	}
+}
+
+func TestTargetStartTimeFromContext(t *testing.T) {
+	t.Parallel()
+
+	var (
+		opStart     = time.Now().Add(-time.Hour)
+		targetStart = time.Now().Add(-time.Minute)
+		opCtx       = context.WithValue(context.Background(), startTimeCtxKey, opStart)
+		tests       = []struct {
+			name       string
+			ctx        context.Context
+			wantOp     time.Time
+			wantTarget time.Time
+		}{
+			{"operation start only", opCtx, opStart, opStart},
+			{"both", WithTargetStartTime(opCtx, targetStart), opStart, targetStart},
+		}
+	)
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			if got := startTimeFromContext(test.ctx); !got.Equal(test.wantOp) {
+				t.Errorf("test[%d] %q failed - want operation: %s, got: %s", i, name, test.wantOp, got)
+			}
+			if got := targetStartTimeFromContext(test.ctx); !got.Equal(test.wantTarget) {
+				t.Errorf(
+					"test[%d] %q failed - want target: %s, got: %s",
+					i, name, test.wantTarget, got,
+				)
+			}
+		})
+	}
+
+	// Without any start time, the current time is used.
+	before := time.Now()
+	if got := targetStartTimeFromContext(context.Background()); got.Before(before) {
+		t.Errorf("test none failed - want current time, got: %s", got)
+	}
+}
+
+func TestSingleTCPTargetStartTime(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := newContext(context.Background())
+	defer cancel()
+	// The whole wait operation started long before the wait operation on the target.
+	ctx = context.WithValue(ctx, startTimeCtxKey, time.Now().Add(-time.Hour))
+
+	spec := &TCPSpec{
+		Host:     "flaky.invalid",
+		Port:     "5000",
+		PollFreq: 50 * time.Millisecond,
+		Dialer:   &flakyDialer{},
+	}
+	var msgs []*TCPMessage
+	for msg := range singleTCP(WithTargetStartTime(ctx, time.Now()), spec) {
+		msgs = append(msgs, msg)
+	}
+	for i, msg := range msgs {
+		if elTime := msg.ElapsedTime(); elTime >= time.Minute {
+			t.Errorf("test msgs[%d] failed - want elapsed time of target, got: %s", i, elTime)
+		}
+	}
+
+	agg := newAggregateMessage(ctx, allTargetsLabel, Ready, nil)
+	if elTime := agg.ElapsedTime(); elTime < time.Hour {
+		t.Errorf("test aggregate failed - want elapsed time of operation, got: %s", elTime)
+	}
+}
+
+func TestTCPSpecString(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		in   string
+		want string
+	}{
+		{"localhost:5000", "localhost:5000#1s"},
+		{"localhost:5000#250ms", "localhost:5000#250ms"},
+		{"localhost:5000#1.5", "localhost:5000#1.5s"},
+		{"primary-db=10.0.0.3:5432", "primary-db=10.0.0.3:5432#1s"},
+		{"http://localhost", "http://localhost:80#1s"},
+		{"HTTPS://example.com:8443#2s", "https://example.com:8443#2s"},
+		{"tcp6://[::1]:5000", "tcp6://[::1]:5000#1s"},
+		{"[::1]:5000", "[::1]:5000#1s"},
+		{"[fe80::1%eth0]:5000", "[fe80::1%eth0]:5000#1s"},
+		{"https://[fe80::1%25eth0]", "https://[fe80::1%eth0]:443#1s"},
+		{"host:http", "host:http#1s"},
+		{"web=http://localhost/health%20z?full=1#3s", "web=http://localhost:80/health%20z?full=1#3s"},
+		{"postgres://db?sslmode=disable", "postgres://db:5432?sslmode=disable#1s"},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.in, func(t *testing.T) {
+			t.Parallel()
+
+			spec, err := ParseTCPSpec(test.in, time.Second)
+			if err != nil {
+				t.Fatalf("test[%d] %q failed - unexpected error: %s", i, test.in, err)
+			}
+			got := spec.String()
+			if got != test.want {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, test.in, test.want, got)
+			}
+
+			// The default poll frequency must not matter, as it is always given.
+			reparsed, err := ParseTCPSpec(got, 10*time.Second)
+			if err != nil {
+				t.Fatalf("test[%d] %q failed - unexpected error parsing %q: %s", i, test.in, got, err)
+			}
+			if !reflect.DeepEqual(reparsed, spec) {
+				t.Errorf(
+					"test[%d] %q failed - want round trip: %+v, got: %+v",
+					i, test.in, *spec, *reparsed,
+				)
+			}
+		})
+	}
+}
+
 func TestParseTCPSpec(t *testing.T) {
 	t.Parallel()
 
@@ -96,6 +324,151 @@ func TestParseTCPSpec(t *testing.T) {
 			},
 			nil,
 		},
+		{
+			"name, no protocol, port, no poll freq",
+			"primary-db=10.0.0.3:5432",
+			&TCPSpec{
+				Name:     "primary-db",
+				Host:     "10.0.0.3",
+				Port:     "5432",
+				PollFreq: commonPollFreq,
+			},
+			nil,
+		},
+		{
+			"name, http, no port, poll freq",
+			"web_1.a=http://localhost#2s",
+			&TCPSpec{
+				Name:     "web_1.a",
+				Host:     "localhost",
+				Port:     "80",
+				PollFreq: 2 * time.Second,
+				Scheme:   "http",
+			},
+			nil,
+		},
+		{
+			"name, http, no port, path, query, poll freq",
+			"web=http://localhost/healthz?full=1#2s",
+			&TCPSpec{
+				Name:     "web",
+				Host:     "localhost",
+				Port:     "80",
+				PollFreq: 2 * time.Second,
+				Scheme:   "http",
+				Path:     "/healthz",
+				RawQuery: "full=1",
+			},
+			nil,
+		},
+		{
+			"postgres, IPv6, port, path",
+			"postgres://[::1]:5433/app",
+			&TCPSpec{
+				Host:     "::1",
+				Port:     "5433",
+				PollFreq: commonPollFreq,
+				Scheme:   "postgres",
+				Path:     "/app",
+			},
+			nil,
+		},
+		{
+			"http, invalid path",
+			"http://localhost/%zz",
+			nil,
+			errors.New("invalid URL path or query: \"/%zz\""),
+		},
+		{
+			"http, path, no host",
+			"http:///healthz",
+			nil,
+			fmt.Errorf("host not given: \"http:///healthz\""),
+		},
+		{
+			"no protocol, port, path",
+			"localhost:5000/healthz",
+			nil,
+			fmt.Errorf("invalid port \"5000/healthz\""),
+		},
+		{
+			"name, no protocol, no port",
+			"db=localhost",
+			nil,
+			fmt.Errorf("neither port nor protocol is given"),
+		},
+		{
+			"no protocol, port, unit-less poll freq",
+			"localhost:5000#3",
+			&TCPSpec{
+				Host:     "localhost",
+				Port:     "5000",
+				PollFreq: 3 * time.Second,
+			},
+			nil,
+		},
+		{
+			"no protocol, port, fractional unit-less poll freq",
+			"localhost:5000#0.5",
+			&TCPSpec{
+				Host:     "localhost",
+				Port:     "5000",
+				PollFreq: 500 * time.Millisecond,
+			},
+			nil,
+		},
+		{
+			"no protocol, port, zero poll freq",
+			"localhost:5000#0s",
+			nil,
+			fmt.Errorf("poll frequency must be positive, got: 0s"),
+		},
+		{
+			"no protocol, port, negative poll freq",
+			"localhost:5000#-1s",
+			nil,
+			fmt.Errorf("poll frequency must be positive, got: -1s"),
+		},
+		{
+			"no protocol, zero port",
+			"host:0",
+			nil,
+			fmt.Errorf("invalid port \"0\""),
+		},
+		{
+			"no protocol, out of range port",
+			"host:99999",
+			nil,
+			fmt.Errorf("invalid port \"99999\""),
+		},
+		{
+			"no protocol, unknown service port",
+			"host:abc",
+			nil,
+			fmt.Errorf("invalid port \"abc\""),
+		},
+		{
+			"no protocol, empty port",
+			"host:",
+			nil,
+			fmt.Errorf("invalid port \"\""),
+		},
+		{
+			"no protocol, service name port",
+			"host:http",
+			&TCPSpec{
+				Host:     "host",
+				Port:     "http",
+				PollFreq: commonPollFreq,
+			},
+			nil,
+		},
+		{
+			"no protocol, port, invalid poll freq",
+			"localhost:5000#bad",
+			nil,
+			fmt.Errorf("invalid poll frequency: \"bad\""),
+		},
 		{
 			"http, no port, no poll freq",
 			"http://localhost",
@@ -103,6 +476,7 @@ func TestParseTCPSpec(t *testing.T) {
 				Host:     "localhost",
 				Port:     "80",
 				PollFreq: commonPollFreq,
+				Scheme:   "http",
 			},
 			nil,
 		},
@@ -113,28 +487,241 @@ func TestParseTCPSpec(t *testing.T) {
 				Host:     "localhost",
 				Port:     "80",
 				PollFreq: 500 * time.Millisecond,
+				Scheme:   "http",
+			},
+			nil,
+		},
+		{
+			"http, port, no poll freq",
+			"http://localhost:3000",
+			&TCPSpec{
+				Host:     "localhost",
+				Port:     "3000",
+				PollFreq: commonPollFreq,
+				Scheme:   "http",
+			},
+			nil,
+		},
+		{
+			"http, port, poll freq",
+			"http://localhost:3000#2s",
+			&TCPSpec{
+				Host:     "localhost",
+				Port:     "3000",
+				PollFreq: 2 * time.Second,
+				Scheme:   "http",
+			},
+			nil,
+		},
+		{
+			"redis, no port, no poll freq",
+			"redis://localhost",
+			&TCPSpec{
+				Host:     "localhost",
+				Port:     "6379",
+				PollFreq: commonPollFreq,
+				Scheme:   "redis",
+			},
+			nil,
+		},
+		{
+			"tcp, port",
+			"tcp://localhost:5000",
+			&TCPSpec{
+				Host:     "localhost",
+				Port:     "5000",
+				PollFreq: commonPollFreq,
+				Scheme:   "tcp",
+				Network:  "tcp",
 			},
 			nil,
 		},
 		{
-			"http, port, no poll freq",
-			"http://localhost:3000",
-			&TCPSpec{
-				Host:     "localhost",
-				Port:     "3000",
-				PollFreq: commonPollFreq,
-			},
-			nil,
+			"tcp4, port, poll freq",
+			"TCP4://127.0.0.1:5000#2s",
+			&TCPSpec{
+				Host:     "127.0.0.1",
+				Port:     "5000",
+				PollFreq: 2 * time.Second,
+				Scheme:   "tcp4",
+				Network:  "tcp4",
+			},
+			nil,
+		},
+		{
+			"name, tcp6, port",
+			"db=tcp6://[::1]:5432",
+			&TCPSpec{
+				Name:     "db",
+				Host:     "::1",
+				Port:     "5432",
+				PollFreq: commonPollFreq,
+				Scheme:   "tcp6",
+				Network:  "tcp6",
+			},
+			nil,
+		},
+		{
+			"IPv6 zone, port",
+			"[fe80::1%eth0]:8080",
+			&TCPSpec{Host: "fe80::1%eth0", Port: "8080", PollFreq: commonPollFreq},
+			nil,
+		},
+		{
+			"protocol, IPv6 zone, port",
+			"tcp6://[fe80::1%eth0]:8080",
+			&TCPSpec{
+				Host:     "fe80::1%eth0",
+				Port:     "8080",
+				PollFreq: commonPollFreq,
+				Scheme:   "tcp6",
+				Network:  "tcp6",
+			},
+			nil,
+		},
+		{
+			"protocol, IPv6 zone, no port",
+			"http://[fe80::1%eth0]",
+			&TCPSpec{Host: "fe80::1%eth0", Port: "80", PollFreq: commonPollFreq, Scheme: "http"},
+			nil,
+		},
+		{
+			"protocol, URL-escaped IPv6 zone",
+			"http://[fe80::1%25eth0]:8080/health",
+			&TCPSpec{
+				Host:     "fe80::1%eth0",
+				Port:     "8080",
+				PollFreq: commonPollFreq,
+				Scheme:   "http",
+				Path:     "/health",
+			},
+			nil,
+		},
+		{
+			"IPv6 zone, no port",
+			"[fe80::1%eth0]",
+			nil,
+			fmt.Errorf("neither port nor protocol is given"),
+		},
+		{"zone on host name", "db%eth0:5432", nil, fmt.Errorf("invalid host %q", "db%eth0")},
+		{"zone on IPv4", "[10.0.0.1%eth0]:80", nil, fmt.Errorf("invalid host %q", "10.0.0.1%eth0")},
+		{"empty zone", "[fe80::1%]:80", nil, fmt.Errorf("invalid host %q", "fe80::1%")},
+		{
+			"tcp6, no port",
+			"tcp6://localhost",
+			nil,
+			fmt.Errorf("port not given and protocol is unknown: \"tcp6\""),
+		},
+		{"empty", "", nil, fmt.Errorf("host not given: \"\"")},
+		{"poll freq only", "#3s", nil, fmt.Errorf("host not given: \"#3s\"")},
+		{"no host, port", ":5000", nil, fmt.Errorf("host not given: \":5000\"")},
+		{"separator only", "://", nil, fmt.Errorf("host not given: \"://\"")},
+		{"protocol only", "http://", nil, fmt.Errorf("host not given: \"http://\"")},
+		{"empty name", "=localhost:5000", nil, fmt.Errorf("invalid host \"=localhost\"")},
+		{"space in host", "local host:5000", nil, fmt.Errorf("invalid host \"local host\"")},
+		{"unclosed IPv6 bracket", "[::", nil, fmt.Errorf("address [::: missing ']' in address")},
+		{
+			"multiple poll freqs",
+			"localhost:5000#1s#2s",
+			nil,
+			fmt.Errorf("invalid poll frequency: \"1s#2s\""),
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			wantSpec := test.wantSpec
+			wantErr := test.wantErr
+			gotSpec, gotErr := ParseTCPSpec(test.in, commonPollFreq)
+
+			if wantErr != nil && gotErr.Error() != wantErr.Error() {
+				t.Errorf("test[%d] %q failed - want err: %q, got: %q", i, name, wantErr, gotErr)
+			}
+
+			if wantErr == nil && *wantSpec != *gotSpec {
+				t.Errorf(
+					"test[%d] %q failed - want spec: %+v, got: %+v",
+					i,
+					name,
+					*wantSpec,
+					*gotSpec,
+				)
+			}
+		})
+	}
+}
+
+func FuzzParseTCPSpec(f *testing.F) {
+	for _, seed := range []string{
+		"localhost:5000",
+		"db=postgres://10.0.0.3#2s",
+		"tcp6://[::1]:80#0.5",
+		"http://[fe80::1%25eth0]",
+		"://",
+		"a#b#c",
+		"[::",
+		"#3s",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, rawAddr string) {
+		spec, err := ParseTCPSpec(rawAddr, time.Second)
+		if err != nil {
+			if spec != nil {
+				t.Fatalf("%q: want nil spec with error %q, got: %+v", rawAddr, err, *spec)
+			}
+			return
+		}
+		if spec == nil {
+			t.Fatalf("%q: want spec or error, got neither", rawAddr)
+		}
+		if err := validateHost(spec.Host, rawAddr); err != nil {
+			t.Errorf("%q: want valid host, got: %s", rawAddr, err)
+		}
+		if err := validatePort(spec.Port); err != nil {
+			t.Errorf("%q: want valid port, got: %s", rawAddr, err)
+		}
+		if spec.PollFreq <= 0 {
+			t.Errorf("%q: want positive poll frequency, got: %s", rawAddr, spec.PollFreq)
+		}
+	})
+}
+
+func TestRegisterProtoPort(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name     string
+		proto    string
+		port     string
+		rawAddr  string
+		wantPort string
+		wantErr  error
+	}{
+		{"new protocol", "Custom", "4321", "custom://localhost", "4321", nil},
+		{"override builtin", "memcached", "11311", "memcached://localhost", "11311", nil},
+		{
+			"invalid name",
+			"my-proto",
+			"4321",
+			"",
+			"",
+			fmt.Errorf("invalid protocol name: \"my-proto\""),
 		},
 		{
-			"http, port, poll freq",
-			"http://localhost:3000#2s",
-			&TCPSpec{
-				Host:     "localhost",
-				Port:     "3000",
-				PollFreq: 2 * time.Second,
-			},
-			nil,
+			"invalid port",
+			"zero",
+			"0",
+			"",
+			"",
+			fmt.Errorf("invalid port for protocol \"zero\": \"0\""),
 		},
 	}
 
@@ -146,27 +733,102 @@ func TestParseTCPSpec(t *testing.T) {
 			t.Parallel()
 
 			name := test.name
-			wantSpec := test.wantSpec
 			wantErr := test.wantErr
-			gotSpec, gotErr := ParseTCPSpec(test.in, commonPollFreq)
+			gotErr := RegisterProtoPort(test.proto, test.port)
 
-			if wantErr != nil && gotErr.Error() != wantErr.Error() {
-				t.Errorf("test[%d] %q failed - want err: %q, got: %q", i, name, wantErr, gotErr)
+			if wantErr != nil {
+				if gotErr == nil || gotErr.Error() != wantErr.Error() {
+					t.Errorf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+				}
+				return
 			}
 
-			if wantErr == nil && *wantSpec != *gotSpec {
+			spec, err := ParseTCPSpec(test.rawAddr, 1*time.Second)
+			if err != nil {
+				t.Fatalf("test[%d] %q failed - want no err, got: %q", i, name, err)
+			}
+			if spec.Port != test.wantPort {
+				t.Errorf("test[%d] %q failed - want port: %q, got: %q", i, name, test.wantPort, spec.Port)
+			}
+		})
+	}
+}
+
+func TestRegisterProtoPollFreq(t *testing.T) {
+	t.Parallel()
+
+	if err := RegisterProtoPollFreq("SlowProto", 2*time.Second); err != nil {
+		t.Fatalf("test failed - want no err, got: %s", err)
+	}
+
+	var tests = []struct {
+		name     string
+		rawAddr  string
+		wantFreq time.Duration
+	}{
+		{"scheme default", "slowproto://db:5432", 2 * time.Second},
+		{"explicit frequency", "slowproto://db:5432#100ms", 100 * time.Millisecond},
+		{"global default", "tcp://db:5432", time.Second},
+		{"no scheme", "db:5432", time.Second},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			spec, err := ParseTCPSpec(test.rawAddr, time.Second)
+			if err != nil {
+				t.Fatalf("test[%d] %q failed - want no err, got: %q", i, name, err)
+			}
+			if spec.PollFreq != test.wantFreq {
 				t.Errorf(
-					"test[%d] %q failed - want spec: %+v, got: %+v",
-					i,
-					name,
-					*wantSpec,
-					*gotSpec,
+					"test[%d] %q failed - want poll freq: %s, got: %s",
+					i, name, test.wantFreq, spec.PollFreq,
 				)
 			}
 		})
 	}
 }
 
+func TestRegisterProtoPollFreqInvalid(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name    string
+		proto   string
+		freq    time.Duration
+		wantErr string
+	}{
+		{"invalid name", "my-proto", time.Second, "invalid protocol name: \"my-proto\""},
+		{
+			"zero frequency",
+			"zerofreq",
+			0,
+			"invalid poll frequency for protocol \"zerofreq\": poll frequency must be positive, " +
+				"got: 0s",
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			wantErr := test.wantErr
+			if gotErr := RegisterProtoPollFreq(test.proto, test.freq); fmt.Sprint(gotErr) != wantErr {
+				t.Errorf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+			}
+		})
+	}
+}
+
 func ExampleParseTCPSpec() {
 	spec, _ := ParseTCPSpec("golang.org:80", 1*time.Second)
 	fmt.Println("host:", spec.Host)
@@ -218,9 +880,9 @@ func TestParseTCPSpecs(t *testing.T) {
 				"localhost:1234#200ms",
 			},
 			[]*TCPSpec{
-				{"127.0.0.1", "3000", 1 * time.Second},
-				{"golang.org", "443", 1 * time.Second},
-				{"localhost", "1234", 200 * time.Millisecond},
+				{Host: "127.0.0.1", Port: "3000", PollFreq: 1 * time.Second},
+				{Host: "golang.org", Port: "443", PollFreq: 1 * time.Second, Scheme: "https"},
+				{Host: "localhost", Port: "1234", PollFreq: 200 * time.Millisecond},
 			},
 			nil,
 		},
@@ -234,6 +896,28 @@ func TestParseTCPSpecs(t *testing.T) {
 			[]*TCPSpec{},
 			fmt.Errorf("address 1: neither port nor protocol is given"),
 		},
+		{
+			"CIDR expanded",
+			[]string{
+				"127.0.0.1:3000",
+				"cidr:10.0.0.0/30:8080#200ms",
+			},
+			[]*TCPSpec{
+				{Host: "127.0.0.1", Port: "3000", PollFreq: commonPollFreq},
+				{Host: "10.0.0.1", Port: "8080", PollFreq: 200 * time.Millisecond},
+				{Host: "10.0.0.2", Port: "8080", PollFreq: 200 * time.Millisecond},
+			},
+			nil,
+		},
+		{
+			"CIDR error",
+			[]string{
+				"127.0.0.1:3000",
+				"cidr:10.0.0.0/30",
+			},
+			[]*TCPSpec{},
+			fmt.Errorf("address 1: address 10.0.0.0/30: missing port in address"),
+		},
 	}
 
 	for i, test := range tests {
@@ -281,6 +965,63 @@ func TestParseTCPSpecs(t *testing.T) {
 // tcpServerHost is the hostname for the test TCP server.
 const tcpServerHost = "127.0.0.1"
 
+func TestDedupTCPSpecs(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name string
+		in   []*TCPSpec
+		want []TCPSpec
+	}{
+		{"empty", nil, []TCPSpec{}},
+		{
+			"no duplicates",
+			[]*TCPSpec{
+				{Host: "db", Port: "5432", PollFreq: time.Second},
+				{Host: "db", Port: "5433", PollFreq: time.Second},
+			},
+			[]TCPSpec{
+				{Host: "db", Port: "5432", PollFreq: time.Second},
+				{Host: "db", Port: "5433", PollFreq: time.Second},
+			},
+		},
+		{
+			"duplicates, smallest poll freq wins",
+			[]*TCPSpec{
+				{Name: "primary", Host: "db", Port: "5432", PollFreq: time.Second},
+				{Host: "cache", Port: "6379", PollFreq: time.Second},
+				{Host: "db", Port: "5432", PollFreq: 200 * time.Millisecond},
+				{Host: "cache", Port: "6379", PollFreq: 2 * time.Second},
+			},
+			[]TCPSpec{
+				{Name: "primary", Host: "db", Port: "5432", PollFreq: 200 * time.Millisecond},
+				{Host: "cache", Port: "6379", PollFreq: time.Second},
+			},
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			got := DedupTCPSpecs(test.in)
+
+			if len(got) != len(test.want) {
+				t.Fatalf("test[%d] %q failed - want %d specs, got %d", i, name, len(test.want), len(got))
+			}
+			for j, want := range test.want {
+				if *got[j] != want {
+					t.Errorf("test[%d][%d] %q failed - want: %+v, got: %+v", i, j, name, want, *got[j])
+				}
+			}
+		})
+	}
+}
+
 // getLocalTCPPort returns a TCP port for testing by asking the kernel for a free port.
 func getLocalTCPPort() string {
 	addr, err := net.ResolveTCPAddr("tcp", net.JoinHostPort(tcpServerHost, "0"))
@@ -465,6 +1206,9 @@ func TestOneTCPReady(t *testing.T) {
 	if status := mb.msgs[1].Status(); status != Ready {
 		t.Errorf("test msgs[1].Status() failed - want: %s, got %s", Ready, status)
 	}
+	if details := mb.msgs[1].Details(); details == nil || len(details) != 0 {
+		t.Errorf("test msgs[1].Details() failed - want: empty map, got %v", details)
+	}
 }
 
 func TestAllTCPReady(t *testing.T) {
@@ -484,8 +1228,8 @@ func TestAllTCPReady(t *testing.T) {
 
 	msgs := AllTCP(
 		[]*TCPSpec{
-			{servers[0].host, servers[0].port, 500 * time.Millisecond},
-			{servers[1].host, servers[1].port, 500 * time.Millisecond},
+			{Host: servers[0].host, Port: servers[0].port, PollFreq: 500 * time.Millisecond},
+			{Host: servers[1].host, Port: servers[1].port, PollFreq: 500 * time.Millisecond},
 		},
 		waitTimeout,
 	)
@@ -528,6 +1272,114 @@ func TestAllTCPReady(t *testing.T) {
 	}
 }
 
+func TestWaitTCP(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(tcpServerHost, "0"))
+	if err != nil {
+		t.Fatalf("failed starting listener: %s", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	var (
+		readyAddr = listener.Addr().String()
+		freeAddr  = net.JoinHostPort(tcpServerHost, getLocalTCPPort())
+	)
+
+	isTimeout := func(err error) bool {
+		var timeoutErr *TimeoutError
+		return errors.As(err, &timeoutErr) && timeoutErr.Pending == 1
+	}
+
+	var tests = []struct {
+		name        string
+		addrs       []string
+		cancelAfter time.Duration
+		want        func(error) bool
+	}{
+		{"ready", []string{readyAddr}, 0, func(err error) bool { return err == nil }},
+		{
+			"parse error",
+			[]string{readyAddr, "localhost"},
+			0,
+			func(err error) bool {
+				return fmt.Sprint(err) == "address 1: neither port nor protocol is given"
+			},
+		},
+		{"timeout", []string{readyAddr, freeAddr}, 0, isTimeout},
+		{
+			"cancelled",
+			[]string{freeAddr},
+			100 * time.Millisecond,
+			func(err error) bool { return errors.Is(err, context.Canceled) },
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if test.cancelAfter > 0 {
+				time.AfterFunc(test.cancelAfter, cancel)
+			}
+
+			err := WaitTCP(ctx, 500*time.Millisecond, 50*time.Millisecond, test.addrs...)
+			if !test.want(err) {
+				t.Errorf("test[%d] %q failed - got unexpected error: %v", i, test.name, err)
+			}
+		})
+	}
+}
+
+func TestSingleTCPBlocking(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name    string
+		dialer  *flakyDialer
+		wantErr string
+	}{
+		{"ready", &flakyDialer{refusals: 2}, ""},
+		{
+			"failed",
+			&flakyDialer{refusals: 1000, err: errors.New("stub")},
+			"tcp://flaky.invalid:5000: stub",
+		},
+		{
+			"timeout",
+			&flakyDialer{refusals: 1000},
+			"exceeded timeout limit of 200ms with 1 target pending",
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			spec := &TCPSpec{
+				Host:     "flaky.invalid",
+				Port:     "5000",
+				PollFreq: 20 * time.Millisecond,
+				Dialer:   test.dialer,
+			}
+			err := SingleTCPBlocking(context.Background(), spec, 200*time.Millisecond)
+
+			if (test.wantErr == "" && err != nil) ||
+				(test.wantErr != "" && !strings.HasPrefix(fmt.Sprint(err), test.wantErr)) {
+				t.Errorf("test[%d] %q failed - want err: %q, got: %v", i, test.name, test.wantErr, err)
+			}
+		})
+	}
+}
+
 func TestAllTCPTimeout(t *testing.T) {
 	t.Parallel()
 
@@ -545,8 +1397,8 @@ func TestAllTCPTimeout(t *testing.T) {
 
 	msgs := AllTCP(
 		[]*TCPSpec{
-			{servers[0].host, servers[0].port, 500 * time.Millisecond},
-			{servers[1].host, servers[1].port, 500 * time.Millisecond},
+			{Host: servers[0].host, Port: servers[0].port, PollFreq: 500 * time.Millisecond},
+			{Host: servers[1].host, Port: servers[1].port, PollFreq: 500 * time.Millisecond},
 		},
 		waitTimeout,
 	)
@@ -569,6 +1421,16 @@ func TestAllTCPTimeout(t *testing.T) {
 	if status := mb.msgs[mb.count()-1].Status(); status != Failed {
 		t.Errorf("test failed msgs[-1].Status() failed - want: %s, got: %s", Failed, status)
 	}
+	var timeoutErr *TimeoutError
+	if err := mb.msgs[mb.count()-1].Err(); !errors.As(err, &timeoutErr) {
+		t.Errorf("test failed msgs[-1].Err() failed - want: *TimeoutError, got: %T", err)
+	}
+	// The timeout failure must list the server that was never ready as pending.
+	wantPending := "tcp://" + servers[0].addr()
+	if pending := mb.msgs[mb.count()-1].PendingTargets(); len(pending) != 1 ||
+		pending[0] != wantPending {
+		t.Errorf("test msgs[-1].PendingTargets() failed - want: [%s], got: %v", wantPending, pending)
+	}
 
 	// The messages from waiting for the first server must be as expected.
 	addr1 := servers[0].addr()
@@ -593,3 +1455,134 @@ func TestAllTCPTimeout(t *testing.T) {
 		t.Errorf("test[%s] msgs[1].Status() failed - want: %s, got %s", addr2, Ready, status)
 	}
 }
+
+func TestAllTCPMaxAttempts(t *testing.T) {
+	t.Parallel()
+
+	spec := &TCPSpec{
+		Host:        tcpServerHost,
+		Port:        getLocalTCPPort(),
+		PollFreq:    20 * time.Millisecond,
+		MaxAttempts: 3,
+	}
+	mb := newMessageBox(AllTCP([]*TCPSpec{spec}, 5*time.Second))
+	if msgCount := mb.count(); msgCount != 2 {
+		t.Fatalf("test failed - want %d messages, got %d", 2, msgCount)
+	}
+
+	// The target must fail once its attempts are exhausted, well before the timeout limit.
+	last := mb.msgs[1]
+	if status := last.Status(); status != Failed {
+		t.Fatalf("test msgs[1].Status() failed - want: %s, got: %s", Failed, status)
+	}
+	wantErr := "gave up after 3 attempts: "
+	if err := last.Err(); err == nil || !strings.HasPrefix(err.Error(), wantErr) {
+		t.Errorf("test msgs[1].Err() failed - want prefix: %q, got: %v", wantErr, err)
+	}
+	if attempts := last.Attempts(); attempts != 3 {
+		t.Errorf("test msgs[1].Attempts() failed - want: %d, got: %d", 3, attempts)
+	}
+}
+
+// This test is not parallel, so that the number of goroutines is not affected by other tests.
+func TestAllTCPTimeoutStress(t *testing.T) {
+	var (
+		before   = runtime.NumGoroutine()
+		pollFreq = 300 * time.Millisecond
+		// The server accepts connections but never sends the expected banner, so that the wait
+		// operations are in the middle of slow probes when the timeout limit is exceeded.
+		server = &tcpServer{host: tcpServerHost, port: getLocalTCPPort(), t: t}
+		specs  = make([]*TCPSpec, 200)
+	)
+
+	_, cancel := server.start(context.Background())
+	defer cancel()
+
+	for i := range specs {
+		specs[i] = &TCPSpec{
+			Host:     server.host,
+			Port:     server.port,
+			PollFreq: pollFreq,
+			Expect:   regexp.MustCompile("^never"),
+		}
+	}
+
+	mb := newMessageBox(AllTCP(specs, 500*time.Millisecond))
+	if status := mb.msgs[mb.count()-1].Status(); status != Failed {
+		t.Fatalf("test failed msgs[-1].Status() failed - want: %s, got: %s", Failed, status)
+	}
+
+	// Goroutines of the test server are still running until cancel is called.
+	cancel()
+	if after := waitGoroutines(before, 2*pollFreq+time.Second); after > before {
+		t.Errorf("test failed - want at most %d goroutines, got: %d", before, after)
+	}
+}
+
+// This test is not parallel, so that the number of goroutines is not affected by other tests.
+func TestAllTCPContextCancel(t *testing.T) {
+	var (
+		before      = runtime.NumGoroutine()
+		pollFreq    = 50 * time.Millisecond
+		specs       = make([]*TCPSpec, 10)
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	defer cancel()
+
+	for i := range specs {
+		specs[i] = &TCPSpec{Host: tcpServerHost, Port: getLocalTCPPort(), PollFreq: pollFreq}
+	}
+
+	// Without a timeout limit, the wait operations only end because they are cancelled. No more
+	// messages are received after cancelling, as callers that give up early would do.
+	msgs := AllTCPContext(ctx, specs, NoTimeout)
+	if status := (<-msgs).Status(); status != Start {
+		t.Fatalf("test msgs[0].Status() failed - want: %s, got: %s", Start, status)
+	}
+	cancel()
+
+	if after := waitGoroutines(before, 2*pollFreq+time.Second); after > before {
+		t.Errorf("test failed - want at most %d goroutines, got: %d", before, after)
+	}
+}
+
+func TestAllTCPNoTimeout(t *testing.T) {
+	t.Parallel()
+
+	var (
+		dialer = &flakyDialer{refusals: 10}
+		spec   = &TCPSpec{
+			Host:     "flaky.invalid",
+			Port:     "5000",
+			PollFreq: 20 * time.Millisecond,
+			Dialer:   dialer,
+		}
+	)
+
+	mb := newMessageBox(AllTCP([]*TCPSpec{spec}, NoTimeout))
+	if msgCount := mb.count(); msgCount != 2 {
+		t.Fatalf("test failed - want %d messages, got %d", 2, msgCount)
+	}
+	if status := mb.msgs[1].Status(); status != Ready {
+		t.Errorf("test msgs[1].Status() failed - want: %s, got %s", Ready, status)
+	}
+}
+
+func TestSingleTCPBlockingNoTimeoutCancelled(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+		spec        = &TCPSpec{
+			Host:     "flaky.invalid",
+			Port:     "5000",
+			PollFreq: 20 * time.Millisecond,
+			Dialer:   &flakyDialer{refusals: 1000},
+		}
+	)
+	defer cancel()
+
+	if err := SingleTCPBlocking(ctx, spec, NoTimeout); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("test failed - want err: %q, got: %v", context.DeadlineExceeded, err)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TLSPin is the SHA-256 fingerprint of a certificate, i.e. the hash of its DER encoding.
+type TLSPin [sha256.Size]byte
+
+// String returns the fingerprint in lowercase hexadecimal.
+func (pin TLSPin) String() string {
+	return hex.EncodeToString(pin[:])
+}
+
+// ParseTLSPin parses the given SHA-256 certificate fingerprint, given in hexadecimal in any letter
+// case, optionally with its bytes separated by colons as printed by `openssl x509 -fingerprint`.
+func ParseTLSPin(rawPin string) (TLSPin, error) {
+	var pin TLSPin
+	decoded, err := hex.DecodeString(strings.ReplaceAll(strings.TrimSpace(rawPin), ":", ""))
+	if err != nil || len(decoded) != len(pin) {
+		return pin, fmt.Errorf("invalid TLS pin, want SHA-256 fingerprint in hex, got: %q", rawPin)
+	}
+	copy(pin[:], decoded)
+	return pin, nil
+}
+
+// errNoPeerCertificate is the error of TLS connections over which the server presented no
+// certificate.
+var errNoPeerCertificate = errors.New("server presented no certificate")
+
+// TLSPinError is the error of TLS connections over which the server presented a certificate that is
+// not pinned.
+type TLSPinError struct {
+	// Fingerprint is the fingerprint of the certificate presented by the server.
+	Fingerprint TLSPin
+}
+
+// Error returns the error message.
+func (e *TLSPinError) Error() string {
+	return fmt.Sprintf("certificate fingerprint is not pinned: %s", e.Fingerprint)
+}
+
+// verifyTLSPins checks whether the certificate that the server presented in the given connection
+// state has one of the given fingerprints. Only the leaf certificate is checked, since any other
+// certificate in the chain could be presented by any server.
+func verifyTLSPins(pins []TLSPin, state tls.ConnectionState) error {
+	if len(state.PeerCertificates) == 0 {
+		return errNoPeerCertificate
+	}
+	fingerprint := TLSPin(sha256.Sum256(state.PeerCertificates[0].Raw))
+	for _, pin := range pins {
+		if pin == fingerprint {
+			return nil
+		}
+	}
+	return &TLSPinError{Fingerprint: fingerprint}
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseTLSPin(t *testing.T) {
+	t.Parallel()
+
+	const hexPin = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+	var tests = []struct {
+		name    string
+		in      string
+		want    string
+		wantErr string
+	}{
+		{"lowercase", hexPin, hexPin, ""},
+		{
+			"uppercase with colons",
+			"9F:86:D0:81:88:4C:7D:65:9A:2F:EA:A0:C5:5A:D0:15:" +
+				"A3:BF:4F:1B:2B:0B:82:2C:D1:5D:6C:15:B0:F0:0A:08",
+			hexPin,
+			"",
+		},
+		{
+			"too short",
+			"9f86d081",
+			"",
+			"invalid TLS pin, want SHA-256 fingerprint in hex, got: \"9f86d081\"",
+		},
+		{
+			"not hex",
+			"sha256:" + hexPin,
+			"",
+			"invalid TLS pin, want SHA-256 fingerprint in hex, got: \"sha256:" + hexPin + "\"",
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			wantErr := test.wantErr
+			got, gotErr := ParseTLSPin(test.in)
+
+			if (wantErr == "" && gotErr != nil) || (wantErr != "" && fmt.Sprint(gotErr) != wantErr) {
+				t.Errorf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+			}
+			if wantErr == "" && got.String() != test.want {
+				t.Errorf("test[%d] %q failed - want: %q, got: %q", i, name, test.want, got)
+			}
+		})
+	}
+}
+
+func TestSingleHTTPTLSPin(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewUnstartedServer(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+	// Handshakes rejected by the client are expected, so they are not logged.
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	var (
+		serverPin = TLSPin(sha256.Sum256(server.Certificate().Raw))
+		otherPin  = TLSPin(sha256.Sum256([]byte("other")))
+		tests     = []struct {
+			name         string
+			pins         []TLSPin
+			strict       bool
+			wantStatus   Status
+			wantPinErr   bool
+			wantAttempts int
+		}{
+			{"pinned", []TLSPin{otherPin, serverPin}, false, Ready, false, 1},
+			{"not pinned", []TLSPin{otherPin}, false, Failed, false, 0},
+			{"not pinned strict", []TLSPin{otherPin}, true, Failed, true, 1},
+		}
+	)
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			spec, err := ParseHTTPSpec(server.URL, 20*time.Millisecond)
+			if err != nil {
+				t.Fatalf("test[%d] %q failed - unexpected error: %s", i, name, err)
+			}
+			spec.NoProxy = true
+			spec.TLSPins = test.pins
+			spec.TLSPinStrict = test.strict
+
+			ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+			defer cancel()
+
+			msgs := collectHTTPMessages(SingleHTTP(ctx, spec))
+			last := msgs[len(msgs)-1]
+
+			if status := last.Status(); status != test.wantStatus {
+				t.Fatalf(
+					"test[%d] %q failed - want: %s, got: %s (%v)",
+					i,
+					name,
+					test.wantStatus,
+					status,
+					last.Err(),
+				)
+			}
+			var pinErr *TLSPinError
+			if gotPinErr := errors.As(last.Err(), &pinErr); gotPinErr != test.wantPinErr {
+				t.Errorf("test[%d] %q failed - want pin err: %t, got: %v", i, name, test.wantPinErr, last.Err())
+			}
+			if pinErr != nil && pinErr.Fingerprint != serverPin {
+				t.Errorf("test[%d] %q failed - want: %s, got: %s", i, name, serverPin, pinErr.Fingerprint)
+			}
+			// Servers presenting certificates that are not pinned are polled until the timeout.
+			if test.wantAttempts == 0 && last.Attempts() < 2 {
+				t.Errorf("test[%d] %q failed - want retries, got: %d attempts", i, name, last.Attempts())
+			}
+			if test.wantAttempts > 0 && last.Attempts() != test.wantAttempts {
+				t.Errorf(
+					"test[%d] %q failed - want: %d attempts, got: %d",
+					i,
+					name,
+					test.wantAttempts,
+					last.Attempts(),
+				)
+			}
+		})
+	}
+}
